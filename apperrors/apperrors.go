@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -32,6 +33,13 @@ type Error struct {
 
 	// A list of error responses to return to the user.
 	Responses []interface{}
+
+	// RetryAfter is how long the user should wait before retrying the request, zero when unknown or when retrying will
+	// not help. It is usually set for ETRateLimited and ETUnavailable errors and is sent in the Retry-After header.
+	RetryAfter time.Duration
+
+	// Retryable is whether the failed operation can safely be retried as is, ex. a transaction aborted by a deadlock.
+	Retryable bool
 }
 
 func (e *Error) AddResponse(r interface{}) {
@@ -55,34 +63,61 @@ func (e *Error) Is(err error) bool {
 	}
 }
 
+// The HTTP status code of each error type.
+var statusCodes = map[string]int{
+	ETInvalid:              http.StatusBadRequest,
+	ETNotFound:             http.StatusNotFound,
+	ETPreconditionFailed:   http.StatusPreconditionFailed,
+	ETPreconditionRequired: http.StatusPreconditionRequired,
+	ETConflict:             http.StatusConflict,
+	ETUnauthorized:         http.StatusUnauthorized,
+	ETForbidden:            http.StatusForbidden,
+	ETRateLimited:          http.StatusTooManyRequests,
+	ETUnavailable:          http.StatusServiceUnavailable,
+	ETUnsupportedMediaType: http.StatusUnsupportedMediaType,
+}
+
+// The error types that can have user responses, see HasResponse. Not found and precondition required errors are fully
+// described by their status code.
+var responseTypes = map[string]struct{}{
+	ETInvalid:              {},
+	ETPreconditionFailed:   {},
+	ETConflict:             {},
+	ETUnauthorized:         {},
+	ETForbidden:            {},
+	ETRateLimited:          {},
+	ETUnavailable:          {},
+	ETUnsupportedMediaType: {},
+}
+
+// AsError finds the first application error in the chain of an error (see errors.As), so errors wrapping an
+// application error (ex. via fmt.Errorf and %w) are classified the same as the application error itself.
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
 // StatusCode returns the HTTP status code for the given error. For most errors this will be 500, usually only errors
 // returning error responses (see HasResponse) will have a non-500 response codes.
 func StatusCode(err error) int {
-	switch e := err.(type) {
-	case *Error:
-		switch e.EType {
-		case ETInvalid:
-			return http.StatusBadRequest
-		case ETNotFound:
-			return http.StatusNotFound
-		default:
-			return http.StatusInternalServerError
+	if e, ok := AsError(err); ok {
+		if code, found := statusCodes[e.EType]; found {
+			return code
 		}
-	default:
-		return http.StatusInternalServerError
 	}
+	return http.StatusInternalServerError
 }
 
 // HasResponse indicates whether the error has a user response. A user response is an error message that can be returned
 // to the user (usually via JSON response) detailing to them what went wrong. Internal errors and non-application errors
 // will always return false.
 func HasResponse(err error) bool {
-	switch e := err.(type) {
-	case *Error:
-		switch e.EType {
-		case ETInvalid:
-			return len(e.Responses) > 0
-		}
+	if e, ok := AsError(err); ok {
+		_, found := responseTypes[e.EType]
+		return found && len(e.Responses) > 0
 	}
 	return false
 }
@@ -90,42 +125,72 @@ func HasResponse(err error) bool {
 // ToJSON encodes an error to JSON. It will return an error if the error does not support sending a message to the end
 // user. An error that returns false to HasResponse cannot use ToJSON.
 func ToJSON(err error) ([]byte, error) {
-	switch e := err.(type) {
-	case *Error:
-		switch e.EType {
-		case ETInvalid:
-			return json.Marshal(errResponse{e.Responses})
-		default:
-			return nil, fmt.Errorf("error type for JSON, expected %s, but was %s", ETInvalid, e.EType)
-		}
-	default:
+	e, ok := AsError(err)
+	if !ok {
 		return nil, fmt.Errorf("error is not an application error, err: %w", err)
 	}
+	if _, found := responseTypes[e.EType]; !found {
+		return nil, fmt.Errorf("error type %s does not support JSON responses", e.EType)
+	}
+	return json.Marshal(errResponse{e.Responses})
 }
 
 // IsInternal indicates if an error is intended to be shown to the end user.
 func IsInternal(err error) bool {
-	switch e := err.(type) {
-	case *Error:
+	if e, ok := AsError(err); ok {
 		return e.EType == ETInternal
-	default:
-		return true
 	}
+	return true
+}
+
+// IsRetryable returns whether the operation that caused the error can safely be retried as is, see Error.Retryable.
+// Non-application errors are not retryable.
+func IsRetryable(err error) bool {
+	if e, ok := AsError(err); ok {
+		return e.Retryable
+	}
+	return false
 }
 
-// FieldErrorResponse is a error response meant for the end user indicating an error with a specific field.
+// RetryAfter returns how long the user should wait before retrying the request that caused the error, see
+// Error.RetryAfter. Ok is false when the error does not say.
+func RetryAfter(err error) (retryAfter time.Duration, ok bool) {
+	if e, isApp := AsError(err); isApp && e.RetryAfter > 0 {
+		return e.RetryAfter, true
+	}
+	return 0, false
+}
+
+// FieldErrorResponse is a error response meant for the end user indicating an error with a specific field. Code is the
+// stable identifier of the error, see Codes.
 type FieldErrorResponse struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
+	Code  string `json:"code"`
+
+	// Args are the values of the variable parts of Error (ex. the maximum length of a message), so the error can be
+	// rendered in the language of the user (see the localize package). They are not sent to the user.
+	Args map[string]interface{} `json:"-"`
 }
 
-// ErrResponse is a error response meant for the end user detailing the error that occurred. See ErrorResponse for
-// an example.
+// ErrResponse is a error response meant for the end user detailing the error that occurred. Code is the stable
+// identifier of the error, see Codes. See ErrorResponse for an example.
 type ErrResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code"`
+
+	// Args are the values of the variable parts of Error, see FieldErrorResponse.Args.
+	Args map[string]interface{} `json:"-"`
+}
+
+// ErrorResponse creates an ErrResponse with a given code and message.
+func ErrorResponse(code, errMsg string) ErrResponse {
+	return ErrResponse{Error: errMsg, Code: code}
 }
 
-// ErrorResponse creates an ErrResponse with a given message.
-func ErrorResponse(errMsg string) ErrResponse {
-	return ErrResponse{Error: errMsg}
+// WithArgs returns a copy of the response with the values of the variable parts of its message, see
+// FieldErrorResponse.Args.
+func (r ErrResponse) WithArgs(args map[string]interface{}) ErrResponse {
+	r.Args = args
+	return r
 }
@@ -20,7 +20,7 @@ func ExampleError_userErrors() {
 		Err:   origErr,
 		Stack: errors2.WithStack(origErr),
 	}
-	aErr.AddResponse(apperrors.ErrorResponse("you did this wrong"))
+	aErr.AddResponse(apperrors.ErrorResponse("thing.invalid", "you did this wrong"))
 
 	var err error = &aErr
 
@@ -36,7 +36,7 @@ func ExampleError_userErrors() {
 	// Output:
 	// true
 	// 400
-	// {"errors":[{"error":"you did this wrong"}]}
+	// {"errors":[{"error":"you did this wrong","code":"thing.invalid"}]}
 }
 
 func ExampleError_internalErrors() {
@@ -73,6 +73,7 @@ func ExampleFieldErrorResponse() {
 	aErr.AddResponse(apperrors.FieldErrorResponse{
 		Field: "myField",
 		Error: "this went wrong",
+		Code:  "thing.invalid",
 	})
 
 	var err error = &aErr
@@ -83,7 +84,7 @@ func ExampleFieldErrorResponse() {
 	fmt.Print(string(d))
 
 	// Output:
-	// {"errors":[{"field":"myField","error":"this went wrong"}]}
+	// {"errors":[{"field":"myField","error":"this went wrong","code":"thing.invalid"}]}
 }
 
 func ExampleErrorResponse() {
@@ -96,7 +97,7 @@ func ExampleErrorResponse() {
 		Err:   origErr,
 		Stack: errors2.WithStack(origErr),
 	}
-	aErr.AddResponse(apperrors.ErrorResponse("you did this wrong"))
+	aErr.AddResponse(apperrors.ErrorResponse("thing.invalid", "you did this wrong"))
 
 	var err error = &aErr
 	d, jsonErr := apperrors.ToJSON(err)
@@ -106,5 +107,5 @@ func ExampleErrorResponse() {
 	fmt.Print(string(d))
 
 	// Output:
-	// {"errors":[{"error":"you did this wrong"}]}
+	// {"errors":[{"error":"you did this wrong","code":"thing.invalid"}]}
 }
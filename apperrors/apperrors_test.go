@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -14,10 +15,11 @@ func TestToJSON_canEncodeToJSON(t *testing.T) {
 	e.AddResponse(FieldErrorResponse{
 		Field: "myfield",
 		Error: "what went wrong",
+		Code:  CodeMessageBlank,
 	})
 	d, err := ToJSON(&e)
 	require.NoError(t, err)
-	require.Equal(t, `{"errors":[{"field":"myfield","error":"what went wrong"}]}`, string(d))
+	require.Equal(t, `{"errors":[{"field":"myfield","error":"what went wrong","code":"message.blank"}]}`, string(d))
 }
 
 func TestHasResponse_trueWhenInvalidAndContainsAResponse(t *testing.T) {
@@ -29,6 +31,61 @@ func TestHasResponse_trueWhenInvalidAndContainsAResponse(t *testing.T) {
 	require.True(t, HasResponse(&e))
 }
 
+func TestHasResponse_trueForUserErrorTypes(t *testing.T) {
+	for _, etype := range []string{ETInvalid, ETPreconditionFailed, ETConflict, ETUnauthorized, ETForbidden,
+		ETRateLimited, ETUnavailable, ETUnsupportedMediaType} {
+		t.Run(etype, func(t *testing.T) {
+			e := Error{EType: etype}
+			require.False(t, HasResponse(&e), "no responses")
+			e.AddResponse(ErrorResponse("thing.invalid", "what went wrong"))
+			require.True(t, HasResponse(&e))
+
+			d, err := ToJSON(&e)
+			require.NoError(t, err)
+			require.Equal(t, `{"errors":[{"error":"what went wrong","code":"thing.invalid"}]}`, string(d))
+		})
+	}
+}
+
+func TestHasResponse_recognizesWrappedErrors(t *testing.T) {
+	e := &Error{EType: ETConflict}
+	e.AddResponse(ErrorResponse("thing.conflict", "what went wrong"))
+	wrapped := fmt.Errorf("wrapped: %w", e)
+	require.True(t, HasResponse(wrapped))
+	require.False(t, IsInternal(wrapped))
+
+	d, err := ToJSON(wrapped)
+	require.NoError(t, err)
+	require.Equal(t, `{"errors":[{"error":"what went wrong","code":"thing.conflict"}]}`, string(d))
+}
+
+func TestAsError(t *testing.T) {
+	e := &Error{EType: ETInvalid}
+	found, ok := AsError(fmt.Errorf("twice: %w", fmt.Errorf("wrapped: %w", e)))
+	require.True(t, ok)
+	require.Same(t, e, found)
+
+	_, ok = AsError(errors.New("other"))
+	require.False(t, ok)
+}
+
+func TestRetryAfter(t *testing.T) {
+	retryAfter, ok := RetryAfter(fmt.Errorf("wrapped: %w", &Error{EType: ETRateLimited, RetryAfter: time.Minute}))
+	require.True(t, ok)
+	require.Equal(t, time.Minute, retryAfter)
+
+	_, ok = RetryAfter(&Error{EType: ETUnavailable})
+	require.False(t, ok)
+	_, ok = RetryAfter(errors.New("other"))
+	require.False(t, ok)
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, IsRetryable(fmt.Errorf("wrapped: %w", &Error{EType: ETConflict, Retryable: true})))
+	require.False(t, IsRetryable(&Error{EType: ETConflict}))
+	require.False(t, IsRetryable(errors.New("other")))
+}
+
 func TestHasResponse_falseWhenNotInvalid(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -36,6 +93,7 @@ func TestHasResponse_falseWhenNotInvalid(t *testing.T) {
 	}{
 		{"internal", ETInternal},
 		{"not found", ETNotFound},
+		{"precondition required", ETPreconditionRequired},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -82,6 +140,17 @@ func TestStatusCode_returnsCorrectCode(t *testing.T) {
 		{name: "internal", code: http.StatusInternalServerError, err: &Error{EType: ETInternal}},
 		{name: "not found", code: http.StatusNotFound, err: &Error{EType: ETNotFound}},
 		{name: "invalid", code: http.StatusBadRequest, err: &Error{EType: ETInvalid}},
+		{name: "precondition failed", code: http.StatusPreconditionFailed, err: &Error{EType: ETPreconditionFailed}},
+		{name: "precondition required", code: http.StatusPreconditionRequired, err: &Error{EType: ETPreconditionRequired}},
+		{name: "conflict", code: http.StatusConflict, err: &Error{EType: ETConflict}},
+		{name: "unauthorized", code: http.StatusUnauthorized, err: &Error{EType: ETUnauthorized}},
+		{name: "forbidden", code: http.StatusForbidden, err: &Error{EType: ETForbidden}},
+		{name: "rate limited", code: http.StatusTooManyRequests, err: &Error{EType: ETRateLimited}},
+		{name: "unavailable", code: http.StatusServiceUnavailable, err: &Error{EType: ETUnavailable}},
+		{name: "unsupported media type", code: http.StatusUnsupportedMediaType,
+			err: &Error{EType: ETUnsupportedMediaType}},
+		{name: "wrapped", code: http.StatusNotFound, err: fmt.Errorf("wrapped: %w", &Error{EType: ETNotFound})},
+		{name: "unknown type", code: http.StatusInternalServerError, err: &Error{EType: "unknown"}},
 		{name: "non app error", code: http.StatusInternalServerError, err: fmt.Errorf("some error")},
 	}
 	for _, c := range cases {
@@ -90,3 +159,56 @@ func TestStatusCode_returnsCorrectCode(t *testing.T) {
 		})
 	}
 }
+
+func TestToProblem(t *testing.T) {
+	invalid := &Error{EType: ETInvalid}
+	invalid.AddResponse(ErrorResponse(CodeMessageBlank, "what went wrong"))
+
+	cases := []struct {
+		name     string
+		err      error
+		expected Problem
+	}{
+		{"invalid", invalid, Problem{
+			Type:     "urn:messageappdemo:problem:invalid",
+			Title:    "Invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   "The request is invalid, see errors for the details.",
+			Instance: "/messages",
+			Errors:   []interface{}{ErrorResponse(CodeMessageBlank, "what went wrong")},
+		}},
+		{"precondition failed", &Error{EType: ETPreconditionFailed}, Problem{
+			Type:     "urn:messageappdemo:problem:precondition-failed",
+			Title:    "Precondition failed",
+			Status:   http.StatusPreconditionFailed,
+			Detail:   "The resource does not match the conditions of the request (ex. If-Match).",
+			Instance: "/messages",
+		}},
+		{"internal errors have no responses", &Error{EType: ETInternal, Responses: []interface{}{"secret"}}, Problem{
+			Type:     "urn:messageappdemo:problem:internal",
+			Title:    "Internal error",
+			Status:   http.StatusInternalServerError,
+			Detail:   "An unexpected error occurred while processing the request.",
+			Instance: "/messages",
+		}},
+		{"rate limited", fmt.Errorf("wrapped: %w", &Error{EType: ETRateLimited, RetryAfter: time.Second}), Problem{
+			Type:     "urn:messageappdemo:problem:rate-limited",
+			Title:    "Too many requests",
+			Status:   http.StatusTooManyRequests,
+			Detail:   "Too many requests were made, retry after the time given by the Retry-After header.",
+			Instance: "/messages",
+		}},
+		{"non app error", fmt.Errorf("some error"), Problem{
+			Type:     "urn:messageappdemo:problem:internal",
+			Title:    "Internal error",
+			Status:   http.StatusInternalServerError,
+			Detail:   "An unexpected error occurred while processing the request.",
+			Instance: "/messages",
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, ToProblem(c.err, "/messages"))
+		})
+	}
+}
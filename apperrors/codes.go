@@ -0,0 +1,118 @@
+package apperrors
+
+import "sort"
+
+// Codes of the user responses of errors, see ErrResponse and FieldErrorResponse. Unlike the error messages, codes are
+// stable so clients can rely on them to determine what went wrong. Every code must be documented in the catalog, see
+// Codes.
+const (
+	CodeAnalyzerInvalid               = "analyzer.invalid"
+	CodeDataConcurrentChange          = "data.concurrentChange"
+	CodeDataConflict                  = "data.conflict"
+	CodeDataInvalid                   = "data.invalid"
+	CodeFilterFieldInvalid            = "filter.field.invalid"
+	CodeFilterInvalid                 = "filter.invalid"
+	CodeFilterOperatorInvalid         = "filter.operator.invalid"
+	CodeFilterValueInvalid            = "filter.value.invalid"
+	CodeHeaderIfMatchInvalid          = "header.ifMatch.invalid"
+	CodeMessageBlank                  = "message.blank"
+	CodeMessageIdInvalid              = "message.id.invalid"
+	CodeMessageTooLong                = "message.tooLong"
+	CodeMessageVersionInvalid         = "message.version.invalid"
+	CodePalindromeModeInvalid         = "palindromeMode.invalid"
+	CodePalindromeModeStrictRequired  = "palindromeMode.strictRequired"
+	CodePatchJsonPatchFailed          = "patch.jsonPatch.failed"
+	CodePatchJsonPatchInvalid         = "patch.jsonPatch.invalid"
+	CodePatchMergePatchInvalid        = "patch.mergePatch.invalid"
+	CodePatchResultInvalid            = "patch.result.invalid"
+	CodeQueryCursorInvalid            = "query.cursor.invalid"
+	CodeQueryCursorSortMismatch       = "query.cursor.sortMismatch"
+	CodeQueryCursorsConflict          = "query.cursors.conflict"
+	CodeQueryFieldsInvalid            = "query.fields.invalid"
+	CodeQueryFilterInvalid            = "query.filter.invalid"
+	CodeQueryIncludeTotalInvalid      = "query.includeTotal.invalid"
+	CodeQueryPageSizeInvalid          = "query.pageSize.invalid"
+	CodeQueryPageStartIndexInvalid    = "query.pageStartIndex.invalid"
+	CodeQueryPageStartIndexCursor     = "query.pageStartIndex.withCursor"
+	CodeQuerySearchUnsupported        = "query.search.unsupported"
+	CodeQuerySortDuplicate            = "query.sort.duplicate"
+	CodeQuerySortFieldInvalid         = "query.sort.field.invalid"
+	CodeQuerySortInvalid              = "query.sort.invalid"
+	CodeRequestBodyTooLarge           = "request.body.tooLarge"
+	CodeRequestBodyUnreadable         = "request.body.unreadable"
+	CodeRequestContentTypeUnsupported = "request.contentType.unsupported"
+	CodeRequestJsonInvalid            = "request.json.invalid"
+	CodeSearchTextBlank               = "search.text.blank"
+	CodeUndoStepsInvalid              = "undo.steps.invalid"
+	CodeUndoStepsTooMany              = "undo.steps.tooMany"
+)
+
+// CodeInfo documents an error code. EType is the type of the errors the code is used for.
+type CodeInfo struct {
+	Code        string
+	EType       string
+	Description string
+}
+
+// The documentation of every error code.
+var catalog = []CodeInfo{
+	{CodeAnalyzerInvalid, ETInvalid, "The requested analyzer does not exist."},
+	{CodeDataConcurrentChange, ETConflict, "The change conflicts with a concurrent change, it can be retried."},
+	{CodeDataConflict, ETConflict, "The change conflicts with existing data (ex. a duplicate value)."},
+	{CodeDataInvalid, ETInvalid, "The data was rejected by a constraint of the database."},
+	{CodeFilterFieldInvalid, ETInvalid, "The field cannot be filtered by."},
+	{CodeFilterInvalid, ETInvalid, "The filter is not supported."},
+	{CodeFilterOperatorInvalid, ETInvalid, "The filter operator is not supported for the field."},
+	{CodeFilterValueInvalid, ETInvalid, "The filter value is not valid for the field (ex. not an integer)."},
+	{CodeHeaderIfMatchInvalid, ETInvalid, "The If-Match header is malformed."},
+	{CodeMessageBlank, ETInvalid, "The message text is empty."},
+	{CodeMessageIdInvalid, ETInvalid, "The message id of the URI is not an integer."},
+	{CodeMessageTooLong, ETInvalid, "The message text has more than the maximum number of characters."},
+	{CodeMessageVersionInvalid, ETInvalid, "The message version of the URI is not an integer."},
+	{CodePalindromeModeInvalid, ETInvalid, "The palindrome mode does not exist."},
+	{CodePalindromeModeStrictRequired, ETInvalid,
+		"isPalindrome can only be filtered and sorted by with the strict palindrome mode."},
+	{CodePatchJsonPatchFailed, ETInvalid, "The JSON Patch could not be applied to the message."},
+	{CodePatchJsonPatchInvalid, ETInvalid, "The body is not a valid JSON Patch."},
+	{CodePatchMergePatchInvalid, ETInvalid, "The body is not a valid JSON Merge Patch."},
+	{CodePatchResultInvalid, ETInvalid, "The patched message is not a valid message."},
+	{CodeQueryCursorInvalid, ETInvalid, "The after or before cursor is malformed or was not issued by the server."},
+	{CodeQueryCursorSortMismatch, ETInvalid, "The cursor was issued for a listing with a different sort order."},
+	{CodeQueryCursorsConflict, ETInvalid, "The after and before cursors cannot be used together."},
+	{CodeQueryFieldsInvalid, ETInvalid, "One or more of the requested fields do not exist."},
+	{CodeQueryFilterInvalid, ETInvalid, "The filter query parameter is malformed."},
+	{CodeQueryIncludeTotalInvalid, ETInvalid, "The includeTotal query parameter is not a boolean."},
+	{CodeQueryPageSizeInvalid, ETInvalid, "The pageSize query parameter is not a positive integer."},
+	{CodeQueryPageStartIndexInvalid, ETInvalid, "The pageStartIndex query parameter is not a positive integer."},
+	{CodeQueryPageStartIndexCursor, ETInvalid, "The pageStartIndex query parameter cannot be used with cursors."},
+	{CodeQuerySearchUnsupported, ETInvalid, "The query parameter is not supported when searching."},
+	{CodeQuerySortDuplicate, ETInvalid, "A field is included more than once in the sort order."},
+	{CodeQuerySortFieldInvalid, ETInvalid, "One or more of the sort fields cannot be sorted by."},
+	{CodeQuerySortInvalid, ETInvalid, "The sort query parameter is malformed."},
+	{CodeRequestBodyTooLarge, ETInvalid, "The request body is larger than allowed."},
+	{CodeRequestBodyUnreadable, ETInvalid, "The request body could not be read."},
+	{CodeRequestContentTypeUnsupported, ETUnsupportedMediaType,
+		"The format (Content-Type) of the request body is not supported by the operation."},
+	{CodeRequestJsonInvalid, ETInvalid, "The request body is not valid JSON (or has the wrong structure)."},
+	{CodeSearchTextBlank, ETInvalid, "The search text is blank."},
+	{CodeUndoStepsInvalid, ETInvalid, "The number of steps to undo is not a positive integer."},
+	{CodeUndoStepsTooMany, ETInvalid, "The message does not have as many previous versions as steps to undo."},
+}
+
+// Codes returns the documentation of every error code, ordered by code.
+func Codes() []CodeInfo {
+	codes := make([]CodeInfo, len(catalog))
+	copy(codes, catalog)
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// LookupCode returns the documentation of an error code. Found is false when the code is not in the catalog.
+func LookupCode(code string) (info CodeInfo, found bool) {
+	for _, c := range catalog {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return info, false
+}
@@ -0,0 +1,34 @@
+package apperrors
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodes_areUniqueAndDocumented(t *testing.T) {
+	seen := map[string]struct{}{}
+	for _, c := range Codes() {
+		_, found := seen[c.Code]
+		require.False(t, found, "duplicate code %s", c.Code)
+		seen[c.Code] = struct{}{}
+		require.NotEmpty(t, c.Description, c.Code)
+		require.Contains(t, problemDescriptions, c.EType, c.Code)
+	}
+}
+
+func TestCodes_areOrderedByCode(t *testing.T) {
+	codes := Codes()
+	require.True(t, sort.SliceIsSorted(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code }))
+}
+
+func TestLookupCode(t *testing.T) {
+	info, found := LookupCode(CodeQueryPageSizeInvalid)
+	require.True(t, found)
+	require.Equal(t, CodeQueryPageSizeInvalid, info.Code)
+	require.Equal(t, ETInvalid, info.EType)
+
+	_, found = LookupCode("not.a.code")
+	require.False(t, found)
+}
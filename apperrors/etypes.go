@@ -9,4 +9,31 @@ const (
 
 	// ETNotFound is returned when a resource could not be found with the given identifier.
 	ETNotFound = "not found"
+
+	// ETPreconditionFailed is returned when a conditional request (ex. If-Match) does not match the current state of the
+	// resource.
+	ETPreconditionFailed = "precondition failed"
+
+	// ETPreconditionRequired is returned when a request must be conditional (ex. include If-Match) but is not.
+	ETPreconditionRequired = "precondition required"
+
+	// ETConflict is returned when a request conflicts with the current state of a resource (ex. a concurrent change).
+	ETConflict = "conflict"
+
+	// ETUnauthorized is returned when a request is missing valid credentials.
+	ETUnauthorized = "unauthorized"
+
+	// ETForbidden is returned when the credentials of a request do not allow the operation.
+	ETForbidden = "forbidden"
+
+	// ETRateLimited is returned when too many requests were made, see Error.RetryAfter.
+	ETRateLimited = "rate limited"
+
+	// ETUnavailable is returned when a request cannot be served at the moment (ex. the database is down) but may
+	// succeed later, see Error.RetryAfter.
+	ETUnavailable = "unavailable"
+
+	// ETUnsupportedMediaType is returned when the body of a request is in a format (Content-Type) that is not
+	// supported.
+	ETUnsupportedMediaType = "unsupported media type"
 )
@@ -0,0 +1,106 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ProblemContentType is the media type of problem details responses, see Problem.
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypePrefix prefixes the EType of an error to form the type URI of its problem details, ex.
+	// urn:messageappdemo:problem:not-found.
+	ProblemTypePrefix = "urn:messageappdemo:problem:"
+)
+
+// Problem is an RFC 7807 problem details object (https://tools.ietf.org/html/rfc7807) describing an error to the end
+// user. Errors is an extension member holding the user responses of the error (ex. FieldErrorResponse values).
+type Problem struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title"`
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"`
+	Errors   []interface{} `json:"errors,omitempty"`
+}
+
+// The title and detail of the problem details of each error type.
+var problemDescriptions = map[string]struct{ title, detail string }{
+	ETInvalid: {
+		"Invalid request",
+		"The request is invalid, see errors for the details.",
+	},
+	ETInternal: {
+		"Internal error",
+		"An unexpected error occurred while processing the request.",
+	},
+	ETNotFound: {
+		"Not found",
+		"The requested resource does not exist.",
+	},
+	ETPreconditionFailed: {
+		"Precondition failed",
+		"The resource does not match the conditions of the request (ex. If-Match).",
+	},
+	ETPreconditionRequired: {
+		"Precondition required",
+		"The request must be conditional (ex. include an If-Match header).",
+	},
+	ETConflict: {
+		"Conflict",
+		"The request conflicts with the current state of the resource.",
+	},
+	ETUnauthorized: {
+		"Unauthorized",
+		"The request requires valid credentials.",
+	},
+	ETForbidden: {
+		"Forbidden",
+		"The credentials of the request do not allow the operation.",
+	},
+	ETRateLimited: {
+		"Too many requests",
+		"Too many requests were made, retry after the time given by the Retry-After header.",
+	},
+	ETUnavailable: {
+		"Service unavailable",
+		"The request cannot be served at the moment, retry later (see the Retry-After header when included).",
+	},
+	ETUnsupportedMediaType: {
+		"Unsupported media type",
+		"The format (Content-Type) of the request body is not supported.",
+	},
+}
+
+// ToProblem converts an error to its problem details. Instance identifies the occurrence of the problem, usually the
+// URI of the request. Only the user responses of errors with a response (see HasResponse) are included, internal and
+// non-application errors never include any details of the error itself.
+func ToProblem(err error, instance string) Problem {
+	etype := ETInternal
+	if e, ok := AsError(err); ok && !IsInternal(err) {
+		etype = e.EType
+	}
+
+	p := Problem{
+		Type:     ProblemTypePrefix + strings.ReplaceAll(etype, " ", "-"),
+		Status:   StatusCode(err),
+		Instance: instance,
+	}
+	if d, found := problemDescriptions[etype]; found {
+		p.Title = d.title
+		p.Detail = d.detail
+	} else {
+		p.Title = http.StatusText(p.Status)
+	}
+	if e, ok := AsError(err); ok && HasResponse(err) {
+		p.Errors = e.Responses
+	}
+	return p
+}
+
+// ToProblemJSON encodes the problem details of an error to JSON, see ToProblem.
+func ToProblemJSON(err error, instance string) ([]byte, error) {
+	return json.Marshal(ToProblem(err, instance))
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/mdev5000/messageappdemo/logging"
 	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/postgres"
+	"github.com/mdev5000/messageappdemo/sqlite"
+	"github.com/mdev5000/messageappdemo/sqlitedata"
 )
 
 type Services struct {
@@ -14,7 +16,17 @@ type Services struct {
 }
 
 func Setup(db *postgres.DB, log *logging.Logger) *Services {
-	messagesRepo := data.NewMessageRepository(db)
+	return SetupWithRepo(data.NewMessageRepository(db), log)
+}
+
+// SetupSqlite is the same as Setup, but stores data in a SQLite database.
+func SetupSqlite(db *sqlite.DB, log *logging.Logger) *Services {
+	return SetupWithRepo(sqlitedata.NewMessageRepository(db), log)
+}
+
+// SetupWithRepo is the same as Setup, but uses the given messages repository rather than the database (ex. the
+// in-memory repository from the memdata package).
+func SetupWithRepo(messagesRepo messages.Repository, log *logging.Logger) *Services {
 	services := Services{
 		Log:             log,
 		MessagesService: messages.NewService(log, messagesRepo),
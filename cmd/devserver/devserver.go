@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"github.com/mdev5000/messageappdemo/approot"
 	"github.com/mdev5000/messageappdemo/data"
 	"github.com/mdev5000/messageappdemo/logging"
+	"github.com/mdev5000/messageappdemo/memdata"
 	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/postgres"
 	"github.com/mdev5000/messageappdemo/server"
@@ -21,28 +23,40 @@ func main() {
 
 func run() error {
 	var noseed bool
+	var memory bool
 	flag.BoolVar(&noseed, "noseed", false, "When true will not purge and re-seed the database.")
+	flag.BoolVar(&memory, "memory", false,
+		"When true messages are stored in memory, so Postgres is not required. Data is lost on exit.")
 	flag.Parse()
 
-	db, err := postgres.OpenDev("postgres", "postgres", "postgres")
-	if err != nil {
-		return err
-	}
+	log := logging.New()
 
-	// Setup the database schema.
-	if _, err := db.Exec(data.Schema); err != nil {
-		return err
-	}
+	var services *approot.Services
+	if memory {
+		services = approot.SetupWithRepo(memdata.NewMessageRepository(), log)
+	} else {
+		db, err := postgres.OpenDev("postgres", "postgres", "postgres")
+		if err != nil {
+			return err
+		}
 
-	log := logging.New()
-	services := approot.Setup(db, log)
+		// Setup the database schema.
+		if err := data.SetupSchema(db); err != nil {
+			return err
+		}
+
+		services = approot.Setup(db, log)
+
+		if !noseed {
+			fmt.Println("Delete existing data...")
+			if err := data.PurgeDb(db); err != nil {
+				return err
+			}
+		}
+	}
 
 	// Seed the database with dev data.
 	if !noseed {
-		fmt.Println("Delete existing data...")
-		if err := data.PurgeDb(db); err != nil {
-			return err
-		}
 		fmt.Println("Seeding database with dev data...")
 		if err := seed(services.MessagesService); err != nil {
 			return err
@@ -65,7 +79,7 @@ func run() error {
 
 func seed(msgService *messages.Service) error {
 	for i := 0; i < 100; i++ {
-		if _, err := msgService.Create(messages.ModifyMessage{
+		if _, err := msgService.Create(context.Background(), messages.ModifyMessage{
 			Message: fmt.Sprintf("message %d", i),
 		}); err != nil {
 			return err
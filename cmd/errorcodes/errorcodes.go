@@ -0,0 +1,187 @@
+// Command errorcodes generates the ErrorCode schema of the OpenAPI spec from the error code catalog of apperrors (see
+// apperrors.Codes), so the documented codes are always the codes returned by the API.
+//
+// Usage:
+//
+//	go run ./cmd/errorcodes [-spec _openapi/messages.json]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+)
+
+// The name of the generated schema in components.schemas.
+const schemaName = "ErrorCode"
+
+func main() {
+	var spec string
+	flag.StringVar(&spec, "spec", "_openapi/messages.json", "The OpenAPI spec file to update.")
+	flag.Parse()
+
+	if err := run(spec); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(spec string) error {
+	in, err := ioutil.ReadFile(spec)
+	if err != nil {
+		return err
+	}
+	out, err := generate(in)
+	if err != nil {
+		return fmt.Errorf("failed to generate %s: %w", spec, err)
+	}
+	return ioutil.WriteFile(spec, out, 0644)
+}
+
+type errorCodeSchema struct {
+	Description string                `json:"description"`
+	Type        string                `json:"type"`
+	Enum        []string              `json:"enum"`
+	Codes       []errorCodeSchemaCode `json:"x-error-codes"`
+}
+
+type errorCodeSchemaCode struct {
+	Code        string `json:"code"`
+	EType       string `json:"etype"`
+	Description string `json:"description"`
+}
+
+// Returns the spec with the ErrorCode schema replaced by the current catalog. The order of the rest of the spec is
+// preserved.
+func generate(spec []byte) ([]byte, error) {
+	schema := errorCodeSchema{
+		Description: "A stable code identifying the error, see x-error-codes for the description of each code. " +
+			"Generated from the apperrors catalog by `make docs.api.errorcodes`, do not edit.",
+		Type: "string",
+	}
+	for _, c := range apperrors.Codes() {
+		schema.Enum = append(schema.Enum, c.Code)
+		schema.Codes = append(schema.Codes, errorCodeSchemaCode{Code: c.Code, EType: c.EType, Description: c.Description})
+	}
+
+	var root, components, schemas orderedObject
+	if err := json.Unmarshal(spec, &root); err != nil {
+		return nil, err
+	}
+	if err := root.get("components", &components); err != nil {
+		return nil, err
+	}
+	if err := components.get("schemas", &schemas); err != nil {
+		return nil, err
+	}
+	if err := schemas.set(schemaName, schema); err != nil {
+		return nil, err
+	}
+	if err := components.set("schemas", schemas); err != nil {
+		return nil, err
+	}
+	if err := root.set("components", components); err != nil {
+		return nil, err
+	}
+
+	compact, err := marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// Marshals v without escaping HTML characters, the same as the spec is written by hand.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// A JSON object that keeps the order of its members, so the spec can be rewritten without reordering it.
+type orderedObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (o *orderedObject) get(key string, v interface{}) error {
+	raw, found := o.values[key]
+	if !found {
+		return fmt.Errorf("member %s not found", key)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Sets the value of a member, new members are added last.
+func (o *orderedObject) set(key string, v interface{}) error {
+	raw, err := marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, found := o.values[key]; !found {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = raw
+	return nil
+}
+
+func (o *orderedObject) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object")
+	}
+	o.keys = nil
+	o.values = map[string]json.RawMessage{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := t.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if _, found := o.values[key]; !found {
+			o.keys = append(o.keys, key)
+		}
+		o.values[key] = raw
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_specIsUpToDate(t *testing.T) {
+	spec, err := ioutil.ReadFile("../../_openapi/messages.json")
+	require.NoError(t, err)
+	generated, err := generate(spec)
+	require.NoError(t, err)
+	require.Equal(t, string(spec), string(generated), "run make docs.api.errorcodes to update the spec")
+}
+
+func TestGenerate_preservesMemberOrder(t *testing.T) {
+	spec := `{"b":1,"components":{"z":true,"schemas":{"Z":{},"A":{"x":"<&>"}}},"a":[]}`
+	generated, err := generate([]byte(spec))
+	require.NoError(t, err)
+
+	var root, components, schemas orderedObject
+	require.NoError(t, root.UnmarshalJSON(generated))
+	require.Equal(t, []string{"b", "components", "a"}, root.keys)
+	require.NoError(t, root.get("components", &components))
+	require.Equal(t, []string{"z", "schemas"}, components.keys)
+	require.NoError(t, components.get("schemas", &schemas))
+	require.Equal(t, []string{"Z", "A", "ErrorCode"}, schemas.keys)
+	require.Contains(t, string(generated), `"x": "<&>"`)
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/mdev5000/messageappdemo/approot"
 	"github.com/mdev5000/messageappdemo/data"
 	"github.com/mdev5000/messageappdemo/logging"
+	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/postgres"
 	"github.com/mdev5000/messageappdemo/server"
+	"github.com/mdev5000/messageappdemo/sqlite"
+	"github.com/mdev5000/messageappdemo/sqlitedata"
 	"net/http"
 	"os"
+	"strconv"
+	"text/tabwriter"
 	"time"
 )
 
@@ -21,9 +27,7 @@ func main() {
 }
 
 func run() error {
-	var migrate bool
 	var tls bool
-	flag.BoolVar(&migrate, "migrate", false, "When set, migrations will be run prior to starting the application.")
 	flag.BoolVar(&tls, "tls", false, "When set, if the CERT and KEY environment variables are empty server will panic. This ensure the serve cannot be run in non-TLS mode.")
 
 	flag.Usage = func() {
@@ -31,14 +35,28 @@ func run() error {
 		fmt.Println("")
 		fmt.Println("  REST API server that manages messages.")
 		fmt.Println("")
+		fmt.Println("Usage:")
+		fmt.Println("")
+		fmt.Println("  messageappdemo [flags]                Run the server.")
+		fmt.Println("  messageappdemo [flags] purge          Permanently remove messages in the trash older than TRASH_RETENTION.")
+		fmt.Println("  messageappdemo [flags] migrate up     Apply all pending migrations.")
+		fmt.Println("  messageappdemo [flags] migrate down   Revert the last applied migration.")
+		fmt.Println("  messageappdemo [flags] migrate to N   Apply or revert migrations until the schema is at version N.")
+		fmt.Println("  messageappdemo [flags] migrate status List migrations and whether they have been applied.")
+		fmt.Println("")
 		fmt.Println("Flags:")
 		fmt.Println("")
 		flag.PrintDefaults()
 		fmt.Println("")
 		fmt.Println("Environment variables:")
 		fmt.Println("")
-		fmt.Println("  DATABASE_URL       The url to the database. [required]")
-		fmt.Println("  MIGRATE            When set to 1, migrations will be run prior to starting the application.")
+		fmt.Println("  DATABASE_URL       The url to the database, either PostgreSQL or SQLite (ex. sqlite:///data/messages.db). [required]")
+		fmt.Println("  MIGRATE            When set to 1, pending migrations will be applied prior to starting the application.")
+		fmt.Println("  REQUIRE_IF_MATCH   When set to 1, updates and deletes must include an If-Match header.")
+		fmt.Println("  CURSOR_SECRET      Secret used to sign page cursors. When empty, cursors are invalidated on restart.")
+		fmt.Println("  PALINDROME_MODE    Default palindrome rule: strict (default), graphemes or loose.")
+		fmt.Println("  TRASH_RETENTION    How long deleted messages are kept in the trash (ex. 72h), defaults to 720h.")
+		fmt.Println("  PURGE_INTERVAL     When set (ex. 1h), the trash is periodically purged while the server runs.")
 		fmt.Println("  CERT            	  TLS certificate file to use.")
 		fmt.Println("  KEY            	  TLS key file to use.")
 		fmt.Println("")
@@ -53,6 +71,31 @@ func run() error {
 		return errors.New("environment variable DATABASE_URL cannot be empty")
 	}
 
+	retention, err := durationEnv("TRASH_RETENTION", defaultTrashRetention)
+	if err != nil {
+		return err
+	}
+
+	purgeInterval, err := durationEnv("PURGE_INTERVAL", 0)
+	if err != nil {
+		return err
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "purge":
+		services, err := setup(log, dbUrl, false)
+		if err != nil {
+			return err
+		}
+		return purge(services.MessagesService, retention)
+	case "migrate":
+		return migrateCommand(log, dbUrl, flag.Args()[1:])
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %s", flag.Arg(0))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Error("PORT was empty.")
@@ -71,33 +114,23 @@ func run() error {
 		return fmt.Errorf("KEY environment variable cannot be empty")
 	}
 
-	migrateEnv := os.Getenv("MIGRATE")
-	if migrateEnv == "1" {
-		migrate = true
-	}
-
-	db, err := connectDb(log, dbUrl)
+	services, err := setup(log, dbUrl, os.Getenv("MIGRATE") == "1")
 	if err != nil {
 		return err
 	}
 
-	// Setup the database schema.
-	if migrate {
-		fmt.Println("Running migrations...")
-		if _, err := db.Exec(data.Schema); err != nil {
-			log.Errorf("Faied to open db connection: %s", err)
-			return err
-		}
-		fmt.Println("Migrations run.")
+	if purgeInterval > 0 {
+		go purgeJob(log, services.MessagesService, purgeInterval, retention)
 	}
 
-	services := approot.Setup(db, log)
-
 	handler, err := server.Handler(server.Services{
 		Log:             services.Log,
 		MessagesService: services.MessagesService,
 	}, server.Config{
-		LogRequest: true,
+		LogRequest:           true,
+		RequirePreconditions: os.Getenv("REQUIRE_IF_MATCH") == "1",
+		CursorSecret:         []byte(os.Getenv("CURSOR_SECRET")),
+		PalindromeMode:       os.Getenv("PALINDROME_MODE"),
 	})
 	if err != nil {
 		return err
@@ -120,6 +153,150 @@ func run() error {
 	}
 }
 
+// Connects to the database referred to by dbUrl and sets up the application services. Urls with the sqlite:// scheme
+// use a SQLite database, otherwise a PostgreSQL database is used. When migrate is true the database schema is set up.
+func setup(log *logging.Logger, dbUrl string, migrate bool) (*approot.Services, error) {
+	if sqlite.IsUrl(dbUrl) {
+		db, err := sqlite.OpenUrl(dbUrl)
+		if err != nil {
+			return nil, err
+		}
+		if migrate {
+			fmt.Println("Running migrations...")
+			if err := sqlitedata.SetupSchema(db); err != nil {
+				log.Errorf("Failed to setup the database schema: %s", err)
+				return nil, err
+			}
+			fmt.Println("Migrations run.")
+		}
+		return approot.SetupSqlite(db, log), nil
+	}
+
+	db, err := connectDb(log, dbUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup the database schema.
+	if migrate {
+		fmt.Println("Running migrations...")
+		if err := data.SetupSchema(db); err != nil {
+			log.Errorf("Failed to run migrations: %s", err)
+			return nil, err
+		}
+		fmt.Println("Migrations run.")
+	}
+	return approot.Setup(db, log), nil
+}
+
+// Runs the migrate command, args are the arguments following migrate (ex. to 3).
+func migrateCommand(log *logging.Logger, dbUrl string, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return errors.New("migrate requires one of the commands up, down, to or status")
+	}
+
+	var migrator *data.Migrator
+	if sqlite.IsUrl(dbUrl) {
+		db, err := sqlite.OpenUrl(dbUrl)
+		if err != nil {
+			return err
+		}
+		migrator = sqlitedata.NewMigrator(db)
+	} else {
+		db, err := connectDb(log, dbUrl)
+		if err != nil {
+			return err
+		}
+		migrator = data.NewMigrator(db)
+	}
+
+	var err error
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down()
+	case "to":
+		if len(args) < 2 {
+			return errors.New("migrate to requires the version to migrate to")
+		}
+		version, errConv := strconv.Atoi(args[1])
+		if errConv != nil {
+			return fmt.Errorf("invalid migration version %s", args[1])
+		}
+		err = migrator.To(version)
+	case "status":
+		return printMigrationStatus(migrator)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown migrate command %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database schema is at version %d.\n", version)
+	return nil
+}
+
+func printMigrationStatus(migrator *data.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+func durationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %s must be a duration (ex. 72h): %w", name, err)
+	}
+	return d, nil
+}
+
+func purge(svc *messages.Service, retention time.Duration) error {
+	purged, err := svc.PurgeDeleted(context.Background(), retention)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d messages from the trash.\n", purged)
+	return nil
+}
+
+// Periodically purges the trash until the application exits.
+func purgeJob(log *logging.Logger, svc *messages.Service, interval, retention time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := svc.PurgeDeleted(context.Background(), retention)
+		if err != nil {
+			log.LogError(err)
+			continue
+		}
+		log.Infof("Purged %d messages from the trash.", purged)
+	}
+}
+
 func connectDb(log *logging.Logger, dbUrl string) (db *postgres.DB, err error) {
 	var i time.Duration
 	for i = 1; i < 10; i++ {
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Dialect describes how the SQL of a database differs, which allows the repositories and the Migrator to be shared by
+// the databases the application supports. Queries are written for PostgreSQL, but with ? placeholders.
+type Dialect struct {
+	// Name of the messages repository, used in the operation of its errors.
+	Name string
+	// Placeholder replaces the ? placeholders of queries.
+	Placeholder sq.PlaceholderFormat
+	// Timestamp converts a time into the value of a timestamp parameter. Timestamps are stored in UTC, so the value
+	// must not depend on the time zone of the time or the database session.
+	Timestamp func(t time.Time) interface{}
+	// TimestampParam is the placeholder of timestamp parameters, ex. to cast them into the type of timestamp columns.
+	TimestampParam string
+	// Strpos is the function returning the position of a substring within a string (starting from 1).
+	Strpos string
+	// OffsetRequiresLimit indicates the database only supports an offset as part of a limit clause.
+	OffsetRequiresLimit bool
+	// FullTextSearch indicates the messages have a full-text index (see the "add messages full text index" migration).
+	// Without one, messages are searched by substring.
+	FullTextSearch bool
+	// MigrationLock and MigrationUnlock acquire and release the lock held while migrating, so multiple instances of the
+	// application starting at the same time do not race to apply the same migrations. No lock is held when empty.
+	MigrationLock   string
+	MigrationUnlock string
+}
+
+// Key of the advisory lock held while migrating a PostgreSQL database.
+const migrationLockKey = 7231690413
+
+// Layout of timestamp parameters of PostgreSQL databases. The timestamp columns have no time zone, so parameters are
+// passed as UTC text cast to timestamp. Otherwise lib/pq sends the time with its offset, which is converted using the
+// time zone of the session.
+const pgTimestampLayout = "2006-01-02 15:04:05.999999"
+
+// Postgres is the dialect of PostgreSQL databases.
+var Postgres = Dialect{
+	Name:        "MessagesRepository",
+	Placeholder: sq.Dollar,
+	Timestamp: func(t time.Time) interface{} {
+		return t.UTC().Format(pgTimestampLayout)
+	},
+	TimestampParam:  "?::timestamp",
+	Strpos:          "strpos",
+	FullTextSearch:  true,
+	MigrationLock:   fmt.Sprintf("select pg_advisory_lock(%d)", migrationLockKey),
+	MigrationUnlock: fmt.Sprintf("select pg_advisory_unlock(%d)", migrationLockKey),
+}
+
+// Replaces the ? placeholders of a query with those of the database.
+func (d Dialect) bind(query string) string {
+	bound, err := d.Placeholder.ReplacePlaceholders(query)
+	if err != nil {
+		panic(fmt.Errorf("failed to replace placeholders: %w", err))
+	}
+	return bound
+}
+
+// Timestamp parameter for a time.
+func (d Dialect) timestamp(t time.Time) sq.Sqlizer {
+	return sq.Expr(d.TimestampParam, d.Timestamp(t))
+}
+
+// Condition comparing a column to a field value with the operator op (ex. <).
+func (d Dialect) compare(col, op string, v interface{}) sq.Sqlizer {
+	if t, ok := v.(time.Time); ok {
+		return sq.Expr(col+" "+op+" "+d.TimestampParam, d.Timestamp(t))
+	}
+	return sq.Expr(col+" "+op+" ?", v)
+}
@@ -1,6 +1,12 @@
 package data
 
 import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
 	"github.com/mdev5000/messageappdemo/apperrors"
 	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/pkg/errors"
@@ -10,15 +16,94 @@ func idMissingError(op string, id int64) error {
 	return messages.IdMissingError{Op: op, Id: id}
 }
 
-func repoError2(op string, err error) error {
-	return repoError(op, err, err)
+func versionMismatchError(op string, id int64, expected, actual int) error {
+	return messages.VersionMismatchError{Op: op, Id: id, Expected: expected, Actual: actual}
+}
+
+func versionMissingError(op string, id int64, version int) error {
+	return messages.VersionMissingError{Op: op, Id: id, Version: version}
+}
+
+func repoError2(ctx context.Context, op string, err error) error {
+	return repoError(ctx, op, err, err)
 }
 
-func repoError(op string, err, errOrig error) error {
-	return &apperrors.Error{
+func repoError(ctx context.Context, op string, err, errOrig error) error {
+	appErr := &apperrors.Error{
 		EType: apperrors.ETInternal,
 		Op:    op,
 		Err:   err,
 		Stack: errors.WithStack(errOrig),
 	}
+	translateDbError(ctx, appErr, errOrig)
+	return appErr
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	pqUniqueViolation      = "23505"
+	pqCheckViolation       = "23514"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+	pqQueryCanceled        = "57014"
+	pqLockNotAvailable     = "55P03"
+	pqAdminShutdown        = "57P01"
+	pqCrashShutdown        = "57P02"
+	pqCannotConnectNow     = "57P03"
+
+	// The class of every connection exception error code (ex. 08006 connection failure).
+	pqClassConnectionException = "08"
+)
+
+// How long users are asked to wait before retrying when the database is unavailable.
+const unavailableRetryAfter = 5 * time.Second
+
+// Sets the type of an application error from the database error that caused it, so failures the user can act on are
+// not reported as internal errors:
+//
+//   - unique violations are conflicts
+//   - check violations are invalid data
+//   - serialization failures and deadlocks are conflicts with a concurrent transaction, which can be retried
+//   - connection losses, shutdowns, statement and lock timeouts and expired contexts mean the database is unavailable,
+//     which can be retried
+//
+// Every other error is left as is. Notably a canceled context means the client went away rather than the database
+// being unavailable. The database reports a query canceled because of the context of the operation (ctx) the same as
+// one canceled by the statement timeout, so a canceled query is only unavailable when ctx is not done.
+func translateDbError(ctx context.Context, appErr *apperrors.Error, err error) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == pqUniqueViolation:
+			appErr.EType = apperrors.ETConflict
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeDataConflict,
+				"the change conflicts with existing data"))
+		case pqErr.Code == pqCheckViolation:
+			appErr.EType = apperrors.ETInvalid
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeDataInvalid, "the data is invalid"))
+		case pqErr.Code == pqSerializationFailure, pqErr.Code == pqDeadlockDetected:
+			appErr.EType = apperrors.ETConflict
+			appErr.Retryable = true
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeDataConcurrentChange,
+				"the change conflicts with a concurrent change, retry the request"))
+		case pqErr.Code.Class() == pqClassConnectionException, pqErr.Code == pqAdminShutdown,
+			pqErr.Code == pqCrashShutdown, pqErr.Code == pqCannotConnectNow, pqErr.Code == pqLockNotAvailable:
+			unavailable(appErr)
+		case pqErr.Code == pqQueryCanceled && ctx.Err() == nil:
+			unavailable(appErr)
+		}
+		return
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		unavailable(appErr)
+	}
+}
+
+func unavailable(appErr *apperrors.Error) {
+	appErr.EType = apperrors.ETUnavailable
+	appErr.Retryable = true
+	appErr.RetryAfter = unavailableRetryAfter
 }
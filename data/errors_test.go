@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateDbError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		etype     string
+		retryable bool
+		code      string
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, apperrors.ETConflict, false, apperrors.CodeDataConflict},
+		{"check violation", &pq.Error{Code: "23514"}, apperrors.ETInvalid, false, apperrors.CodeDataInvalid},
+		{"serialization failure", &pq.Error{Code: "40001"}, apperrors.ETConflict, true,
+			apperrors.CodeDataConcurrentChange},
+		{"deadlock", &pq.Error{Code: "40P01"}, apperrors.ETConflict, true, apperrors.CodeDataConcurrentChange},
+		{"connection failure", &pq.Error{Code: "08006"}, apperrors.ETUnavailable, true, ""},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, apperrors.ETUnavailable, true, ""},
+		{"statement timeout", &pq.Error{Code: "57014"}, apperrors.ETUnavailable, true, ""},
+		{"lock timeout", &pq.Error{Code: "55P03"}, apperrors.ETUnavailable, true, ""},
+		{"bad connection", driver.ErrBadConn, apperrors.ETUnavailable, true, ""},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, apperrors.ETUnavailable,
+			true, ""},
+		{"context deadline", context.DeadlineExceeded, apperrors.ETUnavailable, true, ""},
+		{"context canceled", context.Canceled, apperrors.ETInternal, false, ""},
+		{"other pq error", &pq.Error{Code: "42P01"}, apperrors.ETInternal, false, ""},
+		{"other error", errors.New("other"), apperrors.ETInternal, false, ""},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			appErr := &apperrors.Error{EType: apperrors.ETInternal, Op: "op", Err: fmt.Errorf("failed: %w", c.err)}
+			translateDbError(context.Background(), appErr, fmt.Errorf("wrapped: %w", c.err))
+			require.Equal(t, c.etype, appErr.EType)
+			require.Equal(t, c.retryable, apperrors.IsRetryable(appErr))
+			if c.code == "" {
+				require.Empty(t, appErr.Responses)
+			} else {
+				require.Len(t, appErr.Responses, 1)
+				require.Equal(t, c.code, appErr.Responses[0].(apperrors.ErrResponse).Code)
+			}
+			retryAfter, ok := apperrors.RetryAfter(appErr)
+			if c.etype == apperrors.ETUnavailable {
+				require.True(t, ok)
+				require.Equal(t, unavailableRetryAfter, retryAfter)
+			} else {
+				require.False(t, ok)
+			}
+		})
+	}
+}
+
+// A query canceled because the context of the operation was canceled means the client went away, whatever the message
+// of the error is.
+func TestTranslateDbError_queryCanceledWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pqErr := &pq.Error{Code: "57014", Message: "annulation de la requête à la demande de l'utilisateur"}
+	appErr := &apperrors.Error{EType: apperrors.ETInternal, Op: "op", Err: pqErr}
+	translateDbError(ctx, appErr, pqErr)
+	require.Equal(t, apperrors.ETInternal, appErr.EType)
+	require.False(t, apperrors.IsRetryable(appErr))
+}
+
+func TestRepoError_keepsDomainErrors(t *testing.T) {
+	err := repoError2(context.Background(), "op", idMissingError("op", 1))
+	require.True(t, errors.Is(err, messages.IdMissingError{}))
+	appErr, ok := apperrors.AsError(err)
+	require.True(t, ok)
+	require.Equal(t, apperrors.ETInternal, appErr.EType)
+}
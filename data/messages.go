@@ -1,13 +1,16 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
 	"github.com/mdev5000/messageappdemo/apperrors"
 	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/postgres"
@@ -18,98 +21,467 @@ type MessageId = messages.MessageId
 type MessageVersion = messages.MessageVersion
 type Message = messages.Message
 type CreateMessage = messages.CreateMessage
-type ModifyMessage = messages.ModifyMessage
+type UpdateMessage = messages.UpdateMessage
 type MessageQuery = messages.MessageQuery
 
 // MessagesRepository is the repository implementation for the messages.Repository interface.
 type MessagesRepository struct {
-	db *postgres.DB
+	db      *sqlx.DB
+	dialect Dialect
 }
 
 func NewMessageRepository(db *postgres.DB) *MessagesRepository {
-	return &MessagesRepository{db: db}
+	return NewDialectMessageRepository(db, Postgres)
 }
 
-const repoName = "MessagesRepository"
+// NewDialectMessageRepository creates a repository for a database of the given dialect. The schema of the database must
+// be equivalent to the one created by Migrations.
+func NewDialectMessageRepository(db *sqlx.DB, dialect Dialect) *MessagesRepository {
+	return &MessagesRepository{db: db, dialect: dialect}
+}
 
 // Map of fields the user is allowed to query in format {field: table_col}
 var queryableFields = map[string]string{
-	messages.FieldId:        "id",
-	messages.FieldVersion:   "version",
-	messages.FieldCreatedAt: "created_at",
-	messages.FieldUpdatedAt: "updated_at",
-	messages.FieldMessage:   "message",
+	messages.FieldId:           "id",
+	messages.FieldVersion:      "version",
+	messages.FieldCreatedAt:    "created_at",
+	messages.FieldUpdatedAt:    "updated_at",
+	messages.FieldMessage:      "message",
+	messages.FieldIsPalindrome: "is_palindrome",
 }
 
-func (mr *MessagesRepository) DeleteById(id MessageId) error {
-	const op = repoName + ".DeleteById"
-	r, err := mr.db.Exec(`delete from messages where id = $1`, id)
+// Condition excluding messages in the trash.
+const notDeleted = "deleted_at is null"
+
+// DeleteById marks a message as deleted. Deleted messages (and their versions) are kept in the trash until they are
+// permanently removed by PurgeDeleted.
+func (mr *MessagesRepository) DeleteById(ctx context.Context, id MessageId, version MessageVersion) error {
+	op := mr.dialect.Name + ".DeleteById"
+
+	q := sq.Update("messages").
+		PlaceholderFormat(mr.dialect.Placeholder).
+		Set("deleted_at", mr.dialect.timestamp(nowUTC())).
+		Where(sq.Eq{"id": id}).
+		Where(notDeleted)
+	if version != messages.AnyVersion {
+		q = q.Where(sq.Eq{"version": version})
+	}
+
+	sqlS, args, err := q.ToSql()
 	if err != nil {
-		return repoError(op, fmt.Errorf("failed to delete message with id %d: \n%w", id, err), err)
+		return repoError(ctx, op, fmt.Errorf("failed to generate delete query: %w", err), err)
+	}
+
+	r, err := mr.db.ExecContext(ctx, sqlS, args...)
+	if err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to delete message with id %d: \n%w", id, err), err)
 	}
 	affected, err := r.RowsAffected()
 	if err != nil {
-		return err
+		return repoError(ctx, op, fmt.Errorf("failed to get the rows deleted for message with id %d: %w", id, err), err)
 	}
 	if affected != 1 {
-		return repoError2(op, idMissingError(op, id))
+		return mr.versionError(ctx, op, mr.db, id, version)
 	}
 	return nil
 }
 
+// UndeleteById restores a deleted message from the trash and returns its current version.
+func (mr *MessagesRepository) UndeleteById(ctx context.Context, id MessageId) (MessageVersion, error) {
+	op := mr.dialect.Name + ".UndeleteById"
+	var version MessageVersion
+	err := mr.db.GetContext(ctx, &version, mr.dialect.bind(
+		`update messages set deleted_at = null where id = ? and deleted_at is not null returning version`), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, repoError2(ctx, op, idMissingError(op, id))
+		}
+		return 0, repoError(ctx, op, fmt.Errorf("failed to undelete message with id %d: %w", id, err), err)
+	}
+	return version, nil
+}
+
+// PurgeDeleted permanently removes messages (and their versions) that were deleted before the given time. Returns the
+// number of messages removed.
+func (mr *MessagesRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	op := mr.dialect.Name + ".PurgeDeleted"
+	var purged int64
+	ts, beforeTs := mr.dialect.TimestampParam, mr.dialect.Timestamp(before)
+	err := mr.inTx(ctx, op, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, mr.dialect.bind(`
+delete from message_versions
+where message_id in (select id from messages where deleted_at < `+ts+`)`), beforeTs); err != nil {
+			return repoError(ctx, op, fmt.Errorf("failed to purge message versions: %w", err), err)
+		}
+		r, err := tx.ExecContext(ctx, mr.dialect.bind(`delete from messages where deleted_at < `+ts), beforeTs)
+		if err != nil {
+			return repoError(ctx, op, fmt.Errorf("failed to purge messages: %w", err), err)
+		}
+		if purged, err = r.RowsAffected(); err != nil {
+			return repoError(ctx, op, fmt.Errorf("failed to get the number of messages purged: %w", err), err)
+		}
+		return nil
+	})
+	return purged, err
+}
+
 // Create creates a new message. Note that CreatedAt should be in the UTC-0 timezone.
-func (mr *MessagesRepository) Create(cm CreateMessage) (MessageId, error) {
-	const op = repoName + ".Create"
-	rows, err := mr.db.Query(
-		`
-insert into messages (version, created_at, updated_at, message)
-values (1, $1, $1, $2) returning id
-`, cm.CreatedAt, cm.Message)
+func (mr *MessagesRepository) Create(ctx context.Context, cm CreateMessage) (MessageId, error) {
+	op := mr.dialect.Name + ".Create"
+	var id MessageId
+	err := mr.inTx(ctx, op, func(tx *sqlx.Tx) error {
+		ts, createdAt := mr.dialect.TimestampParam, mr.dialect.Timestamp(cm.CreatedAt)
+		row := tx.QueryRowContext(ctx, mr.dialect.bind(`
+insert into messages (version, created_at, updated_at, message, is_palindrome)
+values (1, `+ts+`, `+ts+`, ?, ?) returning id
+`), createdAt, createdAt, cm.Message, cm.IsPalindrome)
+		if err := row.Scan(&id); err != nil {
+			return repoError(ctx, op, fmt.Errorf("failed to create message: %w", err), err)
+		}
+		return mr.insertVersion(ctx, op, tx, id)
+	})
+	return id, err
+}
+
+func (mr *MessagesRepository) GetAll(ctx context.Context, messages *[]*Message) error {
+	op := mr.dialect.Name + ".GetAll"
+	if err := mr.db.SelectContext(ctx, messages,
+		`select id, version, created_at, updated_at, message, is_palindrome from messages
+where deleted_at is null`); err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to get messages: %w", err), err)
+	}
+	return nil
+}
+
+// GetAllQuery retrieves the messages matching the query, see messages.MessageQuery.
+func (mr *MessagesRepository) GetAllQuery(ctx context.Context, query MessageQuery, messages *[]*Message) error {
+	op := mr.dialect.Name + ".GetAllQuery"
+	_, err := mr.getQuery(ctx, op, query, false, false, messages)
+	return err
+}
+
+// GetAllQueryTotal is the same as GetAllQuery, but also returns the number of messages matching the filter of the query
+// regardless of the pagination settings.
+func (mr *MessagesRepository) GetAllQueryTotal(
+	ctx context.Context, query MessageQuery, messages *[]*Message,
+) (int64, error) {
+	op := mr.dialect.Name + ".GetAllQueryTotal"
+	return mr.getQuery(ctx, op, query, false, true, messages)
+}
+
+// GetDeletedQuery is the same as GetAllQuery, but for messages in the trash. The DeletedAt field is always retrieved.
+func (mr *MessagesRepository) GetDeletedQuery(ctx context.Context, query MessageQuery, messages *[]*Message) error {
+	op := mr.dialect.Name + ".GetDeletedQuery"
+	_, err := mr.getQuery(ctx, op, query, true, false, messages)
+	return err
+}
+
+// GetDeletedQueryTotal is the same as GetAllQueryTotal, but for messages in the trash.
+func (mr *MessagesRepository) GetDeletedQueryTotal(
+	ctx context.Context, query MessageQuery, messages *[]*Message,
+) (int64, error) {
+	op := mr.dialect.Name + ".GetDeletedQueryTotal"
+	return mr.getQuery(ctx, op, query, true, true, messages)
+}
+
+// A message along with the total number of messages matching a query.
+type messageWithTotal struct {
+	Message
+	TotalCount int64 `db:"total_count"`
+}
+
+// Runs a listing query against the messages either in or out of the trash. When withTotal is true the number of
+// messages matching the filter of the query is counted as part of the same query. The count is only run separately
+// when the page is empty, but there may be messages on other pages.
+func (mr *MessagesRepository) getQuery(
+	ctx context.Context, op string, query MessageQuery, deleted, withTotal bool, messages *[]*Message,
+) (int64, error) {
+	q, err := mr.selectQuery(ctx, op, query)
 	if err != nil {
-		return 0, repoError(op, fmt.Errorf("failed to create message: %w", err), err)
+		return 0, err
 	}
+	cond := notDeleted
+	if deleted {
+		cond = "deleted_at is not null"
+		q = q.Column("deleted_at")
+	}
+	q = q.Where(cond)
 
-	if !rows.Next() {
-		return 0, repoError2(op, fmt.Errorf("create message expected 1 row returned by was 0"))
+	var total int64
+	if withTotal {
+		count, err := mr.countQuery(ctx, op, query, cond)
+		if err != nil {
+			return 0, err
+		}
+		var rows []*messageWithTotal
+		if err := mr.runSelect(ctx, op, q.Column(sq.Alias(count, "total_count")), &rows); err != nil {
+			return 0, err
+		}
+		*messages = make([]*Message, len(rows))
+		for i, row := range rows {
+			(*messages)[i] = &row.Message
+		}
+		if len(rows) > 0 {
+			total = rows[0].TotalCount
+		} else if query.Offset > 0 || query.After != nil || query.Before != nil {
+			if total, err = mr.runCount(ctx, op, count); err != nil {
+				return 0, err
+			}
+		}
+	} else {
+		*messages = nil
+		if err := mr.runSelect(ctx, op, q, messages); err != nil {
+			return 0, err
+		}
 	}
 
-	var id MessageId
-	err = rows.Scan(&id)
+	if query.Before != nil {
+		reverse(*messages)
+	}
+	return total, nil
+}
+
+// Creates a query counting the messages matching cond and the filter of a query.
+func (mr *MessagesRepository) countQuery(
+	ctx context.Context, op string, query MessageQuery, cond string,
+) (sq.SelectBuilder, error) {
+	q := sq.Select("count(*)").From("messages").Where(cond)
+	if query.Filter != nil {
+		filter, err := mr.filterCondition(query.Filter)
+		if err != nil {
+			return sq.SelectBuilder{}, repoError(ctx, op, fmt.Errorf("failed to compile messages filter: %w", err), err)
+		}
+		q = q.Where(filter)
+	}
+	return q, nil
+}
+
+func (mr *MessagesRepository) runCount(ctx context.Context, op string, q sq.SelectBuilder) (int64, error) {
+	sqlS, args, err := q.PlaceholderFormat(mr.dialect.Placeholder).ToSql()
 	if err != nil {
-		return id, err
+		return 0, repoError(ctx, op, fmt.Errorf("failed to generate count query:\n%w", err), err)
 	}
-	numRow := 1
-	for rows.Next() {
-		numRow += 1
+	var count int64
+	if err := mr.db.GetContext(ctx, &count, sqlS, args...); err != nil {
+		return 0, repoError(ctx, op,
+			fmt.Errorf("failed to run count query\nquery: %s\nargs: %+v\n%w", sqlS, args, err), err)
 	}
-	if numRow != 1 {
-		return id, repoError2(op, fmt.Errorf("unexpected number of rows expected %d, but was %d", 1, numRow))
+	return count, nil
+}
+
+// Text search configuration of the messages full-text index, see the "add messages full text index" migration.
+const searchConfig = "english"
+
+// Options of the highlight of search results, see ts_headline.
+var headlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s", messages.HighlightStart, messages.HighlightStop)
+
+// Search retrieves the messages matching the text of the search. When the database has a full-text index the text is
+// parsed as a web search (see websearch_to_tsquery), so it may contain quoted phrases, or and - operators. Otherwise
+// the messages containing the text are retrieved (see substringSearch).
+func (mr *MessagesRepository) Search(
+	ctx context.Context, query messages.SearchQuery, results *[]*messages.SearchResult,
+) error {
+	op := mr.dialect.Name + ".Search"
+	if !mr.dialect.FullTextSearch {
+		return mr.substringSearch(ctx, op, query, results)
 	}
-	return id, nil
+
+	cols, err := selectColumns(op, query.Fields)
+	if err != nil {
+		return err
+	}
+	q := sq.Select(cols...).
+		Column("ts_rank(message_tsv, search) as rank").
+		Column("ts_headline('"+searchConfig+"', message, search, ?) as highlight", headlineOptions).
+		From("messages").
+		JoinClause("cross join websearch_to_tsquery('"+searchConfig+"', ?) search", query.Text).
+		Where(notDeleted).
+		Where("message_tsv @@ search").
+		OrderBy("rank desc", "id")
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+	if query.Offset > 0 {
+		q = q.Offset(query.Offset)
+	}
+
+	*results = nil
+	return mr.runSelect(ctx, op, q, results)
 }
 
-func (mr *MessagesRepository) GetAll(messages *[]*Message) error {
-	const op = repoName + ".GetAll"
-	if err := mr.db.Select(messages,
-		`select id, version, created_at, updated_at, message from messages`); err != nil {
-		return repoError(op, fmt.Errorf("failed to get messages: %w", err), err)
+// Retrieves the messages containing the text of the search (case-insensitive), see messages.HighlightSubstring. Most
+// databases have no equivalent of the case folding of Go, so the messages are matched after they are read, which
+// requires reading every message.
+func (mr *MessagesRepository) substringSearch(
+	ctx context.Context, op string, query messages.SearchQuery, results *[]*messages.SearchResult,
+) error {
+	cols, err := selectColumns(op, query.Fields)
+	if err != nil {
+		return err
+	}
+	_, withMessage := query.Fields[messages.FieldMessage]
+	withMessage = withMessage || len(query.Fields) == 0
+	if !withMessage {
+		cols = append(cols, "message")
+	}
+
+	var all []*messages.SearchResult
+	q := sq.Select(cols...).From("messages").Where(notDeleted).OrderBy("id")
+	if err := mr.runSelect(ctx, op, q, &all); err != nil {
+		return err
+	}
+
+	var matches []*messages.SearchResult
+	for _, r := range all {
+		highlight, found := messages.HighlightSubstring(r.Message.Message, query.Text)
+		if !found {
+			continue
+		}
+		r.Rank = 1
+		r.Highlight = highlight
+		if !withMessage {
+			r.Message.Message = ""
+		}
+		matches = append(matches, r)
+	}
+
+	if query.Offset >= uint64(len(matches)) {
+		matches = nil
+	} else {
+		matches = matches[query.Offset:]
 	}
+	if query.Limit > 0 && query.Limit < uint64(len(matches)) {
+		matches = matches[:query.Limit]
+	}
+	*results = matches
 	return nil
 }
 
-func (mr *MessagesRepository) GetAllQuery(query MessageQuery, messages *[]*Message) error {
-	const op = repoName + ".GetAllQuery"
+// Orders the query by the order keys of the query (see MessageQuery.OrderKeys), only including the messages after or
+// before the cursor of the query. Messages before the cursor are selected in the reverse order, so the results must be
+// reversed (see reverse). The sort fields must have been validated (see invalidSortFields).
+func (mr *MessagesRepository) orderByCursor(q sq.SelectBuilder, query MessageQuery) sq.SelectBuilder {
+	keys := query.OrderKeys()
+	cursor := query.After
+	if query.Before != nil {
+		cursor = query.Before
+		for i := range keys {
+			keys[i].Desc = !keys[i].Desc
+		}
+	}
+	if cursor != nil {
+		q = q.Where(mr.followingCursor(keys, cursor))
+	}
+	for _, k := range keys {
+		if k.Desc {
+			q = q.OrderBy(queryableFields[k.Field] + " desc")
+		} else {
+			q = q.OrderBy(queryableFields[k.Field])
+		}
+	}
+	return q
+}
+
+// Condition matching the messages following the cursor when ordered by keys, ex. for the keys created_at desc, id:
+// (created_at < $1) or (created_at = $1 and id > $2)
+func (mr *MessagesRepository) followingCursor(keys []messages.SortKey, cursor *messages.Cursor) sq.Or {
+	cond := make(sq.Or, 0, len(keys))
+	for i, k := range keys {
+		and := make(sq.And, 0, i+1)
+		for _, prev := range keys[:i] {
+			and = append(and, mr.dialect.compare(queryableFields[prev.Field], "=", cursor.Value(prev.Field)))
+		}
+		col := queryableFields[k.Field]
+		if k.Desc {
+			and = append(and, mr.dialect.compare(col, "<", cursor.Value(k.Field)))
+		} else {
+			and = append(and, mr.dialect.compare(col, ">", cursor.Value(k.Field)))
+		}
+		cond = append(cond, and)
+	}
+	return cond
+}
+
+// Compiles a filter into a query condition, values are passed as parameters. The filter should have been validated
+// (see messages.ValidateFilter).
+func (mr *MessagesRepository) filterCondition(f messages.Filter) (sq.Sqlizer, error) {
+	switch f := f.(type) {
+	case messages.And:
+		cond := make(sq.And, 0, len(f))
+		for _, sub := range f {
+			c, err := mr.filterCondition(sub)
+			if err != nil {
+				return nil, err
+			}
+			cond = append(cond, c)
+		}
+		return cond, nil
+	case messages.Or:
+		cond := make(sq.Or, 0, len(f))
+		for _, sub := range f {
+			c, err := mr.filterCondition(sub)
+			if err != nil {
+				return nil, err
+			}
+			cond = append(cond, c)
+		}
+		return cond, nil
+	case messages.Condition:
+		col, found := queryableFields[f.Field]
+		if !found {
+			return nil, fmt.Errorf("invalid filter field %s", f.Field)
+		}
+		switch f.Op {
+		case messages.FilterEq:
+			return mr.dialect.compare(col, "=", f.Value), nil
+		case messages.FilterNe:
+			return mr.dialect.compare(col, "<>", f.Value), nil
+		case messages.FilterGt:
+			return mr.dialect.compare(col, ">", f.Value), nil
+		case messages.FilterGte:
+			return mr.dialect.compare(col, ">=", f.Value), nil
+		case messages.FilterLt:
+			return mr.dialect.compare(col, "<", f.Value), nil
+		case messages.FilterLte:
+			return mr.dialect.compare(col, "<=", f.Value), nil
+		case messages.FilterContains:
+			return sq.Expr(mr.dialect.Strpos+"("+col+", ?) > 0", f.Value), nil
+		}
+		return nil, fmt.Errorf("invalid filter operator %s", f.Op)
+	}
+	return nil, fmt.Errorf("invalid filter %T", f)
+}
+
+// Returns the sort fields of a query that cannot be sorted by.
+func invalidSortFields(query MessageQuery) []string {
+	var invalid []string
+	for _, k := range query.Sort {
+		if _, found := queryableFields[k.Field]; !found {
+			invalid = append(invalid, k.Field)
+		}
+	}
+	return invalid
+}
 
+func reverse(messages []*Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
+
+// Determines the columns to select for the requested fields, every queryable field is selected when no fields are
+// requested. An ETInvalid error is returned when a field cannot be queried.
+func selectColumns(op string, fields map[string]struct{}) ([]string, error) {
 	var cols []string
-	if len(query.Fields) == 0 {
+	if len(fields) == 0 {
 		cols = make([]string, 0, len(queryableFields))
 		for _, col := range queryableFields {
 			cols = append(cols, col)
 		}
 	} else {
-		cols = make([]string, 0, len(query.Fields))
+		cols = make([]string, 0, len(fields))
 		var notFound []string
-		for field := range query.Fields {
+		for field := range fields {
 			col, found := queryableFields[field]
 			if found {
 				cols = append(cols, col)
@@ -125,70 +497,219 @@ func (mr *MessagesRepository) GetAllQuery(query MessageQuery, messages *[]*Messa
 				Err:   err,
 				Stack: errors2.WithStack(err),
 			}
-			aErr.AddResponse(apperrors.ErrorResponse(err.Error()))
-			return &aErr
+			aErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryFieldsInvalid, err.Error()).
+				WithArgs(map[string]interface{}{"fields": strings.Join(notFound, ", ")}))
+			return nil, &aErr
 		}
 	}
+	return cols, nil
+}
 
-	q := sq.Select(cols...).From("messages")
+// Creates the select query for the fields, filter, sorting and pagination settings of a MessageQuery.
+func (mr *MessagesRepository) selectQuery(
+	ctx context.Context, op string, query MessageQuery,
+) (sq.SelectBuilder, error) {
+	cols, err := selectColumns(op, query.Fields)
+	if err != nil {
+		return sq.SelectBuilder{}, err
+	}
+
+	if invalid := invalidSortFields(query); len(invalid) != 0 {
+		err := fmt.Errorf("invalid messages sort fields: %s", strings.Join(invalid, ", "))
+		aErr := apperrors.Error{
+			EType: apperrors.ETInvalid,
+			Op:    op,
+			Err:   err,
+			Stack: errors2.WithStack(err),
+		}
+		aErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeQuerySortFieldInvalid, err.Error()).
+			WithArgs(map[string]interface{}{"fields": strings.Join(invalid, ", ")}))
+		return sq.SelectBuilder{}, &aErr
+	}
+
+	q := mr.orderByCursor(sq.Select(cols...).From("messages"), query)
+	if query.Filter != nil {
+		cond, err := mr.filterCondition(query.Filter)
+		if err != nil {
+			return sq.SelectBuilder{}, repoError(ctx, op, fmt.Errorf("failed to compile messages filter: %w", err), err)
+		}
+		q = q.Where(cond)
+	}
 	if query.Limit > 0 {
 		q = q.Limit(query.Limit)
+	} else if query.Offset > 0 && mr.dialect.OffsetRequiresLimit {
+		q = q.Limit(math.MaxInt64)
 	}
 	if query.Offset > 0 {
 		q = q.Offset(query.Offset)
 	}
+	return q, nil
+}
 
-	sqlS, args, err := q.ToSql()
+// Runs a select query, dest must be a pointer to an empty slice as the results are appended to it.
+func (mr *MessagesRepository) runSelect(ctx context.Context, op string, q sq.SelectBuilder, dest interface{}) error {
+	sqlS, args, err := q.PlaceholderFormat(mr.dialect.Placeholder).ToSql()
 	if err != nil {
-		return repoError(op, fmt.Errorf("failed to generate messages query:\n%w", err), err)
+		return repoError(ctx, op, fmt.Errorf("failed to generate messages query:\n%w", err), err)
 	}
-	if err := mr.db.Select(messages, sqlS, args...); err != nil {
-		return repoError(op,
+	if err := mr.db.SelectContext(ctx, dest, sqlS, args...); err != nil {
+		return repoError(ctx, op,
 			fmt.Errorf("failed to run messages query\nquery: %s\nargs: %+v\n%w", sqlS, args, err), err)
 	}
 	return nil
 }
 
-func (mr *MessagesRepository) GetById(id MessageId, m *Message) error {
-	const op = repoName + ".GetById"
-	if err := mr.db.Get(m, `select id, version, created_at, updated_at, message from messages where id=$1`, id); err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return repoError2(op, idMissingError(op, id))
+func (mr *MessagesRepository) GetById(ctx context.Context, id MessageId, m *Message) error {
+	op := mr.dialect.Name + ".GetById"
+	if err := mr.db.GetContext(ctx, m, mr.dialect.bind(
+		`select id, version, created_at, updated_at, message, is_palindrome from messages
+where id=? and deleted_at is null`),
+		id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repoError2(ctx, op, idMissingError(op, id))
 		}
-		return err
+		return repoError(ctx, op, fmt.Errorf("failed to get message with id %d: %w", id, err), err)
 	}
 	return nil
 }
 
-func (mr *MessagesRepository) UpdateById(id MessageId, m ModifyMessage) (MessageVersion, error) {
-	const op = repoName + ".UpdateById"
+func (mr *MessagesRepository) UpdateById(
+	ctx context.Context, id MessageId, version MessageVersion, m UpdateMessage,
+) (MessageVersion, error) {
+	op := mr.dialect.Name + ".UpdateById"
 
 	q := sq.Update("messages").
-		PlaceholderFormat(sq.Dollar).
+		PlaceholderFormat(mr.dialect.Placeholder).
 		Set("version", sq.Expr("version + 1")).
-		Set("updated_at", nowUTC()).
-		Where(sq.Eq{"id": id})
+		Set("updated_at", mr.dialect.timestamp(nowUTC())).
+		Where(sq.Eq{"id": id}).
+		Where(notDeleted)
+	if version != messages.AnyVersion {
+		q = q.Where(sq.Eq{"version": version})
+	}
 
-	q = q.Set("message", m.Message)
+	q = q.Set("message", m.Message).Set("is_palindrome", m.IsPalindrome)
 
 	sqlS, args, err := q.ToSql()
 	if err != nil {
-		return 0, repoError(op, fmt.Errorf("failed to generate update query: %w", err), err)
+		return 0, repoError(ctx, op, fmt.Errorf("failed to generate update query: %w", err), err)
 	}
 
-	row := mr.db.QueryRow(sqlS+" returning version", args...)
-	if err := row.Err(); err != nil {
-		return 0, repoError(op, fmt.Errorf("failed to update row: %w", err), err)
+	var newVersion MessageVersion
+	err = mr.inTx(ctx, op, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(ctx, sqlS+" returning version", args...)
+		if err := row.Err(); err != nil {
+			return repoError(ctx, op, fmt.Errorf("failed to update row: %w", err), err)
+		}
+
+		if err := row.Scan(&newVersion); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return mr.versionError(ctx, op, tx, id, version)
+			}
+			return repoError(ctx, op, fmt.Errorf("failed to scan version number: %w", err), err)
+		}
+		return mr.insertVersion(ctx, op, tx, id)
+	})
+	if err != nil {
+		return 0, err
 	}
+	return newVersion, nil
+}
 
-	var version MessageVersion
-	if err := row.Scan(&version); err != nil {
+// GetVersions retrieves every version of a message, ordered from oldest to newest.
+func (mr *MessagesRepository) GetVersions(ctx context.Context, id MessageId, versions *[]*Message) error {
+	op := mr.dialect.Name + ".GetVersions"
+	*versions = nil
+	if err := mr.db.SelectContext(ctx, versions, mr.dialect.bind(`
+select v.message_id as id, v.version, v.created_at, v.updated_at, v.message, v.is_palindrome
+from message_versions v join messages m on m.id = v.message_id
+where v.message_id = ? and m.deleted_at is null order by v.version`), id); err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to get versions of message with id %d: %w", id, err), err)
+	}
+	if len(*versions) == 0 {
+		return repoError2(ctx, op, idMissingError(op, id))
+	}
+	return nil
+}
+
+// GetVersion retrieves a specific version of a message.
+func (mr *MessagesRepository) GetVersion(ctx context.Context, id MessageId, version MessageVersion, m *Message) error {
+	op := mr.dialect.Name + ".GetVersion"
+	if err := mr.db.GetContext(ctx, m, mr.dialect.bind(`
+select v.message_id as id, v.version, v.created_at, v.updated_at, v.message, v.is_palindrome
+from message_versions v join messages m on m.id = v.message_id
+where v.message_id = ? and v.version = ? and m.deleted_at is null`), id, version); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, repoError2(op, idMissingError(op, id))
+			return mr.versionMissingError(ctx, op, id, version)
 		}
-		return 0, repoError(op, fmt.Errorf("failed to scan version number: %w", err), err)
+		return repoError(ctx, op,
+			fmt.Errorf("failed to get version %d of message with id %d: %w", version, id, err), err)
 	}
-	return version, nil
+	return nil
+}
+
+// Records the current state of a message as a version in the message history.
+func (mr *MessagesRepository) insertVersion(ctx context.Context, op string, tx *sqlx.Tx, id MessageId) error {
+	if _, err := tx.ExecContext(ctx, mr.dialect.bind(`
+insert into message_versions (message_id, version, created_at, updated_at, message, is_palindrome)
+select id, version, created_at, updated_at, message, is_palindrome from messages where id = ?`), id); err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to record version of message with id %d: %w", id, err), err)
+	}
+	return nil
+}
+
+// Runs fn within a transaction. The transaction is committed when fn succeeds and rolled back otherwise.
+func (mr *MessagesRepository) inTx(ctx context.Context, op string, fn func(tx *sqlx.Tx) error) error {
+	tx, err := mr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to begin transaction: %w", err), err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to commit transaction: %w", err), err)
+	}
+	return nil
+}
+
+// Determines why a specific version of a message could not be found. Returns an IdMissingError when the message does
+// not exist, otherwise a VersionMissingError.
+func (mr *MessagesRepository) versionMissingError(
+	ctx context.Context, op string, id MessageId, version MessageVersion,
+) error {
+	var exists bool
+	err := mr.db.GetContext(ctx, &exists,
+		mr.dialect.bind(`select exists(select 1 from messages where id = ? and deleted_at is null)`), id)
+	if err != nil {
+		return repoError(ctx, op, fmt.Errorf("failed to check message with id %d exists: %w", id, err), err)
+	}
+	if !exists {
+		return repoError2(ctx, op, idMissingError(op, id))
+	}
+	return repoError2(ctx, op, versionMissingError(op, id, version))
+}
+
+// Determines why an operation on a message with an expected version affected no rows. Returns an IdMissingError when
+// the message does not exist, otherwise a VersionMismatchError. The message is read with q, which must be the
+// transaction of the operation when it has one, so the error reports the state the operation saw.
+func (mr *MessagesRepository) versionError(
+	ctx context.Context, op string, q sqlx.QueryerContext, id MessageId, version MessageVersion,
+) error {
+	if version == messages.AnyVersion {
+		return repoError2(ctx, op, idMissingError(op, id))
+	}
+	var current MessageVersion
+	err := sqlx.GetContext(ctx, q, &current,
+		mr.dialect.bind(`select version from messages where id = ? and deleted_at is null`), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repoError2(ctx, op, idMissingError(op, id))
+		}
+		return repoError(ctx, op, fmt.Errorf("failed to get version of message with id %d: %w", id, err), err)
+	}
+	return repoError2(ctx, op, versionMismatchError(op, id, version, current))
 }
 
 func nowUTC() time.Time {
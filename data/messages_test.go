@@ -1,12 +1,15 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/postgres"
+	"github.com/mdev5000/messageappdemo/testutil/repotest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -14,21 +17,36 @@ func tMessageRepository(db *postgres.DB) *MessagesRepository {
 	return NewMessageRepository(db)
 }
 
+func TestMessagesRepository_conformance(t *testing.T) {
+	repotest.TestMessagesRepository(t, func(t *testing.T) (messages.Repository, func()) {
+		db, closeDb := acquireDb(t)
+		return tMessageRepository(db), closeDb
+	})
+}
+
+// Timestamps are stored without a time zone, so the time zone of the session must not affect them.
+func TestMessagesRepository_conformanceInAnotherTimeZone(t *testing.T) {
+	repotest.TestMessagesRepository(t, func(t *testing.T) (messages.Repository, func()) {
+		db, closeDb := acquireDbInTimeZone(t, "America/New_York")
+		return tMessageRepository(db), closeDb
+	})
+}
+
 func TestMessageRepository_Create_canCreateNewMessages(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
 	now := nowUTC()
 
-	id, err := mr.Create(CreateMessage{
+	id, err := mr.Create(context.Background(), CreateMessage{
 		Message:   "my message",
 		CreatedAt: now,
 	})
 	require.NoError(t, err)
 
 	var m Message
-	require.NoError(t, mr.GetById(id, &m))
+	require.NoError(t, mr.GetById(context.Background(), id, &m))
 	require.Equal(t, 1, m.Version)
 	require.Equal(t, "my message", m.Message)
 	require.True(t, now.Equal(m.CreatedAt))
@@ -36,58 +54,58 @@ func TestMessageRepository_Create_canCreateNewMessages(t *testing.T) {
 }
 
 func TestMessageRepository_GetById(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
 	// Add more records to make sure it's actually returning the correct one by id
 	var err error
-	_, err = mr.Create(CreateMessage{Message: "first"})
+	_, err = mr.Create(context.Background(), CreateMessage{Message: "first"})
 	require.NoError(t, err)
-	id, err := mr.Create(CreateMessage{Message: "find this one"})
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "find this one"})
 	require.NoError(t, err)
-	_, err = mr.Create(CreateMessage{Message: "first"})
+	_, err = mr.Create(context.Background(), CreateMessage{Message: "first"})
 	require.NoError(t, err)
 
 	var m Message
-	require.NoError(t, mr.GetById(id, &m))
+	require.NoError(t, mr.GetById(context.Background(), id, &m))
 	require.Equal(t, id, m.Id)
 	require.Equal(t, 1, m.Version)
 	require.Equal(t, "find this one", m.Message)
 }
 
 func TestMessageRepository_DeleteById_canDeleteMessagesById(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	id, err := mr.Create(CreateMessage{Message: "my message"})
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "my message"})
 	require.NoError(t, err)
 
-	require.NoError(t, mr.DeleteById(id))
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
 
 	var m Message
-	err = mr.GetById(id, &m)
+	err = mr.GetById(context.Background(), id, &m)
 	require.True(t, errors.Is(err, messages.IdMissingError{}))
 	require.Error(t, err, "MessagesRepository.DeleteById: no rows in result for get by id with id %d", id)
 }
 
 func TestMessageRepository_DeleteById_onlyDeletesTheSpecifiedId(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	id1, err := mr.Create(CreateMessage{Message: "message 1"})
+	id1, err := mr.Create(context.Background(), CreateMessage{Message: "message 1"})
 	require.NoError(t, err)
-	id2, err := mr.Create(CreateMessage{Message: "message 2"})
+	id2, err := mr.Create(context.Background(), CreateMessage{Message: "message 2"})
 	require.NoError(t, err)
-	id3, err := mr.Create(CreateMessage{Message: "message 3"})
+	id3, err := mr.Create(context.Background(), CreateMessage{Message: "message 3"})
 	require.NoError(t, err)
 
-	require.NoError(t, mr.DeleteById(id2))
+	require.NoError(t, mr.DeleteById(context.Background(), id2, messages.AnyVersion))
 
 	var messages []*Message
-	require.NoError(t, mr.GetAll(&messages))
+	require.NoError(t, mr.GetAll(context.Background(), &messages))
 
 	require.Len(t, messages, 2)
 
@@ -101,32 +119,32 @@ func TestMessageRepository_DeleteById_onlyDeletesTheSpecifiedId(t *testing.T) {
 }
 
 func TestMessageRepository_DeleteById_returnsErrorWhenNoRowsAreDeleted(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	err := mr.DeleteById(5)
+	err := mr.DeleteById(context.Background(), 5, messages.AnyVersion)
 	require.EqualError(t, err,
 		"Error [internal] (MessagesRepository.DeleteById): MessagesRepository.DeleteById: no row in result with id 5")
 }
 
 func TestMessagesRepository_UpdateById(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
 	// Add more records to make sure it's actually returning the correct one by id
-	id, err := mr.Create(CreateMessage{Message: "first message"})
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
 	require.NoError(t, err)
 
 	var message Message
-	require.NoError(t, mr.GetById(id, &message))
+	require.NoError(t, mr.GetById(context.Background(), id, &message))
 
-	v, err := mr.UpdateById(id, ModifyMessage{Message: "new message"})
+	v, err := mr.UpdateById(context.Background(), id, messages.AnyVersion, UpdateMessage{Message: "new message"})
 	require.NoError(t, err)
 
 	var messageChanged Message
-	require.NoError(t, mr.GetById(id, &messageChanged))
+	require.NoError(t, mr.GetById(context.Background(), id, &messageChanged))
 
 	require.Equal(t, message.Version+1, v, "version is not the same as the previous")
 	require.Equal(t, messageChanged.Version, v, "version has been updated")
@@ -135,11 +153,11 @@ func TestMessagesRepository_UpdateById(t *testing.T) {
 }
 
 func TestMessagesRepository_UpdateById_errorWhenMissing(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	_, err := mr.UpdateById(5, ModifyMessage{Message: "new message"})
+	_, err := mr.UpdateById(context.Background(), 5, messages.AnyVersion, UpdateMessage{Message: "new message"})
 
 	require.Equal(t,
 		idMissingError("MessagesRepository.UpdateById", 5),
@@ -147,28 +165,251 @@ func TestMessagesRepository_UpdateById_errorWhenMissing(t *testing.T) {
 }
 
 func TestMessagesRepository_UpdateById_whenNoChanges(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	_, err := mr.UpdateById(context.Background(), 5, messages.AnyVersion, UpdateMessage{Message: "new message"})
+
+	require.Equal(t,
+		idMissingError("MessagesRepository.UpdateById", 5),
+		errors.Unwrap(err))
+}
+
+func TestMessagesRepository_UpdateById_onlyUpdatesWhenVersionMatches(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	_, err = mr.UpdateById(context.Background(), id, 2, UpdateMessage{Message: "new message"})
+	require.Equal(t,
+		versionMismatchError("MessagesRepository.UpdateById", id, 2, 1),
+		errors.Unwrap(err))
+
+	v, err := mr.UpdateById(context.Background(), id, 1, UpdateMessage{Message: "new message"})
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+}
+
+func TestMessagesRepository_UpdateById_errorWhenMissingWithVersion(t *testing.T) {
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	_, err := mr.UpdateById(5, ModifyMessage{Message: "new message"})
+	_, err := mr.UpdateById(context.Background(), 5, 1, UpdateMessage{Message: "new message"})
 
 	require.Equal(t,
 		idMissingError("MessagesRepository.UpdateById", 5),
 		errors.Unwrap(err))
 }
 
+func TestMessageRepository_DeleteById_onlyDeletesWhenVersionMatches(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "my message"})
+	require.NoError(t, err)
+
+	err = mr.DeleteById(context.Background(), id, 2)
+	require.Equal(t,
+		versionMismatchError("MessagesRepository.DeleteById", id, 2, 1),
+		errors.Unwrap(err))
+
+	require.NoError(t, mr.DeleteById(context.Background(), id, 1))
+}
+
+func TestMessagesRepository_GetVersions_recordsEveryVersion(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	now := nowUTC()
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message", CreatedAt: now})
+	require.NoError(t, err)
+	_, err = mr.UpdateById(context.Background(), id, messages.AnyVersion, UpdateMessage{Message: "second message"})
+	require.NoError(t, err)
+
+	// Versions of other messages are not included.
+	_, err = mr.Create(context.Background(), CreateMessage{Message: "other message"})
+	require.NoError(t, err)
+
+	var current Message
+	require.NoError(t, mr.GetById(context.Background(), id, &current))
+
+	var versions []*Message
+	require.NoError(t, mr.GetVersions(context.Background(), id, &versions))
+	require.Len(t, versions, 2)
+
+	require.Equal(t, id, versions[0].Id)
+	require.Equal(t, 1, versions[0].Version)
+	require.Equal(t, "first message", versions[0].Message)
+	require.True(t, now.Equal(versions[0].CreatedAt))
+	require.True(t, now.Equal(versions[0].UpdatedAt))
+
+	require.Equal(t, &current, versions[1])
+}
+
+func TestMessagesRepository_GetVersions_errorWhenMissing(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	var versions []*Message
+	err := mr.GetVersions(context.Background(), 5, &versions)
+	require.Equal(t,
+		idMissingError("MessagesRepository.GetVersions", 5),
+		errors.Unwrap(err))
+}
+
+func TestMessagesRepository_GetVersion(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = mr.UpdateById(context.Background(), id, messages.AnyVersion, UpdateMessage{Message: "second message"})
+	require.NoError(t, err)
+
+	var m Message
+	require.NoError(t, mr.GetVersion(context.Background(), id, 1, &m))
+	require.Equal(t, 1, m.Version)
+	require.Equal(t, "first message", m.Message)
+
+	require.NoError(t, mr.GetVersion(context.Background(), id, 2, &m))
+	require.Equal(t, 2, m.Version)
+	require.Equal(t, "second message", m.Message)
+
+	err = mr.GetVersion(context.Background(), id, 3, &m)
+	require.Equal(t,
+		versionMissingError("MessagesRepository.GetVersion", id, 3),
+		errors.Unwrap(err))
+
+	err = mr.GetVersion(context.Background(), id+1, 1, &m)
+	require.Equal(t,
+		idMissingError("MessagesRepository.GetVersion", id+1),
+		errors.Unwrap(err))
+}
+
+func TestMessagesRepository_DeleteById_hidesVersionsUntilUndeleted(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
+
+	var versions []*Message
+	err = mr.GetVersions(context.Background(), id, &versions)
+	require.True(t, errors.Is(err, messages.IdMissingError{}))
+
+	_, err = mr.UndeleteById(context.Background(), id)
+	require.NoError(t, err)
+	require.NoError(t, mr.GetVersions(context.Background(), id, &versions))
+	require.Len(t, versions, 1)
+}
+
+func TestMessagesRepository_UndeleteById(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = mr.UpdateById(context.Background(), id, messages.AnyVersion, UpdateMessage{Message: "second message"})
+	require.NoError(t, err)
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
+
+	version, err := mr.UndeleteById(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	var m Message
+	require.NoError(t, mr.GetById(context.Background(), id, &m))
+	require.Equal(t, "second message", m.Message)
+	require.Nil(t, m.DeletedAt)
+}
+
+func TestMessagesRepository_UndeleteById_errorWhenNotDeleted(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	_, err = mr.UndeleteById(context.Background(), id)
+	require.True(t, errors.Is(err, messages.IdMissingError{}))
+
+	_, err = mr.UndeleteById(context.Background(), id+1)
+	require.True(t, errors.Is(err, messages.IdMissingError{}))
+}
+
+func TestMessagesRepository_GetDeletedQuery(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	_, err := mr.Create(context.Background(), CreateMessage{Message: "kept"})
+	require.NoError(t, err)
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "deleted"})
+	require.NoError(t, err)
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
+
+	var deleted []*Message
+	require.NoError(t, mr.GetDeletedQuery(context.Background(), MessageQuery{}, &deleted))
+	require.Len(t, deleted, 1)
+	require.Equal(t, "deleted", deleted[0].Message)
+	require.NotNil(t, deleted[0].DeletedAt)
+
+	var all []*Message
+	require.NoError(t, mr.GetAllQuery(context.Background(), MessageQuery{}, &all))
+	require.Len(t, all, 1)
+	require.Equal(t, "kept", all[0].Message)
+}
+
+func TestMessagesRepository_PurgeDeleted(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	mr := tMessageRepository(db)
+
+	kept, err := mr.Create(context.Background(), CreateMessage{Message: "kept"})
+	require.NoError(t, err)
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "deleted"})
+	require.NoError(t, err)
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
+
+	purged, err := mr.PurgeDeleted(context.Background(), nowUTC().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged)
+
+	purged, err = mr.PurgeDeleted(context.Background(), nowUTC().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+
+	_, err = mr.UndeleteById(context.Background(), id)
+	require.True(t, errors.Is(err, messages.IdMissingError{}))
+
+	var m Message
+	require.NoError(t, mr.GetById(context.Background(), kept, &m))
+}
+
 func TestMessagesRepository_GetAllQuery_canGetAllFields(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
 	now := nowUTC()
-	id, err := mr.Create(CreateMessage{Message: "first", CreatedAt: now})
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first", CreatedAt: now})
 	require.NoError(t, err)
 
 	var messages []*Message
-	require.NoError(t, mr.GetAllQuery(MessageQuery{}, &messages))
+	require.NoError(t, mr.GetAllQuery(context.Background(), MessageQuery{}, &messages))
 
 	require.Len(t, messages, 1)
 	require.Equal(t, id, messages[0].Id)
@@ -178,15 +419,15 @@ func TestMessagesRepository_GetAllQuery_canGetAllFields(t *testing.T) {
 }
 
 func TestMessagesRepository_GetAllQuery_canLimitQueriedFields(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	id, err := mr.Create(CreateMessage{Message: "a message"})
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "a message"})
 	require.NoError(t, err)
 
 	var golden Message
-	require.NoError(t, mr.GetById(id, &golden))
+	require.NoError(t, mr.GetById(context.Background(), id, &golden))
 
 	cases := []struct {
 		name     string
@@ -222,7 +463,7 @@ func TestMessagesRepository_GetAllQuery_canLimitQueriedFields(t *testing.T) {
 				fields[field] = struct{}{}
 			}
 			var messages []*Message
-			require.NoError(t, mr.GetAllQuery(MessageQuery{Fields: fields}, &messages))
+			require.NoError(t, mr.GetAllQuery(context.Background(), MessageQuery{Fields: fields}, &messages))
 			require.Len(t, messages, 1)
 			require.Equal(t, &c.expected, messages[0])
 		})
@@ -230,21 +471,21 @@ func TestMessagesRepository_GetAllQuery_canLimitQueriedFields(t *testing.T) {
 }
 
 func TestMessagesRepository_getAllQuery(t *testing.T) {
-	db, closeDb := acquireDb()
+	db, closeDb := acquireDb(t)
 	defer closeDb()
 	mr := tMessageRepository(db)
 
-	id1, err := mr.Create(CreateMessage{Message: "first"})
+	id1, err := mr.Create(context.Background(), CreateMessage{Message: "first"})
 	require.NoError(t, err)
-	id2, err := mr.Create(CreateMessage{Message: "second"})
+	id2, err := mr.Create(context.Background(), CreateMessage{Message: "second"})
 	require.NoError(t, err)
-	id3, err := mr.Create(CreateMessage{Message: "third"})
+	id3, err := mr.Create(context.Background(), CreateMessage{Message: "third"})
 	require.NoError(t, err)
 
 	t.Run("can retrieve all records", func(t *testing.T) {
 		q := MessageQuery{Fields: map[string]struct{}{"id": {}}}
 		var messages []*Message
-		require.NoError(t, mr.GetAllQuery(q, &messages))
+		require.NoError(t, mr.GetAllQuery(context.Background(), q, &messages))
 
 		require.Len(t, messages, 3)
 		require.Equal(t, id1, messages[0].Id)
@@ -260,7 +501,7 @@ func TestMessagesRepository_getAllQuery(t *testing.T) {
 			Offset: 1,
 		}
 		var messages []*Message
-		require.NoError(t, mr.GetAllQuery(q, &messages))
+		require.NoError(t, mr.GetAllQuery(context.Background(), q, &messages))
 
 		require.Len(t, messages, 2)
 		require.Equal(t, id2, messages[0].Id)
@@ -273,7 +514,7 @@ func TestMessagesRepository_getAllQuery(t *testing.T) {
 			Offset: 500,
 		}
 		var messages []*Message
-		require.NoError(t, mr.GetAllQuery(q, &messages))
+		require.NoError(t, mr.GetAllQuery(context.Background(), q, &messages))
 		require.Len(t, messages, 0)
 	})
 }
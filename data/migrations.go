@@ -0,0 +1,142 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/mdev5000/messageappdemo/postgres"
+)
+
+// Migration is a single versioned change to the database schema. Migrations are applied in order of their version and
+// each is run within its own transaction.
+type Migration struct {
+	Version int
+	Name    string
+	// Up applies the change. It may only be empty when the change is made by Backfill.
+	Up string
+	// Backfill is optional and is run after Up within the same transaction. It is used to populate data that cannot be
+	// computed in SQL, or for changes that depend on the state of the database.
+	Backfill func(tx *postgres.Tx) error
+	// Down reverts the change made by Up.
+	Down string
+}
+
+// Migrations is the ordered registry of every schema migration. To change the schema add a new migration to the end of
+// the list, existing migrations should never be modified once released.
+//
+// The first migrations are written so they can also be applied to databases set up before migrations were tracked.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create messages",
+		Up: `
+create table if not exists messages (
+	id serial,
+	version integer not null,
+	created_at TIMESTAMP DEFAULT NOW(),
+	updated_at TIMESTAMP DEFAULT NOW(),
+	message text not null
+);`,
+		Down: `drop table messages;`,
+	},
+	{
+		Version: 2,
+		Name:    "create message versions",
+		Up: `
+create table if not exists message_versions (
+	message_id integer not null,
+	version integer not null,
+	created_at TIMESTAMP not null,
+	updated_at TIMESTAMP not null,
+	message text not null,
+	primary key (message_id, version)
+);
+
+insert into message_versions (message_id, version, created_at, updated_at, message)
+select id, version, created_at, updated_at, message from messages
+on conflict do nothing;`,
+		Down: `drop table message_versions;`,
+	},
+	{
+		Version: 3,
+		Name:    "add messages deleted at",
+		Up:      `alter table messages add column if not exists deleted_at TIMESTAMP;`,
+		Down:    `alter table messages drop column deleted_at;`,
+	},
+	{
+		Version: 4,
+		Name:    "add messages is palindrome",
+		Up: `
+alter table messages add column is_palindrome boolean not null default false;
+alter table message_versions add column is_palindrome boolean not null default false;`,
+		Backfill: backfillIsPalindrome,
+		Down: `
+alter table messages drop column is_palindrome;
+alter table message_versions drop column is_palindrome;`,
+	},
+	{
+		Version: 5,
+		Name:    "add messages full text index",
+		Up: `
+alter table messages add column message_tsv tsvector
+	generated always as (to_tsvector('english', message)) stored;
+create index messages_message_tsv_idx on messages using gin (message_tsv);`,
+		Down: `
+drop index messages_message_tsv_idx;
+alter table messages drop column message_tsv;`,
+	},
+}
+
+// Number of rows backfillIsPalindrome reads at a time.
+const backfillBatchSize = 1000
+
+// Determines which existing messages (and versions) are palindromes. New columns default to false, so only the
+// palindromes need to be updated.
+func backfillIsPalindrome(tx *postgres.Tx) error {
+	var lastId messages.MessageId
+	for {
+		var batch []*messages.Message
+		if err := tx.Select(&batch, `
+select id, message from messages where id > $1 order by id limit $2`, lastId, backfillBatchSize); err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+		for _, m := range batch {
+			if !messages.IsPalindrome(m) {
+				continue
+			}
+			if _, err := tx.Exec(`update messages set is_palindrome = true where id = $1`, m.Id); err != nil {
+				return fmt.Errorf("failed to update message with id %d: %w", m.Id, err)
+			}
+		}
+		if len(batch) < backfillBatchSize {
+			break
+		}
+		lastId = batch[len(batch)-1].Id
+	}
+
+	var lastVersion messages.MessageVersion
+	lastId = 0
+	for {
+		var batch []*messages.Message
+		if err := tx.Select(&batch, `
+select message_id as id, version, message from message_versions
+where (message_id, version) > ($1, $2) order by message_id, version limit $3`,
+			lastId, lastVersion, backfillBatchSize); err != nil {
+			return fmt.Errorf("failed to read message versions: %w", err)
+		}
+		for _, m := range batch {
+			if !messages.IsPalindrome(m) {
+				continue
+			}
+			if _, err := tx.Exec(`
+update message_versions set is_palindrome = true where message_id = $1 and version = $2`,
+				m.Id, m.Version); err != nil {
+				return fmt.Errorf("failed to update version %d of message with id %d: %w", m.Version, m.Id, err)
+			}
+		}
+		if len(batch) < backfillBatchSize {
+			return nil
+		}
+		lastId, lastVersion = batch[len(batch)-1].Id, batch[len(batch)-1].Version
+	}
+}
@@ -0,0 +1,244 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mdev5000/messageappdemo/postgres"
+)
+
+const migrationsTable = `
+create table if not exists schema_migrations (
+	version integer primary key,
+	name text not null,
+	applied_at TIMESTAMP not null
+);`
+
+// MigrationStatus is the state of a single migration in the database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts schema migrations. Applied migrations are tracked in the schema_migrations table.
+type Migrator struct {
+	db         *sqlx.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the migrations in the Migrations registry.
+func NewMigrator(db *postgres.DB) *Migrator {
+	return NewDialectMigrator(db, Postgres, Migrations)
+}
+
+// NewDialectMigrator creates a Migrator for a database of the given dialect, migrations must be ordered by version.
+func NewDialectMigrator(db *sqlx.DB, dialect Dialect, migrations []Migration) *Migrator {
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}
+}
+
+// Latest is the version of the last migration in the registry.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every migration that has not yet been applied.
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// Down reverts the last applied migration. It does nothing when no migrations have been applied.
+func (m *Migrator) Down() error {
+	return m.withLock(func(conn *sqlx.Conn) error {
+		current, err := currentVersion(conn)
+		if err != nil {
+			return err
+		}
+		target := 0
+		for _, mig := range m.migrations {
+			if mig.Version < current {
+				target = mig.Version
+			}
+		}
+		return m.migrate(conn, current, target)
+	})
+}
+
+// To applies or reverts migrations until the schema is at the given version. A version of 0 reverts every migration.
+func (m *Migrator) To(version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("migration version %d does not exist", version)
+	}
+	return m.withLock(func(conn *sqlx.Conn) error {
+		current, err := currentVersion(conn)
+		if err != nil {
+			return err
+		}
+		return m.migrate(conn, current, version)
+	})
+}
+
+// Version returns the version of the last applied migration, 0 when none have been applied.
+func (m *Migrator) Version() (int, error) {
+	var version int
+	err := m.withLock(func(conn *sqlx.Conn) error {
+		var err error
+		version, err = currentVersion(conn)
+		return err
+	})
+	return version, err
+}
+
+// Status returns the status of every migration in the registry, ordered by version.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sqlx.Conn) error {
+		var applied []struct {
+			Version   int       `db:"version"`
+			AppliedAt time.Time `db:"applied_at"`
+		}
+		if err := conn.SelectContext(context.Background(), &applied,
+			`select version, applied_at from schema_migrations`); err != nil {
+			return fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+		appliedAt := map[int]time.Time{}
+		for _, a := range applied {
+			appliedAt[a.Version] = a.AppliedAt
+		}
+
+		statuses = make([]MigrationStatus, len(m.migrations))
+		for i, mig := range m.migrations {
+			statuses[i].Migration = mig
+			if at, found := appliedAt[mig.Version]; found {
+				at := at
+				statuses[i].Applied = true
+				statuses[i].AppliedAt = &at
+			}
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Applies the migrations after current up to and including target, or reverts the migrations after target up to and
+// including current.
+func (m *Migrator) migrate(conn *sqlx.Conn, current, target int) error {
+	if target >= current {
+		for _, mig := range m.migrations {
+			if mig.Version > current && mig.Version <= target {
+				if err := m.apply(conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version <= current && mig.Version > target {
+			if err := m.revert(conn, mig); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// Runs fn on a single connection while holding the migration lock.
+func (m *Migrator) withLock(fn func(conn *sqlx.Conn) error) error {
+	ctx := context.Background()
+	// Locks (ex. advisory locks) belong to a session, so the lock and the migrations must all use the same connection.
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.dialect.MigrationLock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.MigrationLock); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			_, _ = conn.ExecContext(ctx, m.dialect.MigrationUnlock)
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, migrationsTable); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return fn(conn)
+}
+
+func currentVersion(conn *sqlx.Conn) (int, error) {
+	var version int
+	if err := conn.GetContext(context.Background(), &version,
+		`select coalesce(max(version), 0) from schema_migrations`); err != nil {
+		return 0, fmt.Errorf("failed to get current migration version: %w", err)
+	}
+	return version, nil
+}
+
+func (m *Migrator) apply(conn *sqlx.Conn, mig Migration) error {
+	return inConnTx(conn, func(tx *sqlx.Tx) error {
+		if mig.Up != "" {
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", mig.Version, mig.Name, err)
+			}
+		}
+		if mig.Backfill != nil {
+			if err := mig.Backfill(tx); err != nil {
+				return fmt.Errorf("failed to backfill migration %d (%s): %w", mig.Version, mig.Name, err)
+			}
+		}
+		if _, err := tx.Exec(
+			m.dialect.bind(`insert into schema_migrations (version, name, applied_at) values (?, ?, `+
+				m.dialect.TimestampParam+`)`),
+			mig.Version, mig.Name, m.dialect.Timestamp(nowUTC())); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) revert(conn *sqlx.Conn, mig Migration) error {
+	if mig.Down == "" {
+		return fmt.Errorf("migration %d (%s) cannot be reverted", mig.Version, mig.Name)
+	}
+	return inConnTx(conn, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(mig.Down); err != nil {
+			return fmt.Errorf("failed to revert migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(m.dialect.bind(`delete from schema_migrations where version = ?`), mig.Version)
+		if err != nil {
+			return fmt.Errorf("failed to remove migration %d: %w", mig.Version, err)
+		}
+		return nil
+	})
+}
+
+func inConnTx(conn *sqlx.Conn, fn func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
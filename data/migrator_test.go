@@ -0,0 +1,95 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_versionsAreIncreasing(t *testing.T) {
+	last := 0
+	for _, m := range Migrations {
+		require.Greater(t, m.Version, last, "migration %s is out of order", m.Name)
+		require.NotEmpty(t, m.Up, "migration %d has no up", m.Version)
+		require.NotEmpty(t, m.Down, "migration %d has no down", m.Version)
+		last = m.Version
+	}
+}
+
+func TestMigrator_canMigrateUpAndDown(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	m := NewMigrator(db)
+
+	// The pool has already migrated the database to the latest version.
+	version, err := m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest(), version)
+
+	// Leave the database at the latest version for other tests.
+	defer func() { require.NoError(t, m.Up()) }()
+
+	require.NoError(t, m.Down())
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest()-1, version)
+
+	require.NoError(t, m.To(1))
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, len(Migrations))
+	require.True(t, statuses[0].Applied)
+	require.NotNil(t, statuses[0].AppliedAt)
+	for _, s := range statuses[1:] {
+		require.False(t, s.Applied, "migration %d is not applied", s.Version)
+	}
+
+	var exists bool
+	require.NoError(t, db.Get(&exists,
+		`select exists(select 1 from information_schema.tables where table_name = 'message_versions')`))
+	require.False(t, exists, "down migrations were run")
+
+	require.NoError(t, m.Up())
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest(), version)
+
+	// Running up when already at the latest version does nothing.
+	require.NoError(t, m.Up())
+}
+
+func TestMigrator_errorWhenVersionDoesNotExist(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+
+	require.EqualError(t, NewMigrator(db).To(500), "migration version 500 does not exist")
+}
+
+func TestMigrations_isPalindromeIsBackfilled(t *testing.T) {
+	db, closeDb := acquireDb(t)
+	defer closeDb()
+	m := NewMigrator(db)
+	defer func() { require.NoError(t, m.Up()) }()
+
+	require.NoError(t, m.To(3))
+	_, err := db.Exec(`
+insert into messages (id, version, created_at, updated_at, message) values
+(1, 2, now(), now(), 'abba'),
+(2, 1, now(), now(), 'abc');
+insert into message_versions (message_id, version, created_at, updated_at, message) values
+(1, 1, now(), now(), 'abc'),
+(1, 2, now(), now(), 'abba'),
+(2, 1, now(), now(), 'abc');`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.To(4))
+
+	var palindromes []int64
+	require.NoError(t, db.Select(&palindromes, `select id from messages where is_palindrome order by id`))
+	require.Equal(t, []int64{1}, palindromes)
+
+	var versions []int
+	require.NoError(t, db.Select(&versions,
+		`select version from message_versions where is_palindrome and message_id = 1 order by version`))
+	require.Equal(t, []int{2}, versions)
+}
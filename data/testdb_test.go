@@ -23,18 +23,32 @@ var pool *dbpool.DbPool
 // pool manager, serving database instances as required to test functions.
 //
 // Ex.
-// db, closeDb := acquireDb()
+// db, closeDb := acquireDb(t)
 // defer closeDb()
 // // do db stuff...
 //
-func acquireDb() (*postgres.DB, func()) {
+// The test is skipped when the database is not available (see TestMain).
+func acquireDb(t *testing.T) (*postgres.DB, func()) {
+	skipWithoutDb(t)
 	return pool.AcquireDb()
 }
 
+// Acquire a database instance whose sessions use the time zone timeZone, see acquireDb.
+func acquireDbInTimeZone(t *testing.T, timeZone string) (*postgres.DB, func()) {
+	skipWithoutDb(t)
+	return pool.AcquireDbInTimeZone(timeZone)
+}
+
+func skipWithoutDb(t *testing.T) {
+	if pool == nil {
+		t.Skip("the database is not available (NODB=1)")
+	}
+}
+
 func TestMain(m *testing.M) {
-	// Do not run any db tests when NODB environment variable is set to 1
+	// Do not run any db tests when NODB environment variable is set to 1, the tests not requiring a db are still run.
 	if os.Getenv("NODB") == "1" {
-		return
+		os.Exit(m.Run())
 	}
 
 	pool = dbpool.NewDbPool()
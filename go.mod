@@ -6,13 +6,16 @@ require (
 	github.com/Masterminds/squirrel v1.5.0
 	github.com/chrismcguire/gobberish v0.0.0-20150821175641-1d8adb509a0e
 	github.com/davecgh/go-spew v1.1.1
+	github.com/evanphx/json-patch v4.12.0+incompatible
 	github.com/gorilla/mux v1.8.0
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/lib/pq v1.10.2
 	github.com/ory/dockertest/v3 v3.6.5
 	github.com/pkg/errors v0.9.1
+	github.com/rivo/uniseg v0.4.7
 	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.4.0
 	github.com/urfave/negroni v1.0.0
-	golang.org/x/text v0.3.0
+	golang.org/x/text v0.3.3
+	modernc.org/sqlite v1.17.3
 )
@@ -0,0 +1,54 @@
+package localize
+
+import "github.com/mdev5000/messageappdemo/apperrors"
+
+var spanish = map[string]string{
+	apperrors.CodeAnalyzerInvalid:       "analizador {{.name}} no válido, se esperaba uno de: {{.expected}}",
+	apperrors.CodeDataConcurrentChange:  "el cambio entra en conflicto con un cambio simultáneo, vuelva a intentarlo",
+	apperrors.CodeDataConflict:          "el cambio entra en conflicto con datos existentes",
+	apperrors.CodeDataInvalid:           "los datos no son válidos",
+	apperrors.CodeFilterFieldInvalid:    "campo de filtro no válido: {{.field}}",
+	apperrors.CodeFilterInvalid:         "filtro no válido {{.filter}}",
+	apperrors.CodeFilterOperatorInvalid: "operador de filtro no válido para {{.field}}: {{.op}}",
+	apperrors.CodeFilterValueInvalid: "valor de filtro no válido para {{.field}}" +
+		`{{if eq .type "integer"}}, se esperaba un número entero{{end}}` +
+		`{{if eq .type "time"}}, se esperaba una fecha RFC 3339{{end}}` +
+		`{{if eq .type "boolean"}}, se esperaba true o false{{end}}`,
+	apperrors.CodeHeaderIfMatchInvalid: "encabezado If-Match no válido",
+	apperrors.CodeMessageBlank:         "El campo del mensaje no puede estar vacío.",
+	apperrors.CodeMessageIdInvalid:     "id de mensaje no válido",
+	apperrors.CodeMessageTooLong: "El mensaje no puede tener más de {{.max}} " +
+		`{{plural .max "one" "carácter" "other" "caracteres"}}.`,
+	apperrors.CodeMessageVersionInvalid: "versión de mensaje no válida",
+	apperrors.CodePalindromeModeInvalid: "modo de palíndromo {{.mode}} no válido, se esperaba uno de: {{.expected}}",
+	apperrors.CodePalindromeModeStrictRequired: "isPalindrome solo se puede filtrar y ordenar con el modo de " +
+		"palíndromo strict",
+	apperrors.CodePatchJsonPatchFailed:       "no se pudo aplicar el json patch",
+	apperrors.CodePatchJsonPatchInvalid:      "json patch no válido",
+	apperrors.CodePatchMergePatchInvalid:     "merge patch no válido",
+	apperrors.CodePatchResultInvalid:         "el mensaje modificado no es válido",
+	apperrors.CodeQueryCursorInvalid:         "cursor {{.param}} no válido",
+	apperrors.CodeQueryCursorSortMismatch:    "el cursor {{.param}} no coincide con la ordenación",
+	apperrors.CodeQueryCursorsConflict:       "after y before no se pueden usar juntos",
+	apperrors.CodeQueryFieldsInvalid:         "campos de mensajes no válidos: {{.fields}}",
+	apperrors.CodeQueryFilterInvalid:         "parámetro de filtro no válido: {{.param}}",
+	apperrors.CodeQueryIncludeTotalInvalid:   "valor de includeTotal no válido",
+	apperrors.CodeQueryPageSizeInvalid:       "valor de pageSize no válido",
+	apperrors.CodeQueryPageStartIndexInvalid: "valor de pageStartIndex no válido",
+	apperrors.CodeQueryPageStartIndexCursor:  "pageStartIndex no se puede usar con after o before",
+	apperrors.CodeQuerySearchUnsupported: "la búsqueda solo admite los parámetros q, fields, pageSize y " +
+		"pageStartIndex",
+	apperrors.CodeQuerySortDuplicate:    "campo de ordenación duplicado: {{.field}}",
+	apperrors.CodeQuerySortFieldInvalid: "campos de ordenación de mensajes no válidos: {{.fields}}",
+	apperrors.CodeQuerySortInvalid:      "valor de ordenación no válido",
+	apperrors.CodeRequestBodyTooLarge:   "el cuerpo de la solicitud es demasiado grande",
+	apperrors.CodeRequestBodyUnreadable: "no se pudo leer el cuerpo de la solicitud",
+	apperrors.CodeRequestContentTypeUnsupported: "tipo de medio de patch no admitido, se esperaba uno de: " +
+		"{{.expected}}",
+	apperrors.CodeRequestJsonInvalid: "json no válido",
+	apperrors.CodeSearchTextBlank:    "el texto de búsqueda no puede estar vacío",
+	apperrors.CodeUndoStepsInvalid:   "El número de pasos debe ser un entero de al menos 1.",
+	apperrors.CodeUndoStepsTooMany: `No se {{plural .steps "one" "puede" "other" "pueden"}} deshacer {{.steps}} ` +
+		`{{plural .steps "one" "paso" "other" "pasos"}}, el mensaje solo tiene {{.versions}} ` +
+		`{{plural .versions "one" "versión anterior" "other" "versiones anteriores"}}.`,
+}
@@ -0,0 +1,54 @@
+package localize
+
+import "github.com/mdev5000/messageappdemo/apperrors"
+
+var french = map[string]string{
+	apperrors.CodeAnalyzerInvalid:       "analyseur {{.name}} invalide, valeurs attendues : {{.expected}}",
+	apperrors.CodeDataConcurrentChange:  "la modification est en conflit avec une modification simultanée, réessayez",
+	apperrors.CodeDataConflict:          "la modification est en conflit avec des données existantes",
+	apperrors.CodeDataInvalid:           "les données sont invalides",
+	apperrors.CodeFilterFieldInvalid:    "champ de filtre invalide : {{.field}}",
+	apperrors.CodeFilterInvalid:         "filtre invalide {{.filter}}",
+	apperrors.CodeFilterOperatorInvalid: "opérateur de filtre invalide pour {{.field}} : {{.op}}",
+	apperrors.CodeFilterValueInvalid: "valeur de filtre invalide pour {{.field}}" +
+		`{{if eq .type "integer"}}, un entier est attendu{{end}}` +
+		`{{if eq .type "time"}}, une date RFC 3339 est attendue{{end}}` +
+		`{{if eq .type "boolean"}}, true ou false est attendu{{end}}`,
+	apperrors.CodeHeaderIfMatchInvalid: "en-tête If-Match invalide",
+	apperrors.CodeMessageBlank:         "Le champ message ne peut pas être vide.",
+	apperrors.CodeMessageIdInvalid:     "identifiant de message invalide",
+	apperrors.CodeMessageTooLong: "Le message ne peut pas dépasser {{.max}} " +
+		`{{plural .max "one" "caractère" "other" "caractères"}}.`,
+	apperrors.CodeMessageVersionInvalid: "version de message invalide",
+	apperrors.CodePalindromeModeInvalid: "mode palindrome {{.mode}} invalide, valeurs attendues : {{.expected}}",
+	apperrors.CodePalindromeModeStrictRequired: "isPalindrome ne peut être filtré et trié qu'avec le mode " +
+		"palindrome strict",
+	apperrors.CodePatchJsonPatchFailed:       "le json patch n'a pas pu être appliqué",
+	apperrors.CodePatchJsonPatchInvalid:      "json patch invalide",
+	apperrors.CodePatchMergePatchInvalid:     "merge patch invalide",
+	apperrors.CodePatchResultInvalid:         "le message modifié est invalide",
+	apperrors.CodeQueryCursorInvalid:         "curseur {{.param}} invalide",
+	apperrors.CodeQueryCursorSortMismatch:    "le curseur {{.param}} ne correspond pas à l'ordre de tri",
+	apperrors.CodeQueryCursorsConflict:       "after et before ne peuvent pas être utilisés ensemble",
+	apperrors.CodeQueryFieldsInvalid:         "champs de messages invalides : {{.fields}}",
+	apperrors.CodeQueryFilterInvalid:         "paramètre de filtre invalide : {{.param}}",
+	apperrors.CodeQueryIncludeTotalInvalid:   "valeur includeTotal invalide",
+	apperrors.CodeQueryPageSizeInvalid:       "valeur pageSize invalide",
+	apperrors.CodeQueryPageStartIndexInvalid: "valeur pageStartIndex invalide",
+	apperrors.CodeQueryPageStartIndexCursor:  "pageStartIndex ne peut pas être utilisé avec after ou before",
+	apperrors.CodeQuerySearchUnsupported: "la recherche ne prend en charge que les paramètres q, fields, pageSize et " +
+		"pageStartIndex",
+	apperrors.CodeQuerySortDuplicate:    "champ de tri en double : {{.field}}",
+	apperrors.CodeQuerySortFieldInvalid: "champs de tri de messages invalides : {{.fields}}",
+	apperrors.CodeQuerySortInvalid:      "valeur de tri invalide",
+	apperrors.CodeRequestBodyTooLarge:   "corps de la requête trop volumineux",
+	apperrors.CodeRequestBodyUnreadable: "impossible de lire le corps de la requête",
+	apperrors.CodeRequestContentTypeUnsupported: "type de média de patch non pris en charge, valeurs attendues : " +
+		"{{.expected}}",
+	apperrors.CodeRequestJsonInvalid: "json invalide",
+	apperrors.CodeSearchTextBlank:    "le texte de recherche ne peut pas être vide",
+	apperrors.CodeUndoStepsInvalid:   "Le nombre d'étapes doit être un entier d'au moins 1.",
+	apperrors.CodeUndoStepsTooMany: "Impossible d'annuler {{.steps}} " +
+		`{{plural .steps "one" "étape" "other" "étapes"}}, le message n'a que {{.versions}} ` +
+		`{{plural .versions "one" "version précédente" "other" "versions précédentes"}}.`,
+}
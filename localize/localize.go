@@ -0,0 +1,160 @@
+// Package localize renders the user responses of errors (see apperrors.ErrResponse and apperrors.FieldErrorResponse) in
+// the language of the user.
+//
+// Responses are written in English where the error occurs. Translations are looked up by the code of the response (see
+// apperrors.Codes) and are text/template templates executed with the Args of the response, ex.
+//
+//	Le message ne peut pas dépasser {{.max}} {{plural .max "one" "caractère" "other" "caractères"}}.
+//
+// The plural function selects the text of the CLDR plural form (zero, one, two, few, many or other) of a number in the
+// language of the translation, falling back to other. Responses are left in English when the language or the code has
+// no translation.
+package localize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// Languages are the supported languages. The first is the language responses are written in, used when no other
+// language matches.
+var Languages = []language.Tag{language.English, language.French, language.Spanish}
+
+var matcher = language.NewMatcher(Languages)
+
+// Translations of the error codes, by language.
+var translations = map[language.Tag]map[string]string{
+	language.French:  french,
+	language.Spanish: spanish,
+}
+
+// The parsed translations, by language and then code.
+var templates = func() map[language.Tag]map[string]*template.Template {
+	parsed := map[language.Tag]map[string]*template.Template{}
+	for lang, texts := range translations {
+		parsed[lang] = map[string]*template.Template{}
+		for code, text := range texts {
+			parsed[lang][code] = template.Must(template.New(code).
+				Funcs(template.FuncMap{"plural": pluralFunc(lang)}).
+				Option("missingkey=error").
+				Parse(text))
+		}
+	}
+	return parsed
+}()
+
+// Negotiate returns the supported language best matching an Accept-Language header value (ex. "fr-CA, en;q=0.5"). The
+// default language (see Languages) is returned when the header is empty, malformed or no language matches.
+func Negotiate(acceptLanguage string) language.Tag {
+	_, index := language.MatchStrings(matcher, acceptLanguage)
+	return Languages[index]
+}
+
+type contextKey struct{}
+
+// WithLanguage returns a copy of the context holding the language of the user.
+func WithLanguage(ctx context.Context, lang language.Tag) context.Context {
+	return context.WithValue(ctx, contextKey{}, lang)
+}
+
+// LanguageFrom returns the language of the user held by the context, see WithLanguage. The default language (see
+// Languages) is returned when the context has none.
+func LanguageFrom(ctx context.Context) language.Tag {
+	if lang, ok := ctx.Value(contextKey{}).(language.Tag); ok {
+		return lang
+	}
+	return Languages[0]
+}
+
+// Translate renders the translation of an error code in a language. Found is false when the language or the code have
+// no translation, or the translation could not be rendered with the arguments.
+func Translate(lang language.Tag, code string, args map[string]interface{}) (text string, found bool) {
+	tmpl, found := templates[lang][code]
+	if !found {
+		return "", false
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, args); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// Error returns an error with the user responses of err rendered in a language. The error is returned as is when it has
+// no responses, otherwise a copy of its application error (see apperrors.AsError) is returned so err itself (ex. when
+// logged) is not changed.
+func Error(err error, lang language.Tag) error {
+	e, ok := apperrors.AsError(err)
+	if !ok || len(e.Responses) == 0 {
+		return err
+	}
+	localized := *e
+	localized.Responses = make([]interface{}, len(e.Responses))
+	for i, r := range e.Responses {
+		switch r := r.(type) {
+		case apperrors.ErrResponse:
+			if text, found := Translate(lang, r.Code, r.Args); found {
+				r.Error = text
+			}
+			localized.Responses[i] = r
+		case apperrors.FieldErrorResponse:
+			if text, found := Translate(lang, r.Code, r.Args); found {
+				r.Error = text
+			}
+			localized.Responses[i] = r
+		default:
+			localized.Responses[i] = r
+		}
+	}
+	return &localized
+}
+
+var pluralForms = map[string]plural.Form{
+	"zero":  plural.Zero,
+	"one":   plural.One,
+	"two":   plural.Two,
+	"few":   plural.Few,
+	"many":  plural.Many,
+	"other": plural.Other,
+}
+
+// Returns the plural template function of a language. It takes a number followed by pairs of plural form names and
+// texts, ex. {{plural .count "one" "message" "other" "messages"}}.
+func pluralFunc(lang language.Tag) func(n interface{}, forms ...string) (string, error) {
+	return func(n interface{}, forms ...string) (string, error) {
+		var i int
+		switch n := n.(type) {
+		case int:
+			i = n
+		case int64:
+			i = int(n)
+		default:
+			return "", fmt.Errorf("plural expects an integer, got %T", n)
+		}
+		if len(forms)%2 != 0 {
+			return "", fmt.Errorf("plural expects pairs of forms and texts")
+		}
+
+		texts := map[plural.Form]string{}
+		for j := 0; j < len(forms); j += 2 {
+			form, found := pluralForms[forms[j]]
+			if !found {
+				return "", fmt.Errorf("invalid plural form %s", forms[j])
+			}
+			texts[form] = forms[j+1]
+		}
+		if i < 0 {
+			i = -i
+		}
+		if text, found := texts[plural.Cardinal.MatchPlural(lang, i, 0, 0, 0, 0)]; found {
+			return text, nil
+		}
+		return texts[plural.Other], nil
+	}
+}
@@ -0,0 +1,131 @@
+package localize
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+// Values for every argument used by the error responses.
+var sampleArgs = map[string]interface{}{
+	"expected": "a, b",
+	"field":    "id",
+	"fields":   "a, b",
+	"filter":   "messages.Condition",
+	"max":      512,
+	"mode":     "sloppy",
+	"name":     "length",
+	"op":       "gt",
+	"param":    "after",
+	"steps":    2,
+	"type":     "integer",
+	"versions": 1,
+}
+
+func TestTranslate_everyCodeIsTranslated(t *testing.T) {
+	for lang, texts := range translations {
+		for _, c := range apperrors.Codes() {
+			text, found := Translate(lang, c.Code, sampleArgs)
+			require.True(t, found, "%s has no %s translation", c.Code, lang)
+			require.NotEmpty(t, text)
+		}
+		for code := range texts {
+			_, found := apperrors.LookupCode(code)
+			require.True(t, found, "%s translation of unknown code %s", lang, code)
+		}
+	}
+}
+
+func TestTranslate_rendersArgs(t *testing.T) {
+	text, found := Translate(language.French, apperrors.CodeFilterOperatorInvalid,
+		map[string]interface{}{"field": "id", "op": "like"})
+	require.True(t, found)
+	require.Equal(t, "opérateur de filtre invalide pour id : like", text)
+
+	text, found = Translate(language.Spanish, apperrors.CodeFilterValueInvalid,
+		map[string]interface{}{"field": "createdAt", "type": "time"})
+	require.True(t, found)
+	require.Equal(t, "valor de filtro no válido para createdAt, se esperaba una fecha RFC 3339", text)
+}
+
+func TestTranslate_plural(t *testing.T) {
+	cases := []struct {
+		lang     language.Tag
+		args     map[string]interface{}
+		expected string
+	}{
+		{language.French, map[string]interface{}{"steps": 2, "versions": 1},
+			"Impossible d'annuler 2 étapes, le message n'a que 1 version précédente."},
+		{language.French, map[string]interface{}{"steps": 1, "versions": 0},
+			"Impossible d'annuler 1 étape, le message n'a que 0 version précédente."},
+		{language.French, map[string]interface{}{"steps": 5, "versions": 4},
+			"Impossible d'annuler 5 étapes, le message n'a que 4 versions précédentes."},
+		{language.Spanish, map[string]interface{}{"steps": 1, "versions": 0},
+			"No se puede deshacer 1 paso, el mensaje solo tiene 0 versiones anteriores."},
+		{language.Spanish, map[string]interface{}{"steps": 3, "versions": 1},
+			"No se pueden deshacer 3 pasos, el mensaje solo tiene 1 versión anterior."},
+	}
+	for _, c := range cases {
+		text, found := Translate(c.lang, apperrors.CodeUndoStepsTooMany, c.args)
+		require.True(t, found)
+		require.Equal(t, c.expected, text)
+	}
+}
+
+func TestTranslate_notFound(t *testing.T) {
+	_, found := Translate(language.English, apperrors.CodeMessageBlank, nil)
+	require.False(t, found, "English responses are not translated")
+
+	_, found = Translate(language.French, "not.a.code", nil)
+	require.False(t, found)
+
+	_, found = Translate(language.French, apperrors.CodeMessageTooLong, nil)
+	require.False(t, found, "missing arguments")
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]language.Tag{
+		"":                     language.English,
+		"fr":                   language.French,
+		"fr-CA, en;q=0.5":      language.French,
+		"es-MX":                language.Spanish,
+		"de":                   language.English,
+		"de, es;q=0.3":         language.Spanish,
+		"en-GB, fr;q=0.8":      language.English,
+		"fr;q=0.2, es;q=0.9":   language.Spanish,
+		"not a language;;;q=a": language.English,
+	}
+	for header, expected := range cases {
+		require.Equal(t, expected, Negotiate(header), header)
+	}
+}
+
+func TestLanguageFrom(t *testing.T) {
+	require.Equal(t, language.English, LanguageFrom(context.Background()))
+	require.Equal(t, language.Spanish, LanguageFrom(WithLanguage(context.Background(), language.Spanish)))
+}
+
+func TestError(t *testing.T) {
+	e := &apperrors.Error{EType: apperrors.ETInvalid}
+	e.AddResponse(apperrors.FieldErrorResponse{Field: "message", Error: "Message field cannot be blank.",
+		Code: apperrors.CodeMessageBlank})
+	e.AddResponse(apperrors.ErrorResponse("thing.invalid", "not translated"))
+	e.AddResponse("a custom response")
+
+	localized := Error(e, language.French).(*apperrors.Error)
+	require.Equal(t, []interface{}{
+		apperrors.FieldErrorResponse{Field: "message", Error: "Le champ message ne peut pas être vide.",
+			Code: apperrors.CodeMessageBlank},
+		apperrors.ErrorResponse("thing.invalid", "not translated"),
+		"a custom response",
+	}, localized.Responses)
+	require.Equal(t, "Message field cannot be blank.", e.Responses[0].(apperrors.FieldErrorResponse).Error,
+		"the original error is not changed")
+
+	other := errors.New("other")
+	require.Equal(t, other, Error(other, language.French))
+}
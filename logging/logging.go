@@ -29,20 +29,19 @@ func (l *Logger) LogFailedToEncode(op string, origErr error, jsonErr error, stac
 	}).Errorf("failed to encode error response (op: %s)", op)
 }
 
-// LogError an error from within the application. If the error is of type apperrors.Error then the information inside
-// is specially encoded into a log entry.
+// LogError an error from within the application. If the error is (or wraps) an apperrors.Error then the information
+// inside is specially encoded into a log entry.
 func (l *Logger) LogError(err error) {
-	switch e := err.(type) {
-	case *apperrors.Error:
+	if e, ok := apperrors.AsError(err); ok {
 		l.WithFields(Fields{
-			"err":   fmt.Sprintf("%+v", e.Err),
+			"err":   fmt.Sprintf("%+v", err),
 			"stack": fmt.Sprintf("%+v", e.Stack),
 		}).Errorf("%s error (op: %s)", e.EType, e.Op)
-	default:
-		l.WithFields(Fields{
-			"err": fmt.Sprintf("%+v", err),
-		}).Errorf("internal error")
+		return
 	}
+	l.WithFields(Fields{
+		"err": fmt.Sprintf("%+v", err),
+	}).Errorf("internal error")
 }
 
 type Fields = logrus.Fields
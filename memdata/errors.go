@@ -0,0 +1,28 @@
+package memdata
+
+import (
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/pkg/errors"
+)
+
+func idMissingError(op string, id int64) error {
+	return messages.IdMissingError{Op: op, Id: id}
+}
+
+func versionMismatchError(op string, id int64, expected, actual int) error {
+	return messages.VersionMismatchError{Op: op, Id: id, Expected: expected, Actual: actual}
+}
+
+func versionMissingError(op string, id int64, version int) error {
+	return messages.VersionMissingError{Op: op, Id: id, Version: version}
+}
+
+func repoError(op string, err error) error {
+	return &apperrors.Error{
+		EType: apperrors.ETInternal,
+		Op:    op,
+		Err:   err,
+		Stack: errors.WithStack(err),
+	}
+}
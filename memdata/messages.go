@@ -0,0 +1,566 @@
+// Package memdata contains in-memory implementations of the domain repositories. They are intended for tests and for
+// running the application without a database, data is lost when the application exits.
+package memdata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/pkg/errors"
+)
+
+type MessageId = messages.MessageId
+type MessageVersion = messages.MessageVersion
+type Message = messages.Message
+type CreateMessage = messages.CreateMessage
+type UpdateMessage = messages.UpdateMessage
+type MessageQuery = messages.MessageQuery
+
+// MessagesRepository is an in-memory implementation of the messages.Repository interface. It is safe for concurrent
+// use.
+type MessagesRepository struct {
+	mu     sync.RWMutex
+	lastId MessageId
+	// Messages by id, including those in the trash.
+	messages map[MessageId]*Message
+	// Versions of each message ordered from oldest to newest.
+	versions map[MessageId][]Message
+}
+
+func NewMessageRepository() *MessagesRepository {
+	return &MessagesRepository{
+		messages: map[MessageId]*Message{},
+		versions: map[MessageId][]Message{},
+	}
+}
+
+const repoName = "MemMessagesRepository"
+
+// Fields the user is allowed to query.
+var queryableFields = messages.AllFields
+
+// Create creates a new message. Note that CreatedAt should be in the UTC-0 timezone.
+func (mr *MessagesRepository) Create(_ context.Context, cm CreateMessage) (MessageId, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.lastId++
+	m := Message{
+		Id:           mr.lastId,
+		Version:      1,
+		CreatedAt:    cm.CreatedAt,
+		UpdatedAt:    cm.CreatedAt,
+		Message:      cm.Message,
+		IsPalindrome: cm.IsPalindrome,
+	}
+	mr.messages[m.Id] = &m
+	mr.versions[m.Id] = []Message{m}
+	return m.Id, nil
+}
+
+// DeleteById marks a message as deleted. Deleted messages (and their versions) are kept in the trash until they are
+// permanently removed by PurgeDeleted.
+func (mr *MessagesRepository) DeleteById(_ context.Context, id MessageId, version MessageVersion) error {
+	const op = repoName + ".DeleteById"
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	m, err := mr.current(op, id, version)
+	if err != nil {
+		return err
+	}
+	now := nowUTC()
+	m.DeletedAt = &now
+	return nil
+}
+
+// UndeleteById restores a deleted message from the trash and returns its current version.
+func (mr *MessagesRepository) UndeleteById(_ context.Context, id MessageId) (MessageVersion, error) {
+	const op = repoName + ".UndeleteById"
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	m, found := mr.messages[id]
+	if !found || m.DeletedAt == nil {
+		return 0, repoError(op, idMissingError(op, id))
+	}
+	m.DeletedAt = nil
+	return m.Version, nil
+}
+
+// PurgeDeleted permanently removes messages (and their versions) that were deleted before the given time. Returns the
+// number of messages removed.
+func (mr *MessagesRepository) PurgeDeleted(_ context.Context, before time.Time) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var purged int64
+	for id, m := range mr.messages {
+		if m.DeletedAt != nil && m.DeletedAt.Before(before) {
+			delete(mr.messages, id)
+			delete(mr.versions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (mr *MessagesRepository) GetById(_ context.Context, id MessageId, m *Message) error {
+	const op = repoName + ".GetById"
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	current, err := mr.current(op, id, messages.AnyVersion)
+	if err != nil {
+		return err
+	}
+	*m = *current
+	return nil
+}
+
+// GetAllQuery retrieves the messages matching the filter of the query in the order of the query, only the fields in the
+// query are set on the returned messages. See messages.MessageQuery for how sorting and cursors are applied.
+func (mr *MessagesRepository) GetAllQuery(_ context.Context, query MessageQuery, messages *[]*Message) error {
+	const op = repoName + ".GetAllQuery"
+	_, err := mr.selectQuery(op, query, false, messages)
+	return err
+}
+
+// GetAllQueryTotal is the same as GetAllQuery, but also returns the number of messages matching the filter of the query
+// regardless of the pagination settings.
+func (mr *MessagesRepository) GetAllQueryTotal(
+	_ context.Context, query MessageQuery, messages *[]*Message,
+) (int64, error) {
+	const op = repoName + ".GetAllQueryTotal"
+	return mr.selectQuery(op, query, false, messages)
+}
+
+// GetDeletedQuery is the same as GetAllQuery, but for messages in the trash. The DeletedAt field is always retrieved.
+func (mr *MessagesRepository) GetDeletedQuery(_ context.Context, query MessageQuery, messages *[]*Message) error {
+	const op = repoName + ".GetDeletedQuery"
+	_, err := mr.selectQuery(op, query, true, messages)
+	return err
+}
+
+// GetDeletedQueryTotal is the same as GetAllQueryTotal, but for messages in the trash.
+func (mr *MessagesRepository) GetDeletedQueryTotal(
+	_ context.Context, query MessageQuery, messages *[]*Message,
+) (int64, error) {
+	const op = repoName + ".GetDeletedQueryTotal"
+	return mr.selectQuery(op, query, true, messages)
+}
+
+// Runs a query against the messages either in or out of the trash. Returns the number of messages matching the filter
+// of the query, regardless of the pagination settings.
+func (mr *MessagesRepository) selectQuery(op string, query MessageQuery, deleted bool, out *[]*Message) (int64, error) {
+	fields, err := selectedFields(op, query.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	var invalidSort []string
+	for _, k := range query.Sort {
+		if _, found := queryableFields[k.Field]; !found {
+			invalidSort = append(invalidSort, k.Field)
+		}
+	}
+	if len(invalidSort) != 0 {
+		err := fmt.Errorf("invalid messages sort fields: %s", strings.Join(invalidSort, ", "))
+		aErr := apperrors.Error{
+			EType: apperrors.ETInvalid,
+			Op:    op,
+			Err:   err,
+			Stack: errors.WithStack(err),
+		}
+		aErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeQuerySortFieldInvalid, err.Error()).
+			WithArgs(map[string]interface{}{"fields": strings.Join(invalidSort, ", ")}))
+		return 0, &aErr
+	}
+
+	keys := query.OrderKeys()
+	cursor := query.After
+	if query.Before != nil {
+		// Messages before a cursor are paged backwards from the cursor, but still returned in the sort order.
+		cursor = query.Before
+		for i := range keys {
+			keys[i].Desc = !keys[i].Desc
+		}
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var total int64
+	ids := make([]MessageId, 0, len(mr.messages))
+	for id, m := range mr.messages {
+		if (m.DeletedAt != nil) != deleted {
+			continue
+		}
+		if query.Filter != nil {
+			match, err := matchesFilter(query.Filter, m)
+			if err != nil {
+				return 0, &apperrors.Error{EType: apperrors.ETInternal, Op: op, Err: err, Stack: errors.WithStack(err)}
+			}
+			if !match {
+				continue
+			}
+		}
+		total++
+		if cursor != nil && compareMessages(keys, m, cursorMessage(cursor)) <= 0 {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return compareMessages(keys, mr.messages[ids[i]], mr.messages[ids[j]]) < 0
+	})
+
+	if query.Offset >= uint64(len(ids)) {
+		ids = nil
+	} else {
+		ids = ids[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < uint64(len(ids)) {
+		ids = ids[:query.Limit]
+	}
+	if query.Before != nil {
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	}
+
+	result := make([]*Message, len(ids))
+	for i, id := range ids {
+		result[i] = selectFields(mr.messages[id], fields)
+		if deleted {
+			deletedAt := *mr.messages[id].DeletedAt
+			result[i].DeletedAt = &deletedAt
+		}
+	}
+	*out = result
+	return total, nil
+}
+
+// Search retrieves the messages containing the text of the search (case-insensitive), see messages.HighlightSubstring.
+func (mr *MessagesRepository) Search(
+	_ context.Context, query messages.SearchQuery, results *[]*messages.SearchResult,
+) error {
+	const op = repoName + ".Search"
+
+	fields, err := selectedFields(op, query.Fields)
+	if err != nil {
+		return err
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var matches []*messages.SearchResult
+	for _, m := range mr.messages {
+		if m.DeletedAt != nil {
+			continue
+		}
+		if highlight, found := messages.HighlightSubstring(m.Message, query.Text); found {
+			matches = append(matches, &messages.SearchResult{Message: *m, Rank: 1, Highlight: highlight})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Id < matches[j].Id
+	})
+
+	if query.Offset >= uint64(len(matches)) {
+		matches = nil
+	} else {
+		matches = matches[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < uint64(len(matches)) {
+		matches = matches[:query.Limit]
+	}
+	for _, r := range matches {
+		r.Message = *selectFields(&r.Message, fields)
+	}
+	*results = matches
+	return nil
+}
+
+// Returns the fields to select, every queryable field is selected when no fields are requested. An ETInvalid error is
+// returned when a field cannot be queried.
+func selectedFields(op string, fields map[string]struct{}) (map[string]struct{}, error) {
+	if len(fields) == 0 {
+		return queryableFields, nil
+	}
+	var notFound []string
+	for field := range fields {
+		if _, found := queryableFields[field]; !found {
+			notFound = append(notFound, field)
+		}
+	}
+	if len(notFound) != 0 {
+		sort.Strings(notFound)
+		err := fmt.Errorf("invalid messages fields: %s", strings.Join(notFound, ", "))
+		aErr := apperrors.Error{
+			EType: apperrors.ETInvalid,
+			Op:    op,
+			Err:   err,
+			Stack: errors.WithStack(err),
+		}
+		aErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryFieldsInvalid, err.Error()).
+			WithArgs(map[string]interface{}{"fields": strings.Join(notFound, ", ")}))
+		return nil, &aErr
+	}
+	return fields, nil
+}
+
+// Compares two messages in the order of keys, returns a negative number when a comes first, a positive number when b
+// comes first and 0 when they are equal.
+func compareMessages(keys []messages.SortKey, a, b *Message) int {
+	for _, k := range keys {
+		c := compareField(k.Field, a, b)
+		if k.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareField(field messages.Field, a, b *Message) int {
+	switch field {
+	case messages.FieldId:
+		return compareInt(a.Id, b.Id)
+	case messages.FieldVersion:
+		return compareInt(int64(a.Version), int64(b.Version))
+	case messages.FieldCreatedAt:
+		return compareTime(a.CreatedAt, b.CreatedAt)
+	case messages.FieldUpdatedAt:
+		return compareTime(a.UpdatedAt, b.UpdatedAt)
+	case messages.FieldMessage:
+		return strings.Compare(a.Message, b.Message)
+	case messages.FieldIsPalindrome:
+		return compareBool(a.IsPalindrome, b.IsPalindrome)
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// False is ordered before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// Determines if a message matches a filter. The filter should have been validated (see messages.ValidateFilter).
+func matchesFilter(f messages.Filter, m *Message) (bool, error) {
+	switch f := f.(type) {
+	case messages.And:
+		for _, sub := range f {
+			match, err := matchesFilter(sub, m)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+		return true, nil
+	case messages.Or:
+		for _, sub := range f {
+			match, err := matchesFilter(sub, m)
+			if err != nil || match {
+				return match, err
+			}
+		}
+		return false, nil
+	case messages.Condition:
+		if f.Op == messages.FilterContains {
+			s, ok := f.Value.(string)
+			if !ok || f.Field != messages.FieldMessage {
+				return false, fmt.Errorf("invalid contains filter on %s", f.Field)
+			}
+			return strings.Contains(m.Message, s), nil
+		}
+		value, err := conditionMessage(f)
+		if err != nil {
+			return false, err
+		}
+		c := compareField(f.Field, m, value)
+		switch f.Op {
+		case messages.FilterEq:
+			return c == 0, nil
+		case messages.FilterNe:
+			return c != 0, nil
+		case messages.FilterGt:
+			return c > 0, nil
+		case messages.FilterGte:
+			return c >= 0, nil
+		case messages.FilterLt:
+			return c < 0, nil
+		case messages.FilterLte:
+			return c <= 0, nil
+		}
+		return false, fmt.Errorf("invalid filter operator %s", f.Op)
+	}
+	return false, fmt.Errorf("invalid filter %T", f)
+}
+
+// The value of a condition as a message, so it can be compared with compareField.
+func conditionMessage(c messages.Condition) (*Message, error) {
+	var m Message
+	var ok bool
+	switch c.Field {
+	case messages.FieldId:
+		m.Id, ok = c.Value.(MessageId)
+	case messages.FieldVersion:
+		m.Version, ok = c.Value.(MessageVersion)
+	case messages.FieldCreatedAt:
+		m.CreatedAt, ok = c.Value.(time.Time)
+	case messages.FieldUpdatedAt:
+		m.UpdatedAt, ok = c.Value.(time.Time)
+	case messages.FieldMessage:
+		m.Message, ok = c.Value.(string)
+	case messages.FieldIsPalindrome:
+		m.IsPalindrome, ok = c.Value.(bool)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid filter value for %s", c.Field)
+	}
+	return &m, nil
+}
+
+// The sort values of a cursor as a message, so it can be compared with compareMessages.
+func cursorMessage(c *messages.Cursor) *Message {
+	return &Message{
+		Id:           c.Id,
+		Version:      c.Version,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		Message:      c.Message,
+		IsPalindrome: c.IsPalindrome,
+	}
+}
+
+// Copies the queried fields of a message.
+func selectFields(m *Message, fields map[string]struct{}) *Message {
+	var out Message
+	if _, found := fields[messages.FieldId]; found {
+		out.Id = m.Id
+	}
+	if _, found := fields[messages.FieldVersion]; found {
+		out.Version = m.Version
+	}
+	if _, found := fields[messages.FieldCreatedAt]; found {
+		out.CreatedAt = m.CreatedAt
+	}
+	if _, found := fields[messages.FieldUpdatedAt]; found {
+		out.UpdatedAt = m.UpdatedAt
+	}
+	if _, found := fields[messages.FieldMessage]; found {
+		out.Message = m.Message
+	}
+	if _, found := fields[messages.FieldIsPalindrome]; found {
+		out.IsPalindrome = m.IsPalindrome
+	}
+	return &out
+}
+
+func (mr *MessagesRepository) UpdateById(
+	_ context.Context, id MessageId, version MessageVersion, m UpdateMessage,
+) (MessageVersion, error) {
+	const op = repoName + ".UpdateById"
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	current, err := mr.current(op, id, version)
+	if err != nil {
+		return 0, err
+	}
+	current.Version++
+	current.UpdatedAt = nowUTC()
+	current.Message = m.Message
+	current.IsPalindrome = m.IsPalindrome
+	mr.versions[id] = append(mr.versions[id], *current)
+	return current.Version, nil
+}
+
+// GetVersions retrieves every version of a message, ordered from oldest to newest.
+func (mr *MessagesRepository) GetVersions(_ context.Context, id MessageId, versions *[]*Message) error {
+	const op = repoName + ".GetVersions"
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	if _, err := mr.current(op, id, messages.AnyVersion); err != nil {
+		return err
+	}
+	stored := mr.versions[id]
+	result := make([]*Message, len(stored))
+	for i := range stored {
+		v := stored[i]
+		result[i] = &v
+	}
+	*versions = result
+	return nil
+}
+
+// GetVersion retrieves a specific version of a message.
+func (mr *MessagesRepository) GetVersion(_ context.Context, id MessageId, version MessageVersion, m *Message) error {
+	const op = repoName + ".GetVersion"
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	if _, err := mr.current(op, id, messages.AnyVersion); err != nil {
+		return err
+	}
+	for _, v := range mr.versions[id] {
+		if v.Version == version {
+			*m = v
+			return nil
+		}
+	}
+	return repoError(op, versionMissingError(op, id, version))
+}
+
+// Retrieves the stored message that is not in the trash. When version is not AnyVersion the message must also be at
+// that version, otherwise a VersionMismatchError is returned. The caller must hold the lock.
+func (mr *MessagesRepository) current(op string, id MessageId, version MessageVersion) (*Message, error) {
+	m, found := mr.messages[id]
+	if !found || m.DeletedAt != nil {
+		return nil, repoError(op, idMissingError(op, id))
+	}
+	if version != messages.AnyVersion && m.Version != version {
+		return nil, repoError(op, versionMismatchError(op, id, version, m.Version))
+	}
+	return m, nil
+}
+
+func nowUTC() time.Time {
+	return time.Now().UTC().Round(time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package memdata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/mdev5000/messageappdemo/testutil/repotest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesRepository_conformance(t *testing.T) {
+	repotest.TestMessagesRepository(t, func(t *testing.T) (messages.Repository, func()) {
+		return NewMessageRepository(), func() {}
+	})
+}
+
+func TestMessagesRepository_errorsIncludeOperation(t *testing.T) {
+	mr := NewMessageRepository()
+
+	var m Message
+	err := mr.GetById(context.Background(), 5, &m)
+	require.Equal(t, idMissingError("MemMessagesRepository.GetById", 5), errors.Unwrap(err))
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = mr.UpdateById(context.Background(), id, 2, UpdateMessage{Message: "new message"})
+	require.Equal(t, versionMismatchError("MemMessagesRepository.UpdateById", id, 2, 1), errors.Unwrap(err))
+}
+
+func TestMessagesRepository_returnedMessagesAreCopies(t *testing.T) {
+	mr := NewMessageRepository()
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	var all []*Message
+	require.NoError(t, mr.GetAllQuery(context.Background(), MessageQuery{}, &all))
+	all[0].Message = "changed"
+
+	var m Message
+	require.NoError(t, mr.GetById(context.Background(), id, &m))
+	require.Equal(t, "first message", m.Message)
+}
+
+func TestMessagesRepository_isSafeForConcurrentUse(t *testing.T) {
+	mr := NewMessageRepository()
+
+	id, err := mr.Create(context.Background(), CreateMessage{Message: "message"})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = mr.Create(context.Background(), CreateMessage{Message: "message"})
+			_, _ = mr.UpdateById(context.Background(), id, messages.AnyVersion, UpdateMessage{Message: "updated"})
+			var all []*Message
+			_ = mr.GetAllQuery(context.Background(), MessageQuery{}, &all)
+		}()
+	}
+	wg.Wait()
+
+	var m Message
+	require.NoError(t, mr.GetById(context.Background(), id, &m))
+	require.Equal(t, 21, m.Version)
+
+	var versions []*Message
+	require.NoError(t, mr.GetVersions(context.Background(), id, &versions))
+	require.Len(t, versions, 21)
+}
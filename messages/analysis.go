@@ -0,0 +1,188 @@
+package messages
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// AnalyzerIsPalindrome is whether the message is a palindrome under the palindrome options of the analysis.
+	AnalyzerIsPalindrome = "isPalindrome"
+
+	// AnalyzerWordCount is the number of words in the message, see wordCount.
+	AnalyzerWordCount = "wordCount"
+
+	// AnalyzerCharacterCount is the number of characters (runes) in the message, the same as counted for
+	// MaxMessageCharLength.
+	AnalyzerCharacterCount = "characterCount"
+
+	// AnalyzerGraphemeCount is the number of user-perceived characters (extended grapheme clusters) in the message.
+	AnalyzerGraphemeCount = "graphemeCount"
+
+	// AnalyzerScript is the name of the Unicode script most of the letters of the message are written in (ex. Latin),
+	// see unicode.Scripts. It is Common when the message has no letters.
+	AnalyzerScript = "script"
+
+	// AnalyzerLongestPalindrome is the longest palindromic substring of the message, see LongestPalindrome.
+	AnalyzerLongestPalindrome = "longestPalindrome"
+
+	// AnalyzerAnagramSignature is the sorted, lower case letters and numbers of the message. Messages that are anagrams
+	// of each other have the same signature.
+	AnalyzerAnagramSignature = "anagramSignature"
+)
+
+// AnalysisOptions are the settings shared by the analyzers of a single analysis.
+type AnalysisOptions struct {
+	Palindrome PalindromeOptions
+}
+
+// Analyzer derives a property from the text of a message. The result must be encodable as JSON.
+type Analyzer func(text string, opts AnalysisOptions) interface{}
+
+// Analysis is the result of running analyzers on a message, by analyzer name.
+type Analysis map[string]interface{}
+
+// Analyzers are the analyzers that can be requested by users, by name. New analyzers are added via RegisterAnalyzer.
+var Analyzers = map[string]Analyzer{
+	AnalyzerIsPalindrome: func(text string, opts AnalysisOptions) interface{} {
+		return opts.Palindrome.IsPalindrome(text)
+	},
+	AnalyzerWordCount: func(text string, _ AnalysisOptions) interface{} {
+		return wordCount(text)
+	},
+	AnalyzerCharacterCount: func(text string, _ AnalysisOptions) interface{} {
+		return utf8.RuneCountInString(text)
+	},
+	AnalyzerGraphemeCount: func(text string, _ AnalysisOptions) interface{} {
+		return len(graphemeClusters(text))
+	},
+	AnalyzerScript: func(text string, _ AnalysisOptions) interface{} {
+		return dominantScript(text)
+	},
+	AnalyzerLongestPalindrome: func(text string, _ AnalysisOptions) interface{} {
+		return LongestPalindrome(text)
+	},
+	AnalyzerAnagramSignature: func(text string, _ AnalysisOptions) interface{} {
+		return anagramSignature(text)
+	},
+}
+
+// RegisterAnalyzer adds an analyzer to Analyzers. It panics when an analyzer with the same name already exists, so it
+// should only be called during initialization.
+func RegisterAnalyzer(name string, analyzer Analyzer) {
+	if _, found := Analyzers[name]; found {
+		panic(fmt.Sprintf("analyzer %s is already registered", name))
+	}
+	Analyzers[name] = analyzer
+}
+
+// AnalyzerNames returns the names of every analyzer in Analyzers, sorted.
+func AnalyzerNames() []string {
+	names := make([]string, 0, len(Analyzers))
+	for name := range Analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateAnalyzers checks every name is a registered analyzer. An ETInvalid error is returned otherwise.
+func ValidateAnalyzers(op string, names []string) error {
+	for _, name := range names {
+		if _, found := Analyzers[name]; !found {
+			expected := strings.Join(AnalyzerNames(), ", ")
+			re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeAnalyzerInvalid,
+				fmt.Sprintf("invalid analyzer %s, expected one of: %s", name, expected)).
+				WithArgs(map[string]interface{}{"name": name, "expected": expected}))
+			return &re
+		}
+	}
+	return nil
+}
+
+// Analyze runs the named analyzers on text, every analyzer is run when names is empty. Names must be valid, see
+// ValidateAnalyzers.
+func Analyze(text string, names []string, opts AnalysisOptions) Analysis {
+	if len(names) == 0 {
+		names = AnalyzerNames()
+	}
+	analysis := make(Analysis, len(names))
+	for _, name := range names {
+		analysis[name] = Analyzers[name](text, opts)
+	}
+	return analysis
+}
+
+// Counts the words of text. Words are runs of letters, numbers and marks, apostrophes within a word (ex. don't) do not
+// split it.
+func wordCount(text string) int {
+	count := 0
+	inWord := false
+	for _, c := range text {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsNumber(c) || unicode.IsMark(c):
+			if !inWord {
+				count++
+			}
+			inWord = true
+		case inWord && (c == '\'' || c == '’'):
+		default:
+			inWord = false
+		}
+	}
+	return count
+}
+
+// The names of unicode.Scripts, sorted so ties are broken the same way every time.
+var scriptNames = func() []string {
+	names := make([]string, 0, len(unicode.Scripts))
+	for name := range unicode.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// Returns the script most of the letters of text are written in, ties are broken by the name of the script.
+func dominantScript(text string) string {
+	counts := map[string]int{}
+	for _, c := range text {
+		if !unicode.IsLetter(c) {
+			continue
+		}
+		for _, name := range scriptNames {
+			if unicode.Is(unicode.Scripts[name], c) {
+				counts[name]++
+				break
+			}
+		}
+	}
+
+	script := "Common"
+	max := 0
+	for _, name := range scriptNames {
+		if counts[name] > max {
+			script, max = name, counts[name]
+		}
+	}
+	return script
+}
+
+// Returns the lower case letters and numbers of text in rune order.
+func anagramSignature(text string) string {
+	var r []rune
+	for _, c := range norm.NFC.String(text) {
+		if unicode.IsLetter(c) || unicode.IsNumber(c) {
+			r = append(r, unicode.ToLower(c))
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return string(r)
+}
@@ -0,0 +1,85 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	analysis := Analyze("Listen, a silent nun", nil, AnalysisOptions{Palindrome: PalindromeModes[PalindromeModeLoose]})
+	require.Equal(t, Analysis{
+		AnalyzerAnagramSignature:  "aeeiillnnnnssttu",
+		AnalyzerCharacterCount:    20,
+		AnalyzerGraphemeCount:     20,
+		AnalyzerIsPalindrome:      false,
+		AnalyzerLongestPalindrome: PalindromeSpan{Text: " a ", Start: 7, End: 10},
+		AnalyzerScript:            "Latin",
+		AnalyzerWordCount:         4,
+	}, analysis)
+
+	analysis = Analyze("Nun", []string{AnalyzerIsPalindrome}, AnalysisOptions{})
+	require.Equal(t, Analysis{AnalyzerIsPalindrome: false}, analysis)
+}
+
+func TestValidateAnalyzers(t *testing.T) {
+	require.NoError(t, ValidateAnalyzers("op", nil))
+	require.NoError(t, ValidateAnalyzers("op", []string{AnalyzerScript, AnalyzerWordCount}))
+
+	expected := "anagramSignature, characterCount, graphemeCount, isPalindrome, longestPalindrome, script, wordCount"
+	err := ValidateAnalyzers("op", []string{AnalyzerScript, "length"})
+	require.Equal(t, &apperrors.Error{
+		Op:    "op",
+		EType: apperrors.ETInvalid,
+		Responses: []interface{}{apperrors.ErrorResponse(apperrors.CodeAnalyzerInvalid,
+			"invalid analyzer length, expected one of: "+expected).
+			WithArgs(map[string]interface{}{"name": "length", "expected": expected})},
+	}, err)
+}
+
+func TestRegisterAnalyzer(t *testing.T) {
+	RegisterAnalyzer("test", func(text string, _ AnalysisOptions) interface{} { return text })
+	defer delete(Analyzers, "test")
+
+	require.Equal(t, Analysis{"test": "a"}, Analyze("a", []string{"test"}, AnalysisOptions{}))
+	require.Panics(t, func() {
+		RegisterAnalyzer("test", func(string, AnalysisOptions) interface{} { return nil })
+	})
+}
+
+func TestWordCount(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected int
+	}{
+		{"", 0},
+		{" , ", 0},
+		{"one", 1},
+		{"don't stop", 2},
+		{"  two\twords\n", 2},
+		{"hyphen-ated", 2},
+		{"été 2021", 2},
+		{"мир и май", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			require.Equal(t, c.expected, wordCount(c.value))
+		})
+	}
+}
+
+func TestDominantScript(t *testing.T) {
+	require.Equal(t, "Common", dominantScript("123 !"))
+	require.Equal(t, "Latin", dominantScript("hello"))
+	require.Equal(t, "Cyrillic", dominantScript("привет hi"))
+	require.Equal(t, "Han", dominantScript("你好"))
+	require.Equal(t, "Cyrillic", dominantScript("ab иж"), "ties are broken by the script name")
+}
+
+func TestAnagramSignature(t *testing.T) {
+	require.Equal(t, anagramSignature("Listen"), anagramSignature("Silent!"))
+	require.Equal(t, "eilnst", anagramSignature("Listen"))
+	require.Equal(t, "", anagramSignature(" ,."))
+}
@@ -19,3 +19,45 @@ func (e IdMissingError) Is(target error) bool {
 		return false
 	}
 }
+
+// VersionMismatchError is returned by the repository when an operation expected a different version of the message
+// than the one currently stored.
+type VersionMismatchError struct {
+	Op       string
+	Id       int64
+	Expected int
+	Actual   int
+}
+
+func (e VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s: expected version %d for id %d, but was %d", e.Op, e.Expected, e.Id, e.Actual)
+}
+
+func (e VersionMismatchError) Is(target error) bool {
+	switch target.(type) {
+	case VersionMismatchError:
+		return true
+	default:
+		return false
+	}
+}
+
+// VersionMissingError is returned by the repository when a message exists, but does not have the requested version.
+type VersionMissingError struct {
+	Op      string
+	Id      int64
+	Version int
+}
+
+func (e VersionMissingError) Error() string {
+	return fmt.Sprintf("%s: no version %d for id %d", e.Op, e.Version, e.Id)
+}
+
+func (e VersionMissingError) Is(target error) bool {
+	switch target.(type) {
+	case VersionMissingError:
+		return true
+	default:
+		return false
+	}
+}
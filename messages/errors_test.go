@@ -13,3 +13,17 @@ func TestIdMissingError(t *testing.T) {
 	require.False(t, errors.Is(err, errors.New("another error")), "correctly indicates it is not other errors")
 	require.EqualError(t, err, "myrepo: no row in result with id 5")
 }
+
+func TestVersionMismatchError(t *testing.T) {
+	err := VersionMismatchError{"myrepo", 5, 2, 3}
+	require.True(t, errors.Is(err, VersionMismatchError{}))
+	require.False(t, errors.Is(err, IdMissingError{}), "correctly indicates it is not other errors")
+	require.EqualError(t, err, "myrepo: expected version 2 for id 5, but was 3")
+}
+
+func TestVersionMissingError(t *testing.T) {
+	err := VersionMissingError{"myrepo", 5, 2}
+	require.True(t, errors.Is(err, VersionMissingError{}))
+	require.False(t, errors.Is(err, IdMissingError{}), "correctly indicates it is not other errors")
+	require.EqualError(t, err, "myrepo: no version 2 for id 5")
+}
@@ -0,0 +1,193 @@
+package messages
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+)
+
+// FilterOp is the comparison operator of a filter Condition.
+type FilterOp = string
+
+const (
+	FilterEq       FilterOp = "eq"
+	FilterNe       FilterOp = "ne"
+	FilterGt       FilterOp = "gt"
+	FilterGte      FilterOp = "gte"
+	FilterLt       FilterOp = "lt"
+	FilterLte      FilterOp = "lte"
+	FilterContains FilterOp = "contains"
+)
+
+// Operators supported by each field. Message text can only be compared for (in)equality or searched as the ordering of
+// text differs between repositories.
+var filterOps = map[Field]map[FilterOp]struct{}{
+	FieldId:           orderedOps,
+	FieldVersion:      orderedOps,
+	FieldCreatedAt:    orderedOps,
+	FieldUpdatedAt:    orderedOps,
+	FieldMessage:      {FilterEq: {}, FilterNe: {}, FilterContains: {}},
+	FieldIsPalindrome: {FilterEq: {}, FilterNe: {}},
+}
+
+var orderedOps = map[FilterOp]struct{}{
+	FilterEq: {}, FilterNe: {}, FilterGt: {}, FilterGte: {}, FilterLt: {}, FilterLte: {},
+}
+
+// Filter is a node of a predicate tree that messages must match to be included in the results of a query. It is either
+// a Condition, And or Or.
+type Filter interface {
+	filter()
+}
+
+// Condition matches messages where the value of Field compares to Value using Op, ex. createdAt gte 2021-05-01. The
+// type of Value must match the field: MessageId for id, MessageVersion for version, time.Time for createdAt and
+// updatedAt, string for message and bool for isPalindrome. Contains matches messages that include Value
+// (case-sensitive).
+type Condition struct {
+	Field Field
+	Op    FilterOp
+	Value interface{}
+}
+
+// And matches messages that match every filter, an empty And matches every message.
+type And []Filter
+
+// Or matches messages that match any of the filters, an empty Or matches no message.
+type Or []Filter
+
+func (Condition) filter() {}
+func (And) filter()       {}
+func (Or) filter()        {}
+
+// ParseCondition creates a Condition from a value in text form. Ids and versions are integers, times are in RFC 3339
+// format and isPalindrome is true or false. An ETInvalid error is returned when the field, operator or value are
+// invalid.
+func ParseCondition(op string, field Field, filterOp FilterOp, value string) (Condition, error) {
+	c := Condition{Field: field, Op: filterOp}
+	if err := validateConditionOp(op, c); err != nil {
+		return c, err
+	}
+
+	var err error
+	switch field {
+	case FieldId:
+		c.Value, err = strconv.ParseInt(value, 10, 64)
+	case FieldVersion:
+		c.Value, err = strconv.Atoi(value)
+	case FieldCreatedAt, FieldUpdatedAt:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, value)
+		c.Value = t.UTC()
+		if err != nil {
+			return c, filterError(op, apperrors.CodeFilterValueInvalid,
+				fmt.Sprintf("invalid filter value for %s, expected an RFC 3339 time", field),
+				map[string]interface{}{"field": field, "type": "time"})
+		}
+	case FieldMessage:
+		c.Value = value
+	case FieldIsPalindrome:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		c.Value = b
+		if err != nil {
+			return c, filterError(op, apperrors.CodeFilterValueInvalid,
+				fmt.Sprintf("invalid filter value for %s, expected true or false", field),
+				map[string]interface{}{"field": field, "type": "boolean"})
+		}
+	}
+	if err != nil {
+		return c, filterError(op, apperrors.CodeFilterValueInvalid,
+			fmt.Sprintf("invalid filter value for %s, expected an integer", field),
+			map[string]interface{}{"field": field, "type": "integer"})
+	}
+	return c, nil
+}
+
+// ValidateFilter checks the fields, operators and value types of every Condition in a filter. An ETInvalid error is
+// returned when the filter is invalid.
+func ValidateFilter(op string, f Filter) error {
+	switch f := f.(type) {
+	case And:
+		return validateFilters(op, f)
+	case Or:
+		return validateFilters(op, f)
+	case Condition:
+		if err := validateConditionOp(op, f); err != nil {
+			return err
+		}
+		var ok bool
+		switch f.Field {
+		case FieldId:
+			_, ok = f.Value.(MessageId)
+		case FieldVersion:
+			_, ok = f.Value.(MessageVersion)
+		case FieldCreatedAt, FieldUpdatedAt:
+			_, ok = f.Value.(time.Time)
+		case FieldMessage:
+			_, ok = f.Value.(string)
+		case FieldIsPalindrome:
+			_, ok = f.Value.(bool)
+		}
+		if !ok {
+			return filterError(op, apperrors.CodeFilterValueInvalid,
+				fmt.Sprintf("invalid filter value for %s", f.Field),
+				map[string]interface{}{"field": f.Field, "type": ""})
+		}
+		return nil
+	}
+	return filterError(op, apperrors.CodeFilterInvalid, fmt.Sprintf("invalid filter %T", f),
+		map[string]interface{}{"filter": fmt.Sprintf("%T", f)})
+}
+
+// Returns whether a filter has a condition on the field.
+func filterHasField(f Filter, field Field) bool {
+	switch f := f.(type) {
+	case Condition:
+		return f.Field == field
+	case And:
+		for _, sub := range f {
+			if filterHasField(sub, field) {
+				return true
+			}
+		}
+	case Or:
+		for _, sub := range f {
+			if filterHasField(sub, field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateFilters(op string, filters []Filter) error {
+	for _, f := range filters {
+		if err := ValidateFilter(op, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateConditionOp(op string, c Condition) error {
+	ops, found := filterOps[c.Field]
+	if !found {
+		return filterError(op, apperrors.CodeFilterFieldInvalid, fmt.Sprintf("invalid filter field: %s", c.Field),
+			map[string]interface{}{"field": c.Field})
+	}
+	if _, found := ops[c.Op]; !found {
+		return filterError(op, apperrors.CodeFilterOperatorInvalid,
+			fmt.Sprintf("invalid filter operator for %s: %s", c.Field, c.Op),
+			map[string]interface{}{"field": c.Field, "op": c.Op})
+	}
+	return nil
+}
+
+func filterError(op, code, msg string, args map[string]interface{}) error {
+	re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+	re.AddResponse(apperrors.ErrorResponse(code, msg).WithArgs(args))
+	return &re
+}
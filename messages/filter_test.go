@@ -0,0 +1,98 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	c, err := ParseCondition("", FieldId, FilterGt, "5")
+	require.NoError(t, err)
+	require.Equal(t, Condition{Field: FieldId, Op: FilterGt, Value: MessageId(5)}, c)
+
+	c, err = ParseCondition("", FieldVersion, FilterEq, "2")
+	require.NoError(t, err)
+	require.Equal(t, Condition{Field: FieldVersion, Op: FilterEq, Value: MessageVersion(2)}, c)
+
+	c, err = ParseCondition("", FieldCreatedAt, FilterGte, "2021-05-01T10:00:00+02:00")
+	require.NoError(t, err)
+	require.Equal(t, Condition{
+		Field: FieldCreatedAt, Op: FilterGte, Value: time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC),
+	}, c)
+
+	c, err = ParseCondition("", FieldMessage, FilterContains, "hello")
+	require.NoError(t, err)
+	require.Equal(t, Condition{Field: FieldMessage, Op: FilterContains, Value: "hello"}, c)
+
+	c, err = ParseCondition("", FieldIsPalindrome, FilterEq, "true")
+	require.NoError(t, err)
+	require.Equal(t, Condition{Field: FieldIsPalindrome, Op: FilterEq, Value: true}, c)
+}
+
+func TestParseCondition_errors(t *testing.T) {
+	cases := []struct {
+		field    Field
+		op       FilterOp
+		value    string
+		code     string
+		expected string
+		args     map[string]interface{}
+	}{
+		{"notAField", FilterEq, "1", apperrors.CodeFilterFieldInvalid, "invalid filter field: notAField",
+			map[string]interface{}{"field": "notAField"}},
+		{FieldId, "like", "1", apperrors.CodeFilterOperatorInvalid, "invalid filter operator for id: like",
+			map[string]interface{}{"field": FieldId, "op": "like"}},
+		{FieldId, FilterContains, "1", apperrors.CodeFilterOperatorInvalid, "invalid filter operator for id: contains",
+			map[string]interface{}{"field": FieldId, "op": FilterContains}},
+		{FieldMessage, FilterGt, "a", apperrors.CodeFilterOperatorInvalid, "invalid filter operator for message: gt",
+			map[string]interface{}{"field": FieldMessage, "op": FilterGt}},
+		{FieldId, FilterEq, "one", apperrors.CodeFilterValueInvalid,
+			"invalid filter value for id, expected an integer",
+			map[string]interface{}{"field": FieldId, "type": "integer"}},
+		{FieldVersion, FilterEq, "1.5", apperrors.CodeFilterValueInvalid,
+			"invalid filter value for version, expected an integer",
+			map[string]interface{}{"field": FieldVersion, "type": "integer"}},
+		{FieldUpdatedAt, FilterLt, "yesterday", apperrors.CodeFilterValueInvalid,
+			"invalid filter value for updatedAt, expected an RFC 3339 time",
+			map[string]interface{}{"field": FieldUpdatedAt, "type": "time"}},
+		{FieldIsPalindrome, FilterGt, "true", apperrors.CodeFilterOperatorInvalid,
+			"invalid filter operator for isPalindrome: gt",
+			map[string]interface{}{"field": FieldIsPalindrome, "op": FilterGt}},
+		{FieldIsPalindrome, FilterEq, "yes", apperrors.CodeFilterValueInvalid,
+			"invalid filter value for isPalindrome, expected true or false",
+			map[string]interface{}{"field": FieldIsPalindrome, "type": "boolean"}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.expected, func(t *testing.T) {
+			_, err := ParseCondition("", c.field, c.op, c.value)
+			requireHasResponseErrors(t, err, apperrors.ErrorResponse(c.code, c.expected).WithArgs(c.args))
+		})
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	valid := And{
+		Condition{Field: FieldId, Op: FilterEq, Value: MessageId(1)},
+		Or{
+			Condition{Field: FieldCreatedAt, Op: FilterLt, Value: time.Now()},
+			Condition{Field: FieldMessage, Op: FilterContains, Value: "a"},
+		},
+	}
+	require.NoError(t, ValidateFilter("", valid))
+
+	invalid := And{
+		Condition{Field: FieldId, Op: FilterEq, Value: MessageId(1)},
+		Or{Condition{Field: FieldVersion, Op: FilterEq, Value: "1"}},
+	}
+	requireHasResponseErrors(t, ValidateFilter("", invalid),
+		apperrors.ErrorResponse(apperrors.CodeFilterValueInvalid, "invalid filter value for version").
+			WithArgs(map[string]interface{}{"field": FieldVersion, "type": ""}))
+
+	requireHasResponseErrors(t, ValidateFilter("", Condition{Field: FieldMessage, Op: FilterLte, Value: "a"}),
+		apperrors.ErrorResponse(apperrors.CodeFilterOperatorInvalid, "invalid filter operator for message: lte").
+			WithArgs(map[string]interface{}{"field": FieldMessage, "op": FilterLte}))
+}
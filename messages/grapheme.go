@@ -0,0 +1,26 @@
+package messages
+
+import (
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// Splits text into extended grapheme clusters (user-perceived characters, see UAX #29), ex. "🤦🏼‍♂️" or "🇨🇦" are
+// single clusters. The segmentation is done by uniseg, which is generated from the Unicode character database.
+func graphemeClusters(text string) []string {
+	var clusters []string
+	state := -1
+	for text != "" {
+		var cluster string
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// Returns the first rune of s.
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
@@ -0,0 +1,114 @@
+package messages
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphemeClusters(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"empty string", "", nil},
+		{"letters", "abc", []string{"a", "b", "c"}},
+		{"combining character", "e\u0301a", []string{"e\u0301", "a"}},
+		{"CR LF", "a\r\nb", []string{"a", "\r\n", "b"}},
+		{"LF CR", "\n\r", []string{"\n", "\r"}},
+		{"controls", "a\u0000\u0301", []string{"a", "\u0000", "\u0301"}},
+		{"hangul jamo", "\u1100\u1161\u11A8\u1100", []string{"\u1100\u1161\u11A8", "\u1100"}},
+		{"hangul syllables", "한국", []string{"한", "국"}},
+		{"prepend", "\u0600a", []string{"\u0600a"}},
+		{"spacing mark", "\u0915\u093F", []string{"\u0915\u093F"}},
+		{"emoji modifier", "\u261D\U0001F3FD", []string{"\u261D\U0001F3FD"}},
+		{"emoji zwj sequence",
+			"\U0001F926\U0001F3FC\u200D\u2642\uFE0F\U0001F44D",
+			[]string{"\U0001F926\U0001F3FC\u200D\u2642\uFE0F", "\U0001F44D"}},
+		{"family", "\U0001F468\u200D\U0001F469\u200D\U0001F467", []string{"\U0001F468\u200D\U0001F469\u200D\U0001F467"}},
+		{"zwj only joins pictographs", "a\u200Db", []string{"a\u200D", "b"}},
+		{"flags", "\U0001F1E8\U0001F1E6\U0001F1FA\U0001F1F8\U0001F1FA",
+			[]string{"\U0001F1E8\U0001F1E6", "\U0001F1FA\U0001F1F8", "\U0001F1FA"}},
+		{"subdivision flag",
+			"\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F",
+			[]string{"\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F"}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, graphemeClusters(c.value))
+		})
+	}
+}
+
+// Runs the test cases of the Unicode character database, see testdata/GraphemeBreakTest.txt for the format.
+func TestGraphemeClusters_unicodeTestCases(t *testing.T) {
+	f, err := os.Open("testdata/GraphemeBreakTest.txt")
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var text, cluster strings.Builder
+		var expected []string
+		for _, field := range strings.Fields(line) {
+			switch field {
+			case "÷":
+				if cluster.Len() > 0 {
+					expected = append(expected, cluster.String())
+					cluster.Reset()
+				}
+			case "×":
+			default:
+				r, err := strconv.ParseUint(field, 16, 32)
+				require.NoError(t, err, "line %d", lineNo)
+				text.WriteRune(rune(r))
+				cluster.WriteRune(rune(r))
+			}
+		}
+		require.Equal(t, expected, graphemeClusters(text.String()), "line %d: %s", lineNo, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+}
+
+func TestPalindromeOptions_IsPalindrome_graphemes(t *testing.T) {
+	graphemes := PalindromeModes[PalindromeModeGraphemes]
+	facepalm := "\U0001F926\U0001F3FC\u200D\u2642\uFE0F"
+	canada := "\U0001F1E8\U0001F1E6"
+	cases := []struct {
+		name     string
+		opts     PalindromeOptions
+		value    string
+		expected bool
+	}{
+		{"emoji sequence", graphemes, facepalm, true},
+		{"emoji sequences", graphemes, facepalm + "\U0001F44D" + facepalm, true},
+		{"flags", graphemes, canada + "a" + canada, true},
+		{"flags are not reversed", graphemes, "\U0001F1E8\U0001F1E6\U0001F1E6\U0001F1E8", false},
+		{"runes of flags are reversed when strict", PalindromeOptions{}, "\U0001F1E8\U0001F1E6\U0001F1E6\U0001F1E8", true},
+		{"letters", graphemes, "abcba", true},
+		{"not a palindrome", graphemes, facepalm + "\U0001F44D", false},
+		{"loose graphemes",
+			PalindromeOptions{Graphemes: true, IgnoreCase: true, IgnoreWhitespace: true, IgnorePunctuation: true},
+			"Ab " + facepalm + ", bA", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, c.opts.IsPalindrome(c.value))
+		})
+	}
+}
@@ -2,6 +2,7 @@
 package messages
 
 import (
+	"context"
 	"time"
 )
 
@@ -13,6 +14,10 @@ const (
 	// multiple characters (ex. "🤦🏼‍♂️", paste into https://fsymbols.com/emoticons/maker/ to understand).
 	// Also see https://hsivonen.fi/string-length/.
 	MaxMessageCharLength = 512
+
+	// AnyVersion can be passed as the expected version of a message to indicate an operation should be applied
+	// regardless of the current version of the message.
+	AnyVersion MessageVersion = 0
 )
 
 type Field = string
@@ -23,29 +28,81 @@ const (
 	FieldMessage   = "message"
 	FieldCreatedAt = "createdAt"
 	FieldUpdatedAt = "updatedAt"
+
+	// FieldIsPalindrome is whether the message is a palindrome, see IsPalindrome.
+	FieldIsPalindrome = "isPalindrome"
+
+	// FieldLongestPalindrome is the longest palindromic part of the message, see LongestPalindrome. It is not stored, so
+	// it is only included by Service.List (and Service.ListDeleted) when requested and cannot be filtered or sorted by.
+	FieldLongestPalindrome = "longestPalindrome"
 )
 
 var AllFields = map[string]struct{}{
-	FieldId:        {},
-	FieldVersion:   {},
-	FieldMessage:   {},
-	FieldCreatedAt: {},
-	FieldUpdatedAt: {},
+	FieldId:           {},
+	FieldVersion:      {},
+	FieldMessage:      {},
+	FieldCreatedAt:    {},
+	FieldUpdatedAt:    {},
+	FieldIsPalindrome: {},
 }
 
 type CreateMessage struct {
 	Message string `db:"message"`
 
+	// IsPalindrome is whether Message is a palindrome, see IsPalindrome.
+	IsPalindrome bool `db:"is_palindrome"`
+
 	// CreatedAt is only used for creation of a message and will be ignored for update operations.
 	CreatedAt time.Time `db:"created_at"`
 }
 
+// Repository is the storage interface for messages.
+//
+// Every operation takes the context of the request it is part of, the store should stop the operation when the context
+// is done.
+//
+// DeleteById and UpdateById take the version of the message the caller expects to be current. When the version is not
+// AnyVersion the operation must only be applied if the stored message has that exact version (checked atomically with
+// the change), otherwise a VersionMismatchError is returned. When the message does not exist an IdMissingError is
+// returned.
+//
+// Every created or updated version of a message is recorded in the same operation as the change, so it can later be
+// retrieved via GetVersions and GetVersion.
+//
+// DeleteById does not remove a message, but moves it to the trash by setting DeletedAt. Messages in the trash are
+// treated as missing by every operation except GetDeletedQuery, UndeleteById and PurgeDeleted. PurgeDeleted
+// permanently removes messages (and their versions) deleted before the given time.
+//
+// GetAllQueryTotal and GetDeletedQueryTotal also return the number of messages matching the filter of the query,
+// ignoring the cursors and pagination settings. They should do so without an additional round trip to the store where
+// possible.
+//
+// Search returns the messages (not in the trash) matching the text of a search, ordered from the most to the least
+// relevant and then by id. Repositories with a full-text index match messages by the words of the text (ex. stemmed
+// words) and rank them by how well they match. Repositories without a text index fall back to a case-insensitive
+// substring match of the whole text (see HighlightSubstring), where every matching message has a rank of 1.
 type Repository interface {
-	Create(cm CreateMessage) (MessageId, error)
-	DeleteById(id MessageId) error
-	GetAllQuery(query MessageQuery, messages *[]*Message) error
-	GetById(id MessageId, m *Message) error
-	UpdateById(id MessageId, m ModifyMessage) (MessageVersion, error)
+	Create(ctx context.Context, cm CreateMessage) (MessageId, error)
+	DeleteById(ctx context.Context, id MessageId, version MessageVersion) error
+	GetAllQuery(ctx context.Context, query MessageQuery, messages *[]*Message) error
+	GetAllQueryTotal(ctx context.Context, query MessageQuery, messages *[]*Message) (int64, error)
+	GetById(ctx context.Context, id MessageId, m *Message) error
+	GetDeletedQuery(ctx context.Context, query MessageQuery, messages *[]*Message) error
+	GetDeletedQueryTotal(ctx context.Context, query MessageQuery, messages *[]*Message) (int64, error)
+	GetVersion(ctx context.Context, id MessageId, version MessageVersion, m *Message) error
+	GetVersions(ctx context.Context, id MessageId, versions *[]*Message) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	Search(ctx context.Context, query SearchQuery, results *[]*SearchResult) error
+	UndeleteById(ctx context.Context, id MessageId) (MessageVersion, error)
+	UpdateById(ctx context.Context, id MessageId, version MessageVersion, m UpdateMessage) (MessageVersion, error)
+}
+
+// UpdateMessage is the new content of a message stored by Repository.UpdateById.
+type UpdateMessage struct {
+	Message string
+
+	// IsPalindrome is whether Message is a palindrome, see IsPalindrome.
+	IsPalindrome bool
 }
 
 type ModifyMessage struct {
@@ -61,14 +118,128 @@ type Message struct {
 	CreatedAt time.Time      `db:"created_at"`
 	UpdatedAt time.Time      `db:"updated_at"`
 	Message   string         `db:"message"`
+
+	// IsPalindrome is whether Message is a palindrome. It is determined when the message is created or updated.
+	IsPalindrome bool `db:"is_palindrome"`
+
+	// DeletedAt is the time the message was moved to the trash. It is only set for messages retrieved from the trash.
+	DeletedAt *time.Time `db:"deleted_at"`
+
+	// LongestPalindrome is the longest palindromic part of Message, it is only set when requested via
+	// FieldLongestPalindrome.
+	LongestPalindrome *PalindromeSpan `db:"-"`
+
+	// Analysis is the result of the analyzers requested for the message, see MessageQuery.Analyzers and Service.Analyze.
+	// It is not stored.
+	Analysis Analysis `db:"-"`
 }
 
 // MessageQuery holds information for running a query against the messages store. Specifically it limits what fields
-// are returned and determines the pagination settings for the data.
+// are returned and determines the filtering, sorting and pagination settings for the data.
+//
+// Only messages matching Filter are included, every message is included when it is nil.
+//
+// Messages are ordered by the Sort keys, ties (and every message when Sort is empty) are ordered by id, see OrderKeys.
+// When After is set only messages following the cursor are returned, when Before is set only the messages preceding the
+// cursor are returned (the last Limit of them, still in the sort order).
 type MessageQuery struct {
 	Fields map[Field]struct{}
+	Filter Filter
+	Sort   []SortKey
 	Limit  uint64
 	Offset uint64
+	After  *Cursor
+	Before *Cursor
+
+	// IncludeTotal determines whether Service.List (and Service.ListDeleted) count the messages matching the filter, see
+	// MessagePage.Total. It is not used by repositories.
+	IncludeTotal bool
+
+	// Palindrome determines how Service.List (and Service.ListDeleted) determine the isPalindrome field of the messages.
+	// Unless it is strict, the field is determined from the message text rather than the stored value and cannot be
+	// filtered or sorted by. It is not used by repositories.
+	Palindrome PalindromeOptions
+
+	// Analyzers are the names of the analyzers Service.List (and Service.ListDeleted) run on the messages, see
+	// Message.Analysis. No analyzers are run when it is empty. It is not used by repositories.
+	Analyzers []string
+}
+
+// SortKey orders messages by a field, in descending order when Desc is true.
+type SortKey struct {
+	Field Field
+	Desc  bool
+}
+
+// OrderKeys returns the keys the results of the query are ordered by. These are the Sort keys followed by the id
+// (unless the query is already sorted by id) so the order is always the same for messages with equal sort values.
+func (q MessageQuery) OrderKeys() []SortKey {
+	keys := make([]SortKey, 0, len(q.Sort)+1)
+	hasId := false
+	for _, k := range q.Sort {
+		keys = append(keys, k)
+		if k.Field == FieldId {
+			hasId = true
+		}
+	}
+	if !hasId {
+		keys = append(keys, SortKey{Field: FieldId})
+	}
+	return keys
+}
+
+// Cursor is a position within the ordered list of messages. It holds the sort values of the message at the position,
+// only the values of the fields the query is ordered by (see MessageQuery.OrderKeys) are used.
+type Cursor struct {
+	Id           MessageId
+	Version      MessageVersion
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Message      string
+	IsPalindrome bool
+}
+
+// CursorAt creates a cursor positioned at a message.
+func CursorAt(m *Message) *Cursor {
+	return &Cursor{
+		Id:           m.Id,
+		Version:      m.Version,
+		CreatedAt:    m.CreatedAt,
+		UpdatedAt:    m.UpdatedAt,
+		Message:      m.Message,
+		IsPalindrome: m.IsPalindrome,
+	}
+}
+
+// Value returns the value of a field at the position of the cursor, or nil when the field does not exist.
+func (c *Cursor) Value(field Field) interface{} {
+	switch field {
+	case FieldId:
+		return c.Id
+	case FieldVersion:
+		return c.Version
+	case FieldCreatedAt:
+		return c.CreatedAt
+	case FieldUpdatedAt:
+		return c.UpdatedAt
+	case FieldMessage:
+		return c.Message
+	case FieldIsPalindrome:
+		return c.IsPalindrome
+	}
+	return nil
+}
+
+// MessagePage is a single page of a message listing. Next and Prev are the cursors for the following and preceding
+// pages, they are nil when there is no such page.
+type MessagePage struct {
+	Messages []*Message
+	Next     *Cursor
+	Prev     *Cursor
+
+	// Total is the number of messages matching the filter of the query across all pages. It is only set when the query
+	// has IncludeTotal set.
+	Total int64
 }
 
 // IsPalindrome determines if a Message is a palindrome.
@@ -82,10 +253,12 @@ type MessageQuery struct {
 // (ex. éé).
 //
 // The implementation assumes extended grapheme clusters (ex. "🤦🏼‍♂️") are not palindromes. In general,  whether emojis
-// are palindromes or not is left largely undefined.
+// are palindromes or not is left largely undefined. Messages can instead be compared by user-perceived characters via
+// PalindromeOptions.Graphemes (ex. the PalindromeModeGraphemes mode).
 //
-// There is no special handling for hidden characters. This may confuse users, so might be worth adjusting in the
-// future.
+// There is no special handling for hidden characters, case, punctuation or whitespace. These can be ignored via
+// PalindromeOptions (ex. the PalindromeModeLoose mode), but the stored isPalindrome value of messages always uses this
+// strict rule.
 //
 func IsPalindrome(msg *Message) bool {
 	return isPalindrome(msg.Message)
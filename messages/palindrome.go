@@ -1,9 +1,153 @@
 package messages
 
-import "golang.org/x/text/unicode/norm"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// PalindromeOptions determine which differences are ignored when determining if a message is a palindrome. The zero
+// value ignores nothing (beyond the NFC normalization, see IsPalindrome) and is the rule used for the isPalindrome
+// value stored with each message.
+type PalindromeOptions struct {
+	// IgnoreCase compares letters regardless of their case, ex. Aa.
+	IgnoreCase bool
+
+	// IgnorePunctuation skips punctuation characters (Unicode category P), ex. a,a.
+	IgnorePunctuation bool
+
+	// IgnoreWhitespace skips white space characters, ex. "a a".
+	IgnoreWhitespace bool
+
+	// IgnoreFormat skips hidden format characters (Unicode category Cf), ex. the zero width space U+200B.
+	IgnoreFormat bool
+
+	// StripDiacritics removes the diacritics (combining diacritical marks after NFD decomposition, see diacritics) from
+	// letters, ex. éa treated as ea.
+	StripDiacritics bool
+
+	// Graphemes compares user-perceived characters (extended grapheme clusters, see UAX #29) rather than runes, so emoji
+	// sequences (ex. "🤦🏼‍♂️"), flags and letters with combining marks are each treated as a single character. Clusters
+	// starting with an ignored character are ignored as a whole.
+	Graphemes bool
+}
+
+const (
+	// PalindromeModeStrict ignores nothing, see PalindromeOptions.
+	PalindromeModeStrict = "strict"
+
+	// PalindromeModeGraphemes ignores nothing, but compares user-perceived characters rather than runes, so "🇨🇦🇨🇦"
+	// or "🤦🏼‍♂️👍🤦🏼‍♂️" are palindromes.
+	PalindromeModeGraphemes = "graphemes"
+
+	// PalindromeModeLoose ignores case, punctuation, whitespace, format characters and diacritics, so sentences like
+	// "A man, a plan, a canal: Panama" are palindromes.
+	PalindromeModeLoose = "loose"
+)
+
+// PalindromeModes are the named PalindromeOptions that can be selected by users.
+var PalindromeModes = map[string]PalindromeOptions{
+	PalindromeModeStrict:    {},
+	PalindromeModeGraphemes: {Graphemes: true},
+	PalindromeModeLoose: {
+		IgnoreCase:        true,
+		IgnorePunctuation: true,
+		IgnoreWhitespace:  true,
+		IgnoreFormat:      true,
+		StripDiacritics:   true,
+	},
+}
+
+// Combining diacritical marks removed by PalindromeOptions.StripDiacritics. Other nonspacing marks, ex. variation
+// selectors (U+FE0F in emoji such as 1️⃣ or ❤️), the marks for symbols (U+20D0-U+20FF) or the vowel signs of other
+// scripts, change the character they follow so are kept.
+var diacritics = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0300, Hi: 0x036f, Stride: 1}, // Combining Diacritical Marks
+		{Lo: 0x1ab0, Hi: 0x1aff, Stride: 1}, // Combining Diacritical Marks Extended
+		{Lo: 0x1dc0, Hi: 0x1dff, Stride: 1}, // Combining Diacritical Marks Supplement
+		{Lo: 0xfe20, Hi: 0xfe2f, Stride: 1}, // Combining Half Marks
+	},
+}
+
+// ParsePalindromeMode returns the options of a named palindrome mode, see PalindromeModes. An ETInvalid error is
+// returned when the mode does not exist.
+func ParsePalindromeMode(op, mode string) (PalindromeOptions, error) {
+	opts, found := PalindromeModes[mode]
+	if !found {
+		names := make([]string, 0, len(PalindromeModes))
+		for name := range PalindromeModes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		expected := strings.Join(names, ", ")
+		re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodePalindromeModeInvalid,
+			fmt.Sprintf("invalid palindrome mode %s, expected one of: %s", mode, expected)).
+			WithArgs(map[string]interface{}{"mode": mode, "expected": expected}))
+		return opts, &re
+	}
+	return opts, nil
+}
+
+// IsStrict returns whether the options ignore nothing, meaning they match the stored isPalindrome value of messages.
+func (o PalindromeOptions) IsStrict() bool {
+	return o == PalindromeOptions{}
+}
+
+// IsPalindrome determines if text is a palindrome under the options. See IsPalindrome for the handling of
+// normalization and grapheme clusters.
+func (o PalindromeOptions) IsPalindrome(text string) bool {
+	var r []rune
+	if o.StripDiacritics {
+		for _, c := range norm.NFD.String(text) {
+			if !unicode.Is(diacritics, c) {
+				r = append(r, c)
+			}
+		}
+		r = []rune(norm.NFC.String(string(r)))
+	} else {
+		r = []rune(norm.NFC.String(text))
+	}
+
+	if o.Graphemes {
+		var chars []string
+		for _, c := range graphemeClusters(string(r)) {
+			if o.ignored(firstRune(c)) {
+				continue
+			}
+			if o.IgnoreCase {
+				c = strings.Map(foldRune, c)
+			}
+			chars = append(chars, c)
+		}
+		for start, end := 0, len(chars)-1; start < end; start, end = start+1, end-1 {
+			if chars[start] != chars[end] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if o.IgnoreCase || o.IgnorePunctuation || o.IgnoreWhitespace || o.IgnoreFormat {
+		kept := r[:0]
+		for _, c := range r {
+			switch {
+			case o.ignored(c):
+			case o.IgnoreCase:
+				kept = append(kept, foldRune(c))
+			default:
+				kept = append(kept, c)
+			}
+		}
+		r = kept
+	}
 
-func isPalindrome(msg string) bool {
-	r := []rune(norm.NFC.String(msg))
 	for start, end := 0, len(r)-1; start < end; start, end = start+1, end-1 {
 		if r[start] != r[end] {
 			return false
@@ -11,3 +155,135 @@ func isPalindrome(msg string) bool {
 	}
 	return true
 }
+
+// Returns whether a rune is skipped under the options.
+func (o PalindromeOptions) ignored(c rune) bool {
+	return o.IgnorePunctuation && unicode.IsPunct(c) ||
+		o.IgnoreWhitespace && unicode.IsSpace(c) ||
+		o.IgnoreFormat && unicode.Is(unicode.Cf, c)
+}
+
+// Returns the same rune for every case of a letter, the smallest rune of its Unicode simple case folding orbit.
+func foldRune(c rune) rune {
+	min := c
+	for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+// PalindromeSpan is a palindromic part of a message text. Start and End (exclusive) are the character (rune) offsets of
+// the part within the original text, Text is the part of the original text.
+type PalindromeSpan struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// LongestPalindrome finds the longest palindromic part of text in linear time using Manacher's algorithm. The first is
+// returned when there are several of the same length.
+//
+// The same as IsPalindrome the text is compared after being encoded into NFC, the span is then mapped back to the
+// original text. When normalization changed a character (ex. a letter followed by a combining character) the span
+// includes the whole of the original character.
+func LongestPalindrome(text string) PalindromeSpan {
+	// The normalized runes and the byte range of the original text each came from. The text is normalized one segment
+	// (a starter and the characters combining with it) at a time, the runes of a segment changed by normalization all
+	// come from the whole of the original segment.
+	var runes []rune
+	var starts, ends []int
+	for start := 0; start < len(text); {
+		end := start + norm.NFC.NextBoundaryInString(text[start:], true)
+		if end <= start {
+			end = len(text)
+		}
+		segment := text[start:end]
+		if normalized := norm.NFC.String(segment); normalized != segment {
+			for _, c := range normalized {
+				runes = append(runes, c)
+				starts = append(starts, start)
+				ends = append(ends, end)
+			}
+		} else {
+			for i := start; i < end; {
+				c, size := utf8.DecodeRuneInString(text[i:end])
+				runes = append(runes, c)
+				starts = append(starts, i)
+				ends = append(ends, i+size)
+				i += size
+			}
+		}
+		start = end
+	}
+
+	start, length := manacher(runes)
+	if length == 0 {
+		return PalindromeSpan{}
+	}
+	byteStart, byteEnd := starts[start], ends[start+length-1]
+	runeStart := utf8.RuneCountInString(text[:byteStart])
+	return PalindromeSpan{
+		Text:  text[byteStart:byteEnd],
+		Start: runeStart,
+		End:   runeStart + utf8.RuneCountInString(text[byteStart:byteEnd]),
+	}
+}
+
+// Returns the start and length of the first longest palindrome in r. For each center the radius of the palindrome is
+// initialized from its mirror within the rightmost palindrome found so far, so each rune is compared a constant number
+// of times on average. Odd and even length palindromes are found in separate passes.
+func manacher(r []rune) (start, length int) {
+	n := len(r)
+
+	// odd[i] is the radius (including i) of the longest palindrome centered on rune i.
+	odd := make([]int, n)
+	for i, left, right := 0, 0, -1; i < n; i++ {
+		k := 1
+		if i <= right {
+			k = minInt(odd[left+right-i], right-i+1)
+		}
+		for i-k >= 0 && i+k < n && r[i-k] == r[i+k] {
+			k++
+		}
+		odd[i] = k
+		if i+k-1 > right {
+			left, right = i-k+1, i+k-1
+		}
+		if 2*k-1 > length {
+			start, length = i-k+1, 2*k-1
+		}
+	}
+
+	// even[i] is the radius of the longest palindrome centered between rune i-1 and rune i.
+	even := make([]int, n)
+	for i, left, right := 0, 0, -1; i < n; i++ {
+		k := 0
+		if i <= right {
+			k = minInt(even[left+right-i+1], right-i+1)
+		}
+		for i-k-1 >= 0 && i+k < n && r[i-k-1] == r[i+k] {
+			k++
+		}
+		even[i] = k
+		if i+k-1 > right {
+			left, right = i-k, i+k-1
+		}
+		if 2*k > length {
+			start, length = i-k, 2*k
+		}
+	}
+	return start, length
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isPalindrome(msg string) bool {
+	return PalindromeOptions{}.IsPalindrome(msg)
+}
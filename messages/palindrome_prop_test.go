@@ -6,6 +6,8 @@ import (
 	cryptorand "crypto/rand"
 	"encoding/binary"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/mdev5000/messageappdemo/testutil/prop"
@@ -85,3 +87,141 @@ func TestProp_IsPalindrome_correctWhenIsNotPalindrome(t *testing.T) {
 		}
 	}
 }
+
+// Generate a random user-perceived character: a letter (optionally with combining marks), a Hangul syllable, an
+// emoji (optionally with a skin tone or joined to another emoji) or a flag.
+func genGrapheme() string {
+	emoji := func() string {
+		return string(rune(0x1F600 + rand.Intn(0x50)))
+	}
+	switch rand.Intn(6) {
+	case 0:
+		return string(rune('a' + rand.Intn(26)))
+	case 1:
+		s := []rune{rune('a' + rand.Intn(26))}
+		for i := rand.Intn(3); i >= 0; i-- {
+			s = append(s, rune(0x0300+rand.Intn(0x70)))
+		}
+		return string(s)
+	case 2:
+		return string(rune(0xAC00 + rand.Intn(11172)))
+	case 3:
+		return emoji() + string(rune(0x1F3FB+rand.Intn(5)))
+	case 4:
+		return emoji() + "\u200D" + emoji() + "\uFE0F"
+	default:
+		return string([]rune{rune(0x1F1E6 + rand.Intn(26)), rune(0x1F1E6 + rand.Intn(26))})
+	}
+}
+
+func genGraphemes() []string {
+	chars := make([]string, 1+rand.Intn(maxLenPropString/16))
+	for i := range chars {
+		chars[i] = genGrapheme()
+	}
+	return chars
+}
+
+func TestProp_graphemeClusters_splitsTheWholeText(t *testing.T) {
+	for i := 0; i < prop.NumCases(); i++ {
+		s := prop.GenerateString(maxLenPropString)
+		clusters := graphemeClusters(s)
+		for _, c := range clusters {
+			if c == "" {
+				t.Fatalf("empty cluster when splitting %q", s)
+			}
+		}
+		if strings.Join(clusters, "") != s {
+			t.Fatalf("clusters %q do not make up %q", clusters, s)
+		}
+	}
+}
+
+func TestProp_graphemeClusters_splitsGeneratedCharacters(t *testing.T) {
+	for i := 0; i < prop.NumCases(); i++ {
+		chars := genGraphemes()
+		clusters := graphemeClusters(strings.Join(chars, ""))
+		if !reflect.DeepEqual(chars, clusters) {
+			t.Fatalf("expected clusters %q, got %q", chars, clusters)
+		}
+	}
+}
+
+func TestProp_IsPalindrome_graphemes_correctWhenPalindrome(t *testing.T) {
+	opts := PalindromeModes[PalindromeModeGraphemes]
+	for i := 0; i < prop.NumCases(); i++ {
+		chars := genGraphemes()
+		pal := chars
+		if rand.Intn(2) == 1 {
+			pal = append(pal, genGrapheme())
+		}
+		for j := len(chars) - 1; j >= 0; j-- {
+			pal = append(pal, chars[j])
+		}
+		s := strings.Join(pal, "")
+		if !opts.IsPalindrome(s) {
+			t.Fatalf("expected palindrome %s returned false", s)
+		}
+	}
+}
+
+func TestProp_IsPalindrome_graphemes_correctWhenIsNotPalindrome(t *testing.T) {
+	opts := PalindromeModes[PalindromeModeGraphemes]
+	for i := 0; i < prop.NumCases(); i++ {
+		chars := genGraphemes()
+		isPal := true
+		for start, end := 0, len(chars)-1; start < end; start, end = start+1, end-1 {
+			// Marks in a different order may be the same character once normalized.
+			isPal = isPal && norm.NFC.String(chars[start]) == norm.NFC.String(chars[end])
+		}
+		s := strings.Join(chars, "")
+		if !isPal && opts.IsPalindrome(s) {
+			t.Fatalf("expected non-palindrome %s returned true", s)
+		}
+	}
+}
+
+// Quadratic longest palindrome search to check LongestPalindrome against, returns the first longest palindrome of the
+// normalized text.
+func longestPalindromeQuadratic(r []rune) string {
+	longest := ""
+	for start := range r {
+		for end := len(r); end-start > len([]rune(longest)); end-- {
+			if string(r[start:end]) == string(rev(r[start:end])) {
+				longest = string(r[start:end])
+				break
+			}
+		}
+	}
+	return longest
+}
+
+// Generate a string of a few distinct letters, so it contains palindromes of various lengths.
+func genLetters() string {
+	r := make([]rune, rand.Intn(64))
+	for i := range r {
+		r[i] = rune('a' + rand.Intn(3))
+	}
+	return string(r)
+}
+
+func TestProp_LongestPalindrome_isTheLongestPalindrome(t *testing.T) {
+	for i := 0; i < prop.NumCases(); i++ {
+		s := genLetters()
+		if rand.Intn(2) == 1 {
+			s = prop.GenerateString(64)
+		}
+		expected := longestPalindromeQuadratic([]rune(norm.NFC.String(s)))
+		span := LongestPalindrome(s)
+		if norm.NFC.String(s) == s && span.Text != expected {
+			t.Fatalf("expected longest palindrome %+q of %+q, got %+q", expected, s, span.Text)
+		}
+		// Otherwise the span includes the whole of any characters changed by normalization, see LongestPalindrome.
+		if !strings.Contains(norm.NFC.String(span.Text), expected) {
+			t.Fatalf("expected longest palindrome %+q of %+q, got %+q", expected, s, span.Text)
+		}
+		if string([]rune(s)[span.Start:span.End]) != span.Text {
+			t.Fatalf("span %d-%d of %q is not %q", span.Start, span.End, s, span.Text)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package messages
 import (
 	"testing"
 
+	"github.com/mdev5000/messageappdemo/apperrors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -44,3 +45,83 @@ func TestIsPalindrome_extendedGraphemeClustersAreNotPalindromes(t *testing.T) {
 func TestIsPalindrome_hiddenCharactersAreNotRemoved(t *testing.T) {
 	require.False(t, isPalindrome("mee\u200Bm"))
 }
+
+func TestPalindromeOptions_IsPalindrome(t *testing.T) {
+	loose := PalindromeModes[PalindromeModeLoose]
+	cases := []struct {
+		name     string
+		opts     PalindromeOptions
+		value    string
+		expected bool
+	}{
+		{"strict is the same as isPalindrome", PalindromeOptions{}, "atttta", true},
+		{"strict does not ignore case", PalindromeOptions{}, "Aa", false},
+		{"ignore case", PalindromeOptions{IgnoreCase: true}, "AbBa", true},
+		{"ignore case of non-ascii letters", PalindromeOptions{IgnoreCase: true}, "\u00c9t\u00e9", true},
+		{"ignore case of letters with multiple folds", PalindromeOptions{IgnoreCase: true}, "ſsS", true},
+		{"ignore punctuation", PalindromeOptions{IgnorePunctuation: true}, "ab,!b.a", true},
+		{"punctuation is not ignored by default", PalindromeOptions{IgnoreWhitespace: true}, "a,b ba", false},
+		{"ignore whitespace", PalindromeOptions{IgnoreWhitespace: true}, "ab b\ta\n", true},
+		{"ignore format characters", PalindromeOptions{IgnoreFormat: true}, "mee\u200Bm", true},
+		{"strip diacritics", PalindromeOptions{StripDiacritics: true}, "\u00e9te", true},
+		{"strip combining diacritics", PalindromeOptions{StripDiacritics: true}, "e\u0301te", true},
+		{"diacritics are kept by default", PalindromeOptions{IgnoreCase: true}, "\u00e9te", false},
+		{"variation selectors are not diacritics", PalindromeOptions{StripDiacritics: true}, "11\ufe0f", false},
+		{"emoji keycaps are not stripped", loose, "1\ufe0f\u20e3 1", false},
+		{"emoji are not stripped (graphemes)", PalindromeOptions{StripDiacritics: true, Graphemes: true},
+			"\u2764\ufe0f\u2764", false},
+		{"marks of other scripts are kept", PalindromeOptions{StripDiacritics: true}, "\u0915\u0915\u0941", false},
+		{"loose sentence", loose, "A man, a plan, a canal: Panama", true},
+		{"loose with accents and hidden characters", loose, "\u00c9sope reste ici et se repose\u200B!", true},
+		{"loose is not always a palindrome", loose, "Hello, world", false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, c.opts.IsPalindrome(c.value))
+		})
+	}
+}
+
+func TestParsePalindromeMode(t *testing.T) {
+	opts, err := ParsePalindromeMode("", PalindromeModeStrict)
+	require.NoError(t, err)
+	require.True(t, opts.IsStrict())
+
+	opts, err = ParsePalindromeMode("", PalindromeModeLoose)
+	require.NoError(t, err)
+	require.False(t, opts.IsStrict())
+
+	_, err = ParsePalindromeMode("", "sloppy")
+	requireHasResponseErrors(t, err,
+		apperrors.ErrorResponse(apperrors.CodePalindromeModeInvalid,
+			"invalid palindrome mode sloppy, expected one of: graphemes, loose, strict").
+			WithArgs(map[string]interface{}{"mode": "sloppy", "expected": "graphemes, loose, strict"}))
+}
+
+func TestLongestPalindrome(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected PalindromeSpan
+	}{
+		{"empty string", "", PalindromeSpan{}},
+		{"single letter", "a", PalindromeSpan{"a", 0, 1}},
+		{"first of the same length", "ab", PalindromeSpan{"a", 0, 1}},
+		{"whole message", "abba", PalindromeSpan{"abba", 0, 4}},
+		{"even length", "xabbay", PalindromeSpan{"abba", 1, 5}},
+		{"odd length", "racecar!", PalindromeSpan{"racecar", 0, 7}},
+		{"longest of several", "abcbaxyabccba", PalindromeSpan{"abccba", 7, 13}},
+		{"overlapping", "abababa", PalindromeSpan{"abababa", 0, 7}},
+		{"multi-byte runes", "¿ñoño?", PalindromeSpan{"ñoñ", 1, 4}},
+		{"offsets of the original text", "x\u0065\u0301\u00e9y", PalindromeSpan{"\u0065\u0301\u00e9", 1, 4}},
+		{"character decomposed by normalization", "\u0fac", PalindromeSpan{"\u0fac", 0, 1}},
+		{"combining characters kept by normalization", "b\u0f71\u0f72", PalindromeSpan{"b", 0, 1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, LongestPalindrome(c.value))
+		})
+	}
+}
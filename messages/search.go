@@ -0,0 +1,71 @@
+package messages
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// HighlightStart and HighlightStop surround the matching terms in the highlight of a SearchResult.
+	HighlightStart = "<b>"
+	HighlightStop  = "</b>"
+)
+
+// SearchQuery holds information for running a search against the messages store. Fields, Limit and Offset are the same
+// as for MessageQuery.
+type SearchQuery struct {
+	// Text is the text to search for, see Repository for how messages are matched.
+	Text   string
+	Fields map[Field]struct{}
+	Limit  uint64
+	Offset uint64
+
+	// Palindrome determines the isPalindrome field of the results, see MessageQuery.
+	Palindrome PalindromeOptions
+}
+
+// SearchResult is a message matching a search.
+type SearchResult struct {
+	Message
+
+	// Rank is the relevance of the message to the search, higher ranks are more relevant.
+	Rank float64 `db:"rank"`
+
+	// Highlight is a snippet of the message with the matching terms surrounded by HighlightStart and HighlightStop.
+	Highlight string `db:"highlight"`
+}
+
+// HighlightSubstring surrounds every case-insensitive occurrence of text within message by HighlightStart and
+// HighlightStop. Found is false when message does not contain text. It implements the substring search of repositories
+// without a text index, see Repository.
+func HighlightSubstring(message, text string) (highlight string, found bool) {
+	textLen := utf8.RuneCountInString(text)
+	if textLen == 0 {
+		return message, false
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(message); {
+		// Case folding does not change the number of runes, so only substrings of the same length can match.
+		end := i
+		for n := 0; n < textLen && end < len(message); n++ {
+			_, size := utf8.DecodeRuneInString(message[end:])
+			end += size
+		}
+		if utf8.RuneCountInString(message[i:end]) == textLen && strings.EqualFold(message[i:end], text) {
+			sb.WriteString(HighlightStart)
+			sb.WriteString(message[i:end])
+			sb.WriteString(HighlightStop)
+			i = end
+			found = true
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(message[i:])
+		sb.WriteString(message[i : i+size])
+		i += size
+	}
+	if !found {
+		return message, false
+	}
+	return sb.String(), true
+}
@@ -0,0 +1,32 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightSubstring(t *testing.T) {
+	cases := []struct {
+		message  string
+		text     string
+		expected string
+		notFound bool
+	}{
+		{"hello world", "world", "hello <b>world</b>", false},
+		{"Hello hello HELLO", "hello", "<b>Hello</b> <b>hello</b> <b>HELLO</b>", false},
+		{"aaa", "aa", "<b>aa</b>a", false},
+		{"Ünïcode ÜNÏCODE", "ünïcode", "<b>Ünïcode</b> <b>ÜNÏCODE</b>", false},
+		{"hello", "hello world", "hello", true},
+		{"hello", "", "hello", true},
+		{"hello", "bye", "hello", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.message+"/"+c.text, func(t *testing.T) {
+			highlight, found := HighlightSubstring(c.message, c.text)
+			require.Equal(t, c.expected, highlight)
+			require.Equal(t, !c.notFound, found)
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package messages
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mdev5000/messageappdemo/apperrors"
 	"github.com/mdev5000/messageappdemo/logging"
@@ -22,7 +26,7 @@ func NewService(log *logging.Logger, repo Repository) *Service {
 }
 
 // Create creates a new message. The message body cannot be empty and has a character limit of MaxMessageCharLength.
-func (ms *Service) Create(message ModifyMessage) (MessageId, error) {
+func (ms *Service) Create(ctx context.Context, message ModifyMessage) (MessageId, error) {
 	const op = "MessagesService.Create"
 
 	if err := validateMessage(op, message); err != nil {
@@ -31,9 +35,10 @@ func (ms *Service) Create(message ModifyMessage) (MessageId, error) {
 
 	now := nowUTC()
 
-	id, err := ms.repo.Create(CreateMessage{
-		Message:   message.Message,
-		CreatedAt: now,
+	id, err := ms.repo.Create(ctx, CreateMessage{
+		Message:      message.Message,
+		IsPalindrome: isPalindrome(message.Message),
+		CreatedAt:    now,
 	})
 	if err != nil {
 		return id, err
@@ -41,55 +46,395 @@ func (ms *Service) Create(message ModifyMessage) (MessageId, error) {
 	return id, err
 }
 
-func (ms *Service) Read(id MessageId) (*Message, error) {
+func (ms *Service) Read(ctx context.Context, id MessageId) (*Message, error) {
 	const op = "MessagesService.Read"
 
 	var message Message
-	err := ms.repo.GetById(id, &message)
+	err := ms.repo.GetById(ctx, id, &message)
 	if errors.Is(err, IdMissingError{}) {
 		return nil, &apperrors.Error{Op: op, EType: apperrors.ETNotFound, Err: err}
 	}
 	return &message, err
 }
 
-func (ms *Service) Delete(id MessageId) error {
-	return ms.repo.DeleteById(id)
+// ReadVersion reads a specific version of a message. The UpdatedAt of the returned message is the time the version was
+// created.
+func (ms *Service) ReadVersion(ctx context.Context, id MessageId, version MessageVersion) (*Message, error) {
+	const op = "MessagesService.ReadVersion"
+
+	var message Message
+	err := ms.repo.GetVersion(ctx, id, version, &message)
+	if errors.Is(err, IdMissingError{}) || errors.Is(err, VersionMissingError{}) {
+		return nil, &apperrors.Error{Op: op, EType: apperrors.ETNotFound, Err: err}
+	}
+	return &message, err
+}
+
+// Analyze runs the named analyzers on a message (every analyzer when names is empty), see Analyzers. The returned
+// message includes the analysis.
+func (ms *Service) Analyze(ctx context.Context, id MessageId, names []string, opts AnalysisOptions) (*Message, error) {
+	const op = "MessagesService.Analyze"
+
+	if err := ValidateAnalyzers(op, names); err != nil {
+		return nil, err
+	}
+	message, err := ms.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	message.Analysis = Analyze(message.Message, names, opts)
+	return message, nil
+}
+
+// ListVersions lists every version of a message from oldest to newest.
+func (ms *Service) ListVersions(ctx context.Context, id MessageId) ([]*Message, error) {
+	const op = "MessagesService.ListVersions"
+
+	var versions []*Message
+	err := ms.repo.GetVersions(ctx, id, &versions)
+	if errors.Is(err, IdMissingError{}) {
+		return nil, &apperrors.Error{Op: op, EType: apperrors.ETNotFound, Err: err}
+	}
+	return versions, err
+}
+
+// ListDeleted lists the messages in the trash, it is paged the same as List.
+func (ms *Service) ListDeleted(ctx context.Context, query MessageQuery) (*MessagePage, error) {
+	const op = "MessagesService.ListDeleted"
+
+	requested := query.Fields
+	query, err := validateListQuery(op, query)
+	if err != nil {
+		return nil, err
+	}
+	page, err := listPage(ctx, query, ms.repo.GetDeletedQuery, ms.repo.GetDeletedQueryTotal)
+	if err != nil {
+		return nil, err
+	}
+	applyPalindrome(query.Palindrome, page.Messages)
+	applyAnalysis(query, page.Messages)
+	applyLongestPalindrome(requested, page.Messages)
+	return page, nil
 }
 
-// Update updates a message. The message body cannot be empty and has a character limit of MaxMessageCharLength.
-func (ms *Service) Update(id MessageId, message ModifyMessage) (MessageVersion, error) {
+// Undelete restores a message from the trash and returns its current version.
+func (ms *Service) Undelete(ctx context.Context, id MessageId) (MessageVersion, error) {
+	const op = "MessagesService.Undelete"
+
+	version, err := ms.repo.UndeleteById(ctx, id)
+	if errors.Is(err, IdMissingError{}) {
+		return noOp, &apperrors.Error{Op: op, EType: apperrors.ETNotFound, Err: err}
+	}
+	return version, err
+}
+
+// PurgeDeleted permanently removes messages that have been in the trash for longer than the retention period. Returns
+// the number of messages removed.
+func (ms *Service) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	return ms.repo.PurgeDeleted(ctx, nowUTC().Add(-retention))
+}
+
+// Delete moves a message to the trash, where it can be restored via Undelete until it is purged. When version is not
+// AnyVersion the message is only deleted if it is currently at that version, otherwise an ETPreconditionFailed error is
+// returned.
+func (ms *Service) Delete(ctx context.Context, id MessageId, version MessageVersion) error {
+	const op = "MessagesService.Delete"
+	return preconditionError(op, ms.repo.DeleteById(ctx, id, version))
+}
+
+// Update updates a message. The message body cannot be empty and has a character limit of MaxMessageCharLength. When
+// version is not AnyVersion the message is only updated if it is currently at that version, otherwise an
+// ETPreconditionFailed error is returned.
+func (ms *Service) Update(
+	ctx context.Context, id MessageId, version MessageVersion, message ModifyMessage,
+) (MessageVersion, error) {
 	const op = "MessagesService.Update"
 
 	if err := validateMessage(op, message); err != nil {
 		return noOp, err
 	}
 
-	version, err := ms.repo.UpdateById(id, ModifyMessage{
-		Message: message.Message,
+	newVersion, err := ms.repo.UpdateById(ctx, id, version, UpdateMessage{
+		Message:      message.Message,
+		IsPalindrome: isPalindrome(message.Message),
 	})
 	if err != nil {
-		return version, err
+		return newVersion, preconditionError(op, err)
 	}
-	return version, err
+	return newVersion, err
 }
 
-func (ms *Service) List(query MessageQuery) ([]*Message, error) {
-	var messagesRaw []*Message
-	if err := ms.repo.GetAllQuery(query, &messagesRaw); err != nil {
+// Undo reverts a message to the content it had the given number of steps (versions) ago. The reverted content is saved
+// as a new version rather than rewriting the history, so an undo can itself be undone. When version is not AnyVersion
+// the undo is only applied if the message is currently at that version, otherwise an ETPreconditionFailed error is
+// returned. The same error is returned if the message is changed while the undo is being applied.
+func (ms *Service) Undo(ctx context.Context, id MessageId, version MessageVersion, steps int) (MessageVersion, error) {
+	const op = "MessagesService.Undo"
+
+	if steps < 1 {
+		return noOp, validationFieldError(op, apperrors.CodeUndoStepsInvalid, "steps", "Steps must be at least 1.", nil)
+	}
+
+	current, err := ms.Read(ctx, id)
+	if err != nil {
+		return noOp, err
+	}
+	if version != AnyVersion && version != current.Version {
+		err := VersionMismatchError{Op: op, Id: id, Expected: version, Actual: current.Version}
+		return noOp, preconditionError(op, err)
+	}
+
+	target := current.Version - steps
+	if target < 1 {
+		return noOp, validationFieldError(op, apperrors.CodeUndoStepsTooMany, "steps",
+			fmt.Sprintf("Cannot undo %d steps, the message only has %d previous versions.", steps, current.Version-1),
+			map[string]interface{}{"steps": steps, "versions": current.Version - 1})
+	}
+
+	previous, err := ms.ReadVersion(ctx, id, target)
+	if err != nil {
+		return noOp, err
+	}
+
+	reverted := ModifyMessage{Message: previous.Message}
+	if err := validateMessage(op, reverted); err != nil {
+		return noOp, err
+	}
+
+	newVersion, err := ms.repo.UpdateById(ctx, id, current.Version, UpdateMessage{
+		Message:      reverted.Message,
+		IsPalindrome: isPalindrome(reverted.Message),
+	})
+	if err != nil {
+		return newVersion, preconditionError(op, err)
+	}
+	return newVersion, nil
+}
+
+// Converts version mismatches reported by the repository into errors the user can act on.
+func preconditionError(op string, err error) error {
+	if errors.Is(err, VersionMismatchError{}) {
+		return &apperrors.Error{Op: op, EType: apperrors.ETPreconditionFailed, Err: err}
+	}
+	return err
+}
+
+// List lists messages in the order of the query (see MessageQuery). When the query has a Limit, the returned page
+// includes the cursors for the next and previous pages.
+func (ms *Service) List(ctx context.Context, query MessageQuery) (*MessagePage, error) {
+	const op = "MessagesService.List"
+
+	requested := query.Fields
+	query, err := validateListQuery(op, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := listPage(ctx, query, ms.repo.GetAllQuery, ms.repo.GetAllQueryTotal)
+	if err != nil {
 		return nil, err
 	}
+	applyPalindrome(query.Palindrome, page.Messages)
+	applyAnalysis(query, page.Messages)
+	applyLongestPalindrome(requested, page.Messages)
 
-	out := make([]*Message, len(messagesRaw))
-	for i, mRaw := range messagesRaw {
+	for i, mRaw := range page.Messages {
 		m := Message{
-			Id:        mRaw.Id,
-			Version:   mRaw.Version,
-			CreatedAt: mRaw.CreatedAt,
-			UpdatedAt: mRaw.UpdatedAt,
-			Message:   mRaw.Message,
+			Id:                mRaw.Id,
+			Version:           mRaw.Version,
+			CreatedAt:         mRaw.CreatedAt,
+			UpdatedAt:         mRaw.UpdatedAt,
+			Message:           mRaw.Message,
+			IsPalindrome:      mRaw.IsPalindrome,
+			LongestPalindrome: mRaw.LongestPalindrome,
+			Analysis:          mRaw.Analysis,
+		}
+		page.Messages[i] = &m
+	}
+
+	return page, nil
+}
+
+// Search lists the messages matching the text of the query from the most to the least relevant, see Repository for how
+// messages are matched. The text cannot be blank.
+func (ms *Service) Search(ctx context.Context, query SearchQuery) ([]*SearchResult, error) {
+	const op = "MessagesService.Search"
+
+	if strings.TrimSpace(query.Text) == "" {
+		re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeSearchTextBlank, "search text cannot be blank"))
+		return nil, &re
+	}
+
+	// The same as List, the message text is needed to determine isPalindrome under options that are not strict.
+	if _, found := query.Fields[FieldIsPalindrome]; found && !query.Palindrome.IsStrict() {
+		fields := make(map[Field]struct{}, len(query.Fields)+1)
+		for f := range query.Fields {
+			fields[f] = struct{}{}
+		}
+		fields[FieldMessage] = struct{}{}
+		query.Fields = fields
+	}
+
+	var results []*SearchResult
+	if err := ms.repo.Search(ctx, query, &results); err != nil {
+		return nil, err
+	}
+	if !query.Palindrome.IsStrict() {
+		for _, r := range results {
+			r.IsPalindrome = query.Palindrome.IsPalindrome(r.Message.Message)
+		}
+	}
+	return results, nil
+}
+
+// Validates the filter and analyzers of a listing query. When the palindrome options are not strict the stored
+// isPalindrome values do not apply, so the field cannot be filtered or sorted by and the message text is retrieved in
+// order to determine it. The message text is also retrieved when analyzers or the longestPalindrome field (which is not
+// retrieved from the repository) are requested.
+func validateListQuery(op string, query MessageQuery) (MessageQuery, error) {
+	if query.Filter != nil {
+		if err := ValidateFilter(op, query.Filter); err != nil {
+			return query, err
+		}
+	}
+	if err := ValidateAnalyzers(op, query.Analyzers); err != nil {
+		return query, err
+	}
+
+	_, longestPalindrome := query.Fields[FieldLongestPalindrome]
+	needsMessage := len(query.Analyzers) > 0 || longestPalindrome
+	if !query.Palindrome.IsStrict() {
+		sortsByPalindrome := false
+		for _, k := range query.Sort {
+			sortsByPalindrome = sortsByPalindrome || k.Field == FieldIsPalindrome
+		}
+		if sortsByPalindrome || (query.Filter != nil && filterHasField(query.Filter, FieldIsPalindrome)) {
+			re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodePalindromeModeStrictRequired,
+				"isPalindrome can only be filtered and sorted by with the "+PalindromeModeStrict+" palindrome mode"))
+			return query, &re
+		}
+		_, found := query.Fields[FieldIsPalindrome]
+		needsMessage = needsMessage || found
+	}
+
+	if needsMessage && len(query.Fields) > 0 {
+		fields := make(map[Field]struct{}, len(query.Fields)+1)
+		for f := range query.Fields {
+			if f != FieldLongestPalindrome {
+				fields[f] = struct{}{}
+			}
 		}
-		out[i] = &m
+		fields[FieldMessage] = struct{}{}
+		query.Fields = fields
+	}
+	return query, nil
+}
+
+// Determines the isPalindrome field of messages under the palindrome options, unless they are strict in which case the
+// stored value is kept.
+func applyPalindrome(opts PalindromeOptions, messages []*Message) {
+	if opts.IsStrict() {
+		return
+	}
+	for _, m := range messages {
+		m.IsPalindrome = opts.IsPalindrome(m.Message)
+	}
+}
+
+// Determines the longest palindrome of messages when requested by the fields of a listing query.
+func applyLongestPalindrome(fields map[Field]struct{}, messages []*Message) {
+	if _, found := fields[FieldLongestPalindrome]; !found {
+		return
 	}
+	for _, m := range messages {
+		span := LongestPalindrome(m.Message)
+		m.LongestPalindrome = &span
+	}
+}
+
+// Runs the analyzers of a listing query on the messages, see Message.Analysis.
+func applyAnalysis(query MessageQuery, messages []*Message) {
+	if len(query.Analyzers) == 0 {
+		return
+	}
+	opts := AnalysisOptions{Palindrome: query.Palindrome}
+	for _, m := range messages {
+		m.Analysis = Analyze(m.Message, query.Analyzers, opts)
+	}
+}
 
-	return out, nil
+// Runs a listing query and determines the cursors of the surrounding pages. One more message than the limit is
+// retrieved to determine if there is another page in the direction of the query. The fields the messages are ordered
+// by are always retrieved as they are needed for the cursors. When the query includes the total, it is retrieved via
+// getTotal rather than get.
+func listPage(
+	ctx context.Context,
+	query MessageQuery,
+	get func(context.Context, MessageQuery, *[]*Message) error,
+	getTotal func(context.Context, MessageQuery, *[]*Message) (int64, error),
+) (*MessagePage, error) {
+	paged := query.Limit > 0
+	if paged {
+		query.Limit++
+		if len(query.Fields) > 0 {
+			keys := query.OrderKeys()
+			fields := make(map[Field]struct{}, len(query.Fields)+len(keys))
+			for f := range query.Fields {
+				fields[f] = struct{}{}
+			}
+			for _, k := range keys {
+				fields[k.Field] = struct{}{}
+			}
+			query.Fields = fields
+		}
+	}
+
+	var messages []*Message
+	var total int64
+	var err error
+	if query.IncludeTotal {
+		total, err = getTotal(ctx, query, &messages)
+	} else {
+		err = get(ctx, query, &messages)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !paged {
+		return &MessagePage{Messages: messages, Total: total}, nil
+	}
+
+	limit := int(query.Limit - 1)
+	more := len(messages) > limit
+	page := MessagePage{Total: total}
+	if query.Before != nil {
+		// The extra message is the earliest one.
+		if more {
+			messages = messages[1:]
+		}
+		page.Messages = messages
+		if len(messages) > 0 {
+			if more {
+				page.Prev = CursorAt(messages[0])
+			}
+			page.Next = CursorAt(messages[len(messages)-1])
+		}
+		return &page, nil
+	}
+
+	if more {
+		messages = messages[:limit]
+	}
+	page.Messages = messages
+	if len(messages) > 0 {
+		if more {
+			page.Next = CursorAt(messages[len(messages)-1])
+		}
+		if query.After != nil || query.Offset > 0 {
+			page.Prev = CursorAt(messages[0])
+		}
+	}
+	return &page, nil
 }
@@ -1,6 +1,7 @@
 package messages
 
 import (
+	"context"
 	"testing"
 
 	"github.com/mdev5000/messageappdemo/apperrors"
@@ -27,17 +28,366 @@ func requireHasResponseErrors(t *testing.T, err error, expected interface{}) {
 }
 
 func TestService_Create_runsValidation(t *testing.T) {
-	_, err := tServiceNoRepo().Create(ModifyMessage{Message: ""})
+	_, err := tServiceNoRepo().Create(context.Background(), ModifyMessage{Message: ""})
 	requireHasResponseErrors(t, err, apperrors.FieldErrorResponse{
 		Field: "message",
 		Error: "Message field cannot be blank.",
+		Code:  apperrors.CodeMessageBlank,
 	})
 }
 
 func TestService_Update_runsValidation(t *testing.T) {
-	_, err := tServiceNoRepo().Update(5, ModifyMessage{Message: ""})
+	_, err := tServiceNoRepo().Update(context.Background(), 5, AnyVersion, ModifyMessage{Message: ""})
 	requireHasResponseErrors(t, err, apperrors.FieldErrorResponse{
 		Field: "message",
 		Error: "Message field cannot be blank.",
+		Code:  apperrors.CodeMessageBlank,
 	})
 }
+
+func TestService_Search_errorOnBlankText(t *testing.T) {
+	_, err := tServiceNoRepo().Search(context.Background(), SearchQuery{Text: " \t"})
+	requireHasResponseErrors(t, err,
+		apperrors.ErrorResponse(apperrors.CodeSearchTextBlank, "search text cannot be blank"))
+}
+
+// Repository stub that fails all modifying operations with a version mismatch.
+type versionMismatchRepo struct {
+	Repository
+}
+
+func (versionMismatchRepo) DeleteById(_ context.Context, id MessageId, version MessageVersion) error {
+	return VersionMismatchError{Op: "repo", Id: id, Expected: version, Actual: version + 1}
+}
+
+func (versionMismatchRepo) UpdateById(
+	_ context.Context, id MessageId, version MessageVersion, _ UpdateMessage,
+) (MessageVersion, error) {
+	return 0, VersionMismatchError{Op: "repo", Id: id, Expected: version, Actual: version + 1}
+}
+
+func TestService_versionMismatchesArePreconditionFailures(t *testing.T) {
+	svc := NewService(logging.NoLog(), versionMismatchRepo{})
+
+	_, err := svc.Update(context.Background(), 5, 2, ModifyMessage{Message: "my message"})
+	require.Equal(t, apperrors.ETPreconditionFailed, err.(*apperrors.Error).EType)
+
+	err = svc.Delete(context.Background(), 5, 2)
+	require.Equal(t, apperrors.ETPreconditionFailed, err.(*apperrors.Error).EType)
+}
+
+// Repository stub recording the messages that are stored.
+type palindromeRepo struct {
+	Repository
+	created CreateMessage
+	updated UpdateMessage
+}
+
+func (r *palindromeRepo) Create(_ context.Context, cm CreateMessage) (MessageId, error) {
+	r.created = cm
+	return 1, nil
+}
+
+func (r *palindromeRepo) UpdateById(
+	_ context.Context, _ MessageId, version MessageVersion, m UpdateMessage,
+) (MessageVersion, error) {
+	r.updated = m
+	return version + 1, nil
+}
+
+func TestService_storesWhetherMessagesArePalindromes(t *testing.T) {
+	repo := &palindromeRepo{}
+	svc := NewService(logging.NoLog(), repo)
+
+	_, err := svc.Create(context.Background(), ModifyMessage{Message: "abba"})
+	require.NoError(t, err)
+	require.True(t, repo.created.IsPalindrome)
+
+	_, err = svc.Update(context.Background(), 1, 1, ModifyMessage{Message: "abc"})
+	require.NoError(t, err)
+	require.Equal(t, UpdateMessage{Message: "abc", IsPalindrome: false}, repo.updated)
+
+	_, err = svc.Update(context.Background(), 1, 2, ModifyMessage{Message: "aba"})
+	require.NoError(t, err)
+	require.Equal(t, UpdateMessage{Message: "aba", IsPalindrome: true}, repo.updated)
+}
+
+// Repository stub containing the history of a single message.
+type historyRepo struct {
+	Repository
+	versions []string
+}
+
+func (r *historyRepo) GetById(_ context.Context, id MessageId, m *Message) error {
+	if id != 1 {
+		return IdMissingError{Op: "repo", Id: id}
+	}
+	*m = Message{Id: id, Version: len(r.versions), Message: r.versions[len(r.versions)-1]}
+	return nil
+}
+
+func (r *historyRepo) GetVersion(_ context.Context, id MessageId, version MessageVersion, m *Message) error {
+	*m = Message{Id: id, Version: version, Message: r.versions[version-1]}
+	return nil
+}
+
+func (r *historyRepo) UpdateById(
+	_ context.Context, _ MessageId, version MessageVersion, m UpdateMessage,
+) (MessageVersion, error) {
+	if version != len(r.versions) {
+		return 0, VersionMismatchError{Op: "repo", Expected: version, Actual: len(r.versions)}
+	}
+	r.versions = append(r.versions, m.Message)
+	return len(r.versions), nil
+}
+
+func TestService_Undo_revertsToAPreviousVersion(t *testing.T) {
+	repo := &historyRepo{versions: []string{"first", "second", "third"}}
+	svc := NewService(logging.NoLog(), repo)
+
+	v, err := svc.Undo(context.Background(), 1, AnyVersion, 1)
+	require.NoError(t, err)
+	require.Equal(t, 4, v)
+	require.Equal(t, "second", repo.versions[3])
+
+	v, err = svc.Undo(context.Background(), 1, 4, 3)
+	require.NoError(t, err)
+	require.Equal(t, 5, v)
+	require.Equal(t, "first", repo.versions[4])
+}
+
+func TestService_Undo_errors(t *testing.T) {
+	svc := NewService(logging.NoLog(), &historyRepo{versions: []string{"first", "second"}})
+
+	_, err := svc.Undo(context.Background(), 1, AnyVersion, 0)
+	requireHasResponseErrors(t, err, apperrors.FieldErrorResponse{
+		Field: "steps",
+		Error: "Steps must be at least 1.",
+		Code:  apperrors.CodeUndoStepsInvalid,
+	})
+
+	_, err = svc.Undo(context.Background(), 1, AnyVersion, 2)
+	requireHasResponseErrors(t, err, apperrors.FieldErrorResponse{
+		Field: "steps",
+		Error: "Cannot undo 2 steps, the message only has 1 previous versions.",
+		Code:  apperrors.CodeUndoStepsTooMany,
+		Args:  map[string]interface{}{"steps": 2, "versions": 1},
+	})
+
+	_, err = svc.Undo(context.Background(), 1, 1, 1)
+	require.Equal(t, apperrors.ETPreconditionFailed, err.(*apperrors.Error).EType)
+
+	_, err = svc.Undo(context.Background(), 2, AnyVersion, 1)
+	require.Equal(t, apperrors.ETNotFound, err.(*apperrors.Error).EType)
+}
+
+// Repository stub listing messages with ids 1 to count.
+type listRepo struct {
+	Repository
+	count MessageId
+	query MessageQuery
+}
+
+func (r *listRepo) GetAllQuery(_ context.Context, query MessageQuery, messages *[]*Message) error {
+	r.query = query
+	var ids []MessageId
+	for id := MessageId(1); id <= r.count; id++ {
+		if (query.After == nil || id > query.After.Id) && (query.Before == nil || id < query.Before.Id) {
+			ids = append(ids, id)
+		}
+	}
+	if query.Limit > 0 && int(query.Limit) < len(ids) {
+		if query.Before != nil {
+			ids = ids[len(ids)-int(query.Limit):]
+		} else {
+			ids = ids[:query.Limit]
+		}
+	}
+	for _, id := range ids {
+		*messages = append(*messages, &Message{Id: id})
+	}
+	return nil
+}
+
+func (r *listRepo) GetAllQueryTotal(ctx context.Context, query MessageQuery, messages *[]*Message) (int64, error) {
+	return int64(r.count), r.GetAllQuery(ctx, query, messages)
+}
+
+func pageIds(page *MessagePage) []MessageId {
+	var ids []MessageId
+	for _, m := range page.Messages {
+		ids = append(ids, m.Id)
+	}
+	return ids
+}
+
+func TestService_List_pages(t *testing.T) {
+	repo := &listRepo{count: 5}
+	svc := NewService(logging.NoLog(), repo)
+
+	t.Run("not paged without a limit", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{1, 2, 3, 4, 5}, pageIds(page))
+		require.Nil(t, page.Next)
+		require.Nil(t, page.Prev)
+	})
+
+	t.Run("first page", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{1, 2}, pageIds(page))
+		require.Equal(t, &Cursor{Id: 2}, page.Next)
+		require.Nil(t, page.Prev)
+	})
+
+	t.Run("after", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2, After: &Cursor{Id: 2}})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{3, 4}, pageIds(page))
+		require.Equal(t, &Cursor{Id: 4}, page.Next)
+		require.Equal(t, &Cursor{Id: 3}, page.Prev)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2, After: &Cursor{Id: 4}})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{5}, pageIds(page))
+		require.Nil(t, page.Next)
+		require.Equal(t, &Cursor{Id: 5}, page.Prev)
+	})
+
+	t.Run("before", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2, Before: &Cursor{Id: 5}})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{3, 4}, pageIds(page))
+		require.Equal(t, &Cursor{Id: 4}, page.Next)
+		require.Equal(t, &Cursor{Id: 3}, page.Prev)
+	})
+
+	t.Run("before the first page", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2, Before: &Cursor{Id: 3}})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{1, 2}, pageIds(page))
+		require.Equal(t, &Cursor{Id: 2}, page.Next)
+		require.Nil(t, page.Prev)
+	})
+
+	t.Run("id is always retrieved when paging", func(t *testing.T) {
+		fields := map[Field]struct{}{FieldMessage: {}}
+		_, err := svc.List(context.Background(), MessageQuery{Limit: 2, Fields: fields})
+		require.NoError(t, err)
+		require.Equal(t, map[Field]struct{}{FieldMessage: {}, FieldId: {}}, repo.query.Fields)
+		require.Equal(t, map[Field]struct{}{FieldMessage: {}}, fields, "query fields are not modified")
+	})
+
+	t.Run("total is only included when requested", func(t *testing.T) {
+		page, err := svc.List(context.Background(), MessageQuery{Limit: 2, After: &Cursor{Id: 2}})
+		require.NoError(t, err)
+		require.Equal(t, int64(0), page.Total)
+
+		page, err = svc.List(context.Background(), MessageQuery{Limit: 2, After: &Cursor{Id: 2}, IncludeTotal: true})
+		require.NoError(t, err)
+		require.Equal(t, []MessageId{3, 4}, pageIds(page))
+		require.Equal(t, int64(5), page.Total)
+	})
+
+	t.Run("sort fields are always retrieved when paging", func(t *testing.T) {
+		fields := map[Field]struct{}{FieldMessage: {}}
+		sort := []SortKey{{Field: FieldCreatedAt, Desc: true}}
+		_, err := svc.List(context.Background(), MessageQuery{Limit: 2, Fields: fields, Sort: sort})
+		require.NoError(t, err)
+		require.Equal(t, map[Field]struct{}{FieldMessage: {}, FieldCreatedAt: {}, FieldId: {}}, repo.query.Fields)
+	})
+}
+
+// Repository stub listing a message with the stored (strict) isPalindrome value.
+type textListRepo struct {
+	Repository
+	query MessageQuery
+}
+
+func (r *textListRepo) GetAllQuery(_ context.Context, query MessageQuery, messages *[]*Message) error {
+	r.query = query
+	*messages = append(*messages, &Message{Id: 1, Message: "Never odd or even"})
+	return nil
+}
+
+func TestService_List_palindromeOptions(t *testing.T) {
+	repo := &textListRepo{}
+	svc := NewService(logging.NoLog(), repo)
+	loose := PalindromeModes[PalindromeModeLoose]
+	fields := map[Field]struct{}{FieldId: {}, FieldIsPalindrome: {}}
+
+	page, err := svc.List(context.Background(), MessageQuery{Fields: fields})
+	require.NoError(t, err)
+	require.False(t, page.Messages[0].IsPalindrome, "strict options keep the stored value")
+
+	page, err = svc.List(context.Background(), MessageQuery{Fields: fields, Palindrome: loose})
+	require.NoError(t, err)
+	require.True(t, page.Messages[0].IsPalindrome)
+	require.Equal(t, map[Field]struct{}{FieldId: {}, FieldIsPalindrome: {}, FieldMessage: {}}, repo.query.Fields,
+		"the message is retrieved to determine isPalindrome")
+
+	_, err = svc.List(context.Background(),
+		MessageQuery{Palindrome: loose, Sort: []SortKey{{Field: FieldIsPalindrome}}})
+	requireHasResponseErrors(t, err,
+		apperrors.ErrorResponse(apperrors.CodePalindromeModeStrictRequired,
+			"isPalindrome can only be filtered and sorted by with the strict palindrome mode"))
+
+	filter := And{Condition{Field: FieldIsPalindrome, Op: FilterEq, Value: true}}
+	_, err = svc.List(context.Background(), MessageQuery{Palindrome: loose, Filter: filter})
+	requireHasResponseErrors(t, err,
+		apperrors.ErrorResponse(apperrors.CodePalindromeModeStrictRequired,
+			"isPalindrome can only be filtered and sorted by with the strict palindrome mode"))
+}
+
+func TestMessageQuery_OrderKeys(t *testing.T) {
+	require.Equal(t, []SortKey{{Field: FieldId}}, MessageQuery{}.OrderKeys())
+	require.Equal(t,
+		[]SortKey{{Field: FieldCreatedAt, Desc: true}, {Field: FieldId}},
+		MessageQuery{Sort: []SortKey{{Field: FieldCreatedAt, Desc: true}}}.OrderKeys())
+	require.Equal(t,
+		[]SortKey{{Field: FieldId, Desc: true}, {Field: FieldMessage}},
+		MessageQuery{Sort: []SortKey{{Field: FieldId, Desc: true}, {Field: FieldMessage}}}.OrderKeys())
+}
+
+func TestService_List_analyzers(t *testing.T) {
+	repo := &textListRepo{}
+	svc := NewService(logging.NoLog(), repo)
+
+	page, err := svc.List(context.Background(), MessageQuery{
+		Fields:    map[Field]struct{}{FieldId: {}},
+		Analyzers: []string{AnalyzerWordCount},
+	})
+	require.NoError(t, err)
+	require.Equal(t, Analysis{AnalyzerWordCount: 4}, page.Messages[0].Analysis)
+	require.Equal(t, map[Field]struct{}{FieldId: {}, FieldMessage: {}}, repo.query.Fields,
+		"the message is retrieved to run the analyzers")
+
+	page, err = svc.List(context.Background(), MessageQuery{})
+	require.NoError(t, err)
+	require.Nil(t, page.Messages[0].Analysis)
+
+	_, err = svc.List(context.Background(), MessageQuery{Analyzers: []string{"missing"}})
+	expected := "anagramSignature, characterCount, graphemeCount, isPalindrome, longestPalindrome, script, wordCount"
+	requireHasResponseErrors(t, err, apperrors.ErrorResponse(apperrors.CodeAnalyzerInvalid,
+		"invalid analyzer missing, expected one of: "+expected).
+		WithArgs(map[string]interface{}{"name": "missing", "expected": expected}))
+}
+
+func TestService_List_longestPalindrome(t *testing.T) {
+	repo := &textListRepo{}
+	svc := NewService(logging.NoLog(), repo)
+
+	page, err := svc.List(context.Background(),
+		MessageQuery{Fields: map[Field]struct{}{FieldId: {}, FieldLongestPalindrome: {}}})
+	require.NoError(t, err)
+	require.Equal(t, &PalindromeSpan{Text: "eve", Start: 1, End: 4}, page.Messages[0].LongestPalindrome)
+	require.Equal(t, map[Field]struct{}{FieldId: {}, FieldMessage: {}}, repo.query.Fields,
+		"the message is retrieved rather than the longest palindrome")
+
+	page, err = svc.List(context.Background(), MessageQuery{Fields: map[Field]struct{}{FieldId: {}}})
+	require.NoError(t, err)
+	require.Nil(t, page.Messages[0].LongestPalindrome)
+}
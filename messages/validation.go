@@ -8,22 +8,25 @@ import (
 
 func validateMessage(op string, message ModifyMessage) error {
 	if message.Message == "" {
-		return validationFieldError(op, "message", "Message field cannot be blank.")
+		return validationFieldError(op, apperrors.CodeMessageBlank, "message", "Message field cannot be blank.", nil)
 	}
 
 	if len([]rune(message.Message)) > MaxMessageCharLength {
-		return validationFieldError(op, "message",
-			fmt.Sprintf("Message cannot be longer than %d characters.", MaxMessageCharLength))
+		return validationFieldError(op, apperrors.CodeMessageTooLong, "message",
+			fmt.Sprintf("Message cannot be longer than %d characters.", MaxMessageCharLength),
+			map[string]interface{}{"max": MaxMessageCharLength})
 	}
 
 	return nil
 }
 
-func validationFieldError(op string, field, error string) error {
+func validationFieldError(op string, code, field, error string, args map[string]interface{}) error {
 	re := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
 	re.AddResponse(apperrors.FieldErrorResponse{
 		Field: field,
 		Error: error,
+		Code:  code,
+		Args:  args,
 	})
 	return &re
 }
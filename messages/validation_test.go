@@ -12,6 +12,7 @@ func TestValidation_errorWhenEmpty(t *testing.T) {
 	requireHasResponseErrors(t, validateMessage("", ModifyMessage{Message: ""}), apperrors.FieldErrorResponse{
 		Field: "message",
 		Error: "Message field cannot be blank.",
+		Code:  apperrors.CodeMessageBlank,
 	})
 }
 
@@ -20,6 +21,8 @@ func TestValidation_errorWhenLargeThanMaxCharLimit(t *testing.T) {
 	requireHasResponseErrors(t, validateMessage("", ModifyMessage{Message: msg}), apperrors.FieldErrorResponse{
 		Field: "message",
 		Error: "Message cannot be longer than 512 characters.",
+		Code:  apperrors.CodeMessageTooLong,
+		Args:  map[string]interface{}{"max": MaxMessageCharLength},
 	})
 }
 
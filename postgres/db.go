@@ -8,6 +8,7 @@ import (
 )
 
 type DB = sqlx.DB
+type Tx = sqlx.Tx
 
 type Message struct {
 	Id      int    `db:"id"`
@@ -32,3 +33,11 @@ func OpenTest(dbname, user, password, port string) (*DB, error) {
 		fmt.Sprintf("user=%s dbname=%s password=%s port=%s sslmode=disable", user, dbname, password, port))
 	return db, err
 }
+
+// OpenTestInTimeZone is the same as OpenTest, but the database sessions use the given time zone (ex. Asia/Tokyo).
+func OpenTestInTimeZone(dbname, user, password, port, timeZone string) (*DB, error) {
+	db, err := sqlx.Connect("postgres",
+		fmt.Sprintf("user=%s dbname=%s password=%s port=%s sslmode=disable timezone=%s",
+			user, dbname, password, port, timeZone))
+	return db, err
+}
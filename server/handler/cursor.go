@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/pkg/errors"
+)
+
+// CursorCodec encodes page positions into opaque cursor tokens. Tokens are signed so clients cannot create or modify
+// them, they are in the format <base64 json>.<base64 signature>.
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec creates a CursorCodec that signs tokens with the secret. When the secret is empty a random one is
+// generated, so tokens are only valid for the lifetime of the application.
+func NewCursorCodec(secret []byte) *CursorCodec {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Errorf("failed to generate cursor secret: %w", err))
+		}
+	}
+	return &CursorCodec{secret: secret}
+}
+
+// Encode encodes v as a cursor token.
+func (c *CursorCodec) Encode(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode decodes a token created by Encode into v. An ETInvalid error is returned when the token is malformed or was
+// not signed by this codec, param is the name of the query parameter the token was read from.
+func (c *CursorCodec) Decode(op, param, token string, v interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return cursorError(op, param, errors.New("cursor is not in the format <payload>.<signature>"))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return cursorError(op, param, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return cursorError(op, param, err)
+	}
+	if !hmac.Equal(sig, c.sign(payload)) {
+		return cursorError(op, param, errors.New("cursor signature does not match"))
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return cursorError(op, param, err)
+	}
+	return nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func cursorError(op, param string, err error) error {
+	appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err, Stack: errors.WithStack(err)}
+	appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryCursorInvalid,
+		fmt.Sprintf("invalid %s cursor", param)).WithArgs(map[string]interface{}{"param": param}))
+	return &appErr
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCursor struct {
+	Id int64 `json:"id"`
+}
+
+func TestCursorCodec_canEncodeAndDecode(t *testing.T) {
+	c := NewCursorCodec([]byte("secret"))
+	token, err := c.Encode(testCursor{Id: 5})
+	require.NoError(t, err)
+
+	var cursor testCursor
+	require.NoError(t, c.Decode("", "after", token, &cursor))
+	require.Equal(t, testCursor{Id: 5}, cursor)
+}
+
+func TestCursorCodec_errorWhenTokenIsInvalid(t *testing.T) {
+	c := NewCursorCodec([]byte("secret"))
+	token, err := c.Encode(testCursor{Id: 5})
+	require.NoError(t, err)
+	otherToken, err := NewCursorCodec([]byte("other")).Encode(testCursor{Id: 5})
+	require.NoError(t, err)
+	payload := strings.Split(token, ".")[0]
+	tampered, err := c.Encode(testCursor{Id: 6})
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"empty":             "",
+		"missing signature": payload,
+		"not base64":        "!!!.!!!",
+		"different secret":  otherToken,
+		"modified payload":  strings.Split(tampered, ".")[0] + "." + strings.Split(token, ".")[1],
+	}
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			var cursor testCursor
+			err := c.Decode("", "before", token, &cursor)
+			require.Equal(t, `{"errors":[{"error":"invalid before cursor",`+
+				`"code":"query.cursor.invalid"}]}`, errorJson(t, err))
+		})
+	}
+}
+
+func TestNewCursorCodec_generatesSecretWhenEmpty(t *testing.T) {
+	token, err := NewCursorCodec(nil).Encode(testCursor{Id: 5})
+	require.NoError(t, err)
+
+	var cursor testCursor
+	require.Error(t, NewCursorCodec(nil).Decode("", "after", token, &cursor))
+}
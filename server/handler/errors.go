@@ -14,3 +14,13 @@ func ResponseError(op string) apperrors.Error {
 		Stack: errors.WithStack(err),
 	}
 }
+
+// InternalError wraps an unexpected error, which results in a 500 response.
+func InternalError(op string, err error) error {
+	return &apperrors.Error{
+		EType: apperrors.ETInternal,
+		Op:    op,
+		Err:   err,
+		Stack: errors.WithStack(err),
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/pkg/errors"
+)
+
+// IfMatchInts reads the integer entity tags (see SetETagInt) a client expects the resource to currently have from the
+// If-Match header, the precondition holds when the current entity tag is any of them. Found is false when the header
+// is not present. A value of * matches any current entity tag and is returned as no versions with found set to true.
+//
+// Since If-Match uses the strong comparison function, weak tags and tags that could never have been issued by
+// SetETagInt never match. When none of the tags can match an ETPreconditionFailed error is returned, while malformed
+// headers result in an ETInvalid error.
+func IfMatchInts(op string, r *http.Request) (v []int, found bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return nil, false, nil
+	}
+	if header == "*" {
+		return nil, true, nil
+	}
+
+	tags, ok := parseETags(header)
+	if !ok {
+		re := ResponseError(op)
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeHeaderIfMatchInvalid, "invalid If-Match header"))
+		return nil, true, &re
+	}
+
+	for _, tag := range tags {
+		if tag.weak {
+			continue
+		}
+		if version, errConv := strconv.Atoi(tag.opaque); errConv == nil && version >= 1 {
+			v = append(v, version)
+		}
+	}
+	if len(v) == 0 {
+		return nil, true, preconditionFailed(op, fmt.Errorf("entity tags %s do not match any version", header))
+	}
+	return v, true, nil
+}
+
+// NotModified evaluates the If-None-Match and If-Modified-Since headers of a GET or HEAD request against the ETag and
+// Last-Modified headers already set on the response. When the client's copy of the resource is still current a 304
+// Not Modified response (without a body) is sent and true is returned.
+//
+// As per RFC 7232, If-None-Match uses the weak comparison function and when present If-Modified-Since is ignored.
+func NotModified(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if inm := strings.TrimSpace(r.Header.Get("If-None-Match")); inm != "" {
+		etag := w.Header().Get("ETag")
+		if etag == "" || !noneMatch(inm, etag) {
+			return false
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	lm := w.Header().Get("Last-Modified")
+	if ims == "" || lm == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lm)
+	if err != nil || modified.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// Indicates if the If-None-Match header value matches the current entity tag.
+func noneMatch(header, current string) bool {
+	if header == "*" {
+		return true
+	}
+	currentTags, ok := parseETags(current)
+	if !ok || len(currentTags) != 1 {
+		return false
+	}
+	tags, ok := parseETags(header)
+	if !ok {
+		return false
+	}
+	for _, tag := range tags {
+		if tag.weakMatch(currentTags[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// WeakETag creates a weak entity tag from the given representation of a resource.
+func WeakETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16]))
+}
+
+// SetETagIntVariant is the same as SetETagInt, but for a representation of the resource that differs from the default
+// one depending on the request (ex. only some fields, described by the variant as "fields=id,message"). The entity tag
+// is the version followed by a hash of the variant, so conditional requests only match the same representation. An
+// empty variant is the default representation.
+func SetETagIntVariant(w http.ResponseWriter, v int, variant string) {
+	if variant == "" {
+		SetETagInt(w, v)
+		return
+	}
+	sum := sha256.Sum256([]byte(variant))
+	w.Header().Set("ETag", fmt.Sprintf(`"%d-%s"`, v, hex.EncodeToString(sum[:8])))
+}
+
+type entityTag struct {
+	weak   bool
+	opaque string
+}
+
+// Weak comparison function as defined by RFC 7232, the tags match when their opaque values match regardless of
+// whether either is weak.
+func (e entityTag) weakMatch(other entityTag) bool {
+	return e.opaque == other.opaque
+}
+
+// Parses a comma separated list of entity tags (ex. "1", W/"2"). Returns false if the list is malformed.
+func parseETags(header string) ([]entityTag, bool) {
+	var tags []entityTag
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		var tag entityTag
+		if strings.HasPrefix(s, "W/") {
+			tag.weak = true
+			s = s[2:]
+		}
+		if len(s) < 2 || s[0] != '"' {
+			return nil, false
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end == -1 {
+			return nil, false
+		}
+		tag.opaque = s[1 : end+1]
+		tags = append(tags, tag)
+		s = strings.TrimLeft(s[end+2:], " \t")
+		if s != "" && s[0] != ',' {
+			return nil, false
+		}
+	}
+	return tags, len(tags) > 0
+}
+
+func preconditionFailed(op string, err error) error {
+	return &apperrors.Error{
+		EType: apperrors.ETPreconditionFailed,
+		Op:    op,
+		Err:   err,
+		Stack: errors.WithStack(err),
+	}
+}
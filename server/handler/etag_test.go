@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMatchInts_notFoundWhenNoHeader(t *testing.T) {
+	v, found, err := IfMatchInts("", requestEmpty(t, "PUT", "/messages/1"))
+	require.NoError(t, err)
+	require.False(t, found)
+	require.Empty(t, v)
+}
+
+func TestIfMatchInts_canReadVersions(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected []int
+	}{
+		{`"5"`, []int{5}},
+		{` "12" `, []int{12}},
+		{`*`, nil},
+		{`"5", "6"`, []int{5, 6}},
+		{`W/"4", "abc", "7"`, []int{7}},
+	}
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			r := requestEmpty(t, "PUT", "/messages/1")
+			r.Header.Set("If-Match", c.header)
+			v, found, err := IfMatchInts("", r)
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, c.expected, v)
+		})
+	}
+}
+
+func TestIfMatchInts_preconditionFailedWhenNoTagCanMatch(t *testing.T) {
+	cases := []string{
+		`W/"5"`,
+		`"abc"`,
+		`"0"`,
+		`"-1"`,
+		`W/"5", "0"`,
+	}
+	for _, header := range cases {
+		t.Run(header, func(t *testing.T) {
+			r := requestEmpty(t, "PUT", "/messages/1")
+			r.Header.Set("If-Match", header)
+			_, _, err := IfMatchInts("", r)
+			require.Equal(t, apperrors.ETPreconditionFailed, err.(*apperrors.Error).EType)
+		})
+	}
+}
+
+func TestIfMatchInts_errorWhenInvalid(t *testing.T) {
+	cases := []string{`5`, `"5`, `"5", 6`}
+	for _, header := range cases {
+		t.Run(header, func(t *testing.T) {
+			r := requestEmpty(t, "PUT", "/messages/1")
+			r.Header.Set("If-Match", header)
+			_, _, err := IfMatchInts("", r)
+			require.Equal(t, `{"errors":[{"error":"invalid If-Match header","code":"header.ifMatch.invalid"}]}`,
+				errorJson(t, err))
+		})
+	}
+}
+
+func TestParseETags(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected []entityTag
+		ok       bool
+	}{
+		{`"1"`, []entityTag{{opaque: "1"}}, true},
+		{`W/"1"`, []entityTag{{weak: true, opaque: "1"}}, true},
+		{`"1", W/"2" ,"a,b"`, []entityTag{{opaque: "1"}, {weak: true, opaque: "2"}, {opaque: "a,b"}}, true},
+		{``, nil, false},
+		{`1`, nil, false},
+		{`"1`, nil, false},
+		{`"1" "2"`, nil, false},
+		{`w/"1"`, nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			tags, ok := parseETags(c.header)
+			require.Equal(t, c.ok, ok)
+			require.Equal(t, c.expected, tags)
+		})
+	}
+}
+
+func TestNotModified_ifNoneMatch(t *testing.T) {
+	cases := []struct {
+		name        string
+		etag        string
+		ifNoneMatch string
+		expected    bool
+	}{
+		{"matching strong tag", `"2"`, `"2"`, true},
+		{"weak comparison of weak request tag", `"2"`, `W/"2"`, true},
+		{"weak comparison of weak current tag", `W/"2"`, `"2"`, true},
+		{"tag in a list", `"2"`, `"1", "2", "3"`, true},
+		{"star", `"2"`, `*`, true},
+		{"different tag", `"2"`, `"1"`, false},
+		{"different tags", `"2"`, `"1", W/"3"`, false},
+		{"malformed", `"2"`, `2`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := requestEmpty(t, "GET", "/messages/1")
+			r.Header.Set("If-None-Match", c.ifNoneMatch)
+			rr := httptest.NewRecorder()
+			rr.Header().Set("ETag", c.etag)
+			require.Equal(t, c.expected, NotModified(rr, r))
+			if c.expected {
+				require.Equal(t, http.StatusNotModified, rr.Code)
+			}
+		})
+	}
+}
+
+func TestNotModified_ifModifiedSince(t *testing.T) {
+	lastModified := time.Date(2021, 6, 2, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		since    string
+		expected bool
+	}{
+		{"same time", LastModifiedFormat(lastModified), true},
+		{"later", LastModifiedFormat(lastModified.Add(time.Hour)), true},
+		{"earlier", LastModifiedFormat(lastModified.Add(-time.Second)), false},
+		{"invalid date", "yesterday", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := requestEmpty(t, "GET", "/messages/1")
+			r.Header.Set("If-Modified-Since", c.since)
+			rr := httptest.NewRecorder()
+			SetLastModified(rr, lastModified)
+			require.Equal(t, c.expected, NotModified(rr, r))
+		})
+	}
+}
+
+func TestNotModified_ifNoneMatchTakesPrecedenceOverIfModifiedSince(t *testing.T) {
+	lastModified := time.Date(2021, 6, 2, 10, 30, 0, 0, time.UTC)
+	r := requestEmpty(t, "GET", "/messages/1")
+	r.Header.Set("If-None-Match", `"1"`)
+	r.Header.Set("If-Modified-Since", LastModifiedFormat(lastModified))
+	rr := httptest.NewRecorder()
+	SetETagInt(rr, 2)
+	SetLastModified(rr, lastModified)
+	require.False(t, NotModified(rr, r))
+}
+
+func TestSetETagIntVariant(t *testing.T) {
+	rr := httptest.NewRecorder()
+	SetETagIntVariant(rr, 2, "")
+	require.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	SetETagIntVariant(rr, 2, "fields=id")
+	etag := rr.Header().Get("ETag")
+	require.Regexp(t, `^"2-[0-9a-f]{16}"$`, etag)
+
+	SetETagIntVariant(rr, 2, "fields=id,message")
+	require.NotEqual(t, etag, rr.Header().Get("ETag"))
+}
+
+func TestNotModified_onlyForGetAndHead(t *testing.T) {
+	r := requestEmpty(t, "PUT", "/messages/1")
+	r.Header.Set("If-None-Match", `*`)
+	rr := httptest.NewRecorder()
+	SetETagInt(rr, 2)
+	require.False(t, NotModified(rr, r))
+}
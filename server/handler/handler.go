@@ -5,10 +5,15 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/localize"
 	"github.com/mdev5000/messageappdemo/logging"
 	"github.com/pkg/errors"
 )
@@ -18,35 +23,90 @@ const ContentTypeJson = "application/json; charset=UTF-8"
 func DecodeJsonOrError(log *logging.Logger, op string, w http.ResponseWriter, r *http.Request, v interface{}) bool {
 	if r.Body == nil {
 		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
-		appErr.AddResponse(apperrors.ErrorResponse("invalid json"))
-		SendErrorResponse(log, op, w, &appErr)
+		appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeRequestJsonInvalid, "invalid json"))
+		SendErrorResponse(log, op, w, r, &appErr)
 		return false
 	}
 	d := json.NewDecoder(r.Body)
 	if err := d.Decode(v); err != nil {
 		if err.Error() == "http: request body too large" {
 			appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err, Stack: errors.WithStack(err)}
-			appErr.AddResponse(apperrors.ErrorResponse("request body too large"))
-			SendErrorResponse(log, op, w, &appErr)
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeRequestBodyTooLarge, "request body too large"))
+			SendErrorResponse(log, op, w, r, &appErr)
 			return false
 		}
 		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err, Stack: errors.WithStack(err)}
-		appErr.AddResponse(apperrors.ErrorResponse("invalid json"))
-		SendErrorResponse(log, op, w, &appErr)
+		appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeRequestJsonInvalid, "invalid json"))
+		SendErrorResponse(log, op, w, r, &appErr)
 		return false
 	}
 	return true
 }
 
-func SendErrorResponse(log *logging.Logger, op string, w http.ResponseWriter, err error) {
+// ReadBodyOrError reads the full request body. When the body cannot be read an error response is sent and false is
+// returned.
+func ReadBodyOrError(log *logging.Logger, op string, w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Body == nil {
+		return nil, true
+	}
+	d, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err, Stack: errors.WithStack(err)}
+		if err.Error() == "http: request body too large" {
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeRequestBodyTooLarge, "request body too large"))
+		} else {
+			appErr.AddResponse(
+				apperrors.ErrorResponse(apperrors.CodeRequestBodyUnreadable, "failed to read request body"))
+		}
+		SendErrorResponse(log, op, w, r, &appErr)
+		return nil, false
+	}
+	return d, true
+}
+
+// SendErrorResponse responds with the status code of an error (see apperrors.StatusCode) and, for errors with a user
+// response, a JSON body of the responses. Internal errors are logged. When the client accepts problem details (see
+// AcceptsProblemJSON) every error is instead sent as an application/problem+json body, see apperrors.ToProblem.
+//
+// User responses are sent in the language of the request context (see localize.LanguageFrom), English when they have
+// no translation.
+func SendErrorResponse(log *logging.Logger, op string, w http.ResponseWriter, r *http.Request, err error) {
 	if apperrors.IsInternal(err) {
 		log.LogError(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
 
 	code := apperrors.StatusCode(err)
 
+	if retryAfter, ok := apperrors.RetryAfter(err); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	if apperrors.HasResponse(err) {
+		lang := localize.LanguageFrom(r.Context())
+		err = localize.Error(err, lang)
+		w.Header().Set("Content-Language", lang.String())
+	}
+
+	if AcceptsProblemJSON(r) {
+		out, jsonErr := apperrors.ToProblemJSON(err, r.URL.RequestURI())
+		if jsonErr != nil {
+			log.LogFailedToEncode(op, err, jsonErr, errors.WithStack(jsonErr))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", apperrors.ProblemContentType)
+		w.WriteHeader(code)
+		if r.Method != "HEAD" {
+			writeData(op, log, w, out)
+		}
+		return
+	}
+
+	if apperrors.IsInternal(err) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	if !apperrors.HasResponse(err) {
 		w.WriteHeader(code)
 		return
@@ -64,6 +124,29 @@ func SendErrorResponse(log *logging.Logger, op string, w http.ResponseWriter, er
 	writeData(op, log, w, out)
 }
 
+// AcceptsProblemJSON returns whether the Accept header of the request explicitly includes the problem details media
+// type (application/problem+json), meaning errors should be sent as problem details. Wildcards (ex. */*) do not count,
+// so clients that do not ask for problem details keep receiving the original error responses.
+func AcceptsProblemJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			params := strings.Split(mediaRange, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), apperrors.ProblemContentType) {
+				continue
+			}
+			accepted := true
+			for _, param := range params[1:] {
+				if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 && kv[0] == "q" {
+					q, err := strconv.ParseFloat(kv[1], 64)
+					accepted = err == nil && q > 0
+				}
+			}
+			return accepted
+		}
+	}
+	return false
+}
+
 func writeData(op string, log *logging.Logger, w http.ResponseWriter, data []byte) bool {
 	if _, errWrite := w.Write(data); errWrite != nil {
 		log.LogError(&apperrors.Error{
@@ -93,6 +176,28 @@ func EncodeJsonOrError(op string, log *logging.Logger, w http.ResponseWriter, r
 	return writeData(op, log, w, d)
 }
 
+// EncodeJsonWithETagOrError is the same as EncodeJsonOrError, but also sets a weak ETag derived from the encoded value
+// and responds with 304 Not Modified when the client's copy is still current (see NotModified). This is useful for
+// resources that do not have a version of their own (ex. collections).
+func EncodeJsonWithETagOrError(op string, log *logging.Logger, w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	d, jsonErr := json.Marshal(v)
+	if jsonErr != nil {
+		log.LogFailedToEncode(op, jsonErr, jsonErr, errors.WithStack(jsonErr))
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("ETag", WeakETag(d))
+	if NotModified(w, r) {
+		return true
+	}
+	contentTypeJson(w)
+	// Don't return content if a HEAD request.
+	if r.Method == "HEAD" {
+		return true
+	}
+	return writeData(op, log, w, d)
+}
+
 func contentTypeJson(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", ContentTypeJson)
 }
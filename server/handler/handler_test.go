@@ -3,24 +3,29 @@ package handler
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/localize"
 	"github.com/mdev5000/messageappdemo/logging"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
 )
 
 func TestSendErrorResponse_internalErrorReturns500(t *testing.T) {
 	log := logging.NoLog()
 	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages/1", nil)
 	err := &apperrors.Error{
 		EType: apperrors.ETInternal,
 		Err:   errors.New("some error"),
 	}
-	SendErrorResponse(log, "op", rr, err)
+	SendErrorResponse(log, "op", rr, r, err)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.Nil(t, rr.Body.Bytes())
 }
@@ -28,7 +33,8 @@ func TestSendErrorResponse_internalErrorReturns500(t *testing.T) {
 func TestSendErrorResponse_nonAppErrorReturns500(t *testing.T) {
 	log := logging.NoLog()
 	rr := httptest.NewRecorder()
-	SendErrorResponse(log, "op", rr, errors.New("my error"))
+	r := httptest.NewRequest("GET", "/messages/1", nil)
+	SendErrorResponse(log, "op", rr, r, errors.New("my error"))
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 	require.Nil(t, rr.Body.Bytes())
 }
@@ -36,21 +42,50 @@ func TestSendErrorResponse_nonAppErrorReturns500(t *testing.T) {
 func TestSendErrorResponse_invalidErrorReturnsErrorResponseWhenResponse(t *testing.T) {
 	log := logging.NoLog()
 	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages/1", nil)
 	err := &apperrors.Error{
 		EType: apperrors.ETInvalid,
 		Err:   errors.New("some error"),
 	}
-	err.AddResponse(apperrors.ErrorResponse("something happened"))
-	SendErrorResponse(log, "op", rr, err)
+	err.AddResponse(apperrors.ErrorResponse("thing.invalid", "something happened"))
+	SendErrorResponse(log, "op", rr, r, err)
 	require.Equal(t, http.StatusBadRequest, rr.Code)
-	require.Equal(t, `{"errors":[{"error":"something happened"}]}`, rr.Body.String())
+	require.Equal(t, `{"errors":[{"error":"something happened","code":"thing.invalid"}]}`, rr.Body.String())
+}
+
+func TestSendErrorResponse_sendsResponsesInTheLanguageOfTheRequest(t *testing.T) {
+	log := logging.NoLog()
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages?pageSize=a", nil)
+	r = r.WithContext(localize.WithLanguage(r.Context(), language.French))
+	err := &apperrors.Error{EType: apperrors.ETInvalid}
+	err.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryPageSizeInvalid, "invalid pageSize value"))
+	SendErrorResponse(log, "op", rr, r, err)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "fr", rr.Header().Get("Content-Language"))
+	require.Equal(t, `{"errors":[{"error":"valeur pageSize invalide","code":"query.pageSize.invalid"}]}`,
+		rr.Body.String())
+	require.Equal(t, "invalid pageSize value", err.Responses[0].(apperrors.ErrResponse).Error,
+		"the original error is not changed")
+}
+
+func TestSendErrorResponse_sendsRetryAfter(t *testing.T) {
+	log := logging.NoLog()
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages", nil)
+	err := &apperrors.Error{EType: apperrors.ETRateLimited, RetryAfter: 1500 * time.Millisecond}
+	SendErrorResponse(log, "op", rr, r, fmt.Errorf("wrapped: %w", err))
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "2", rr.Header().Get("Retry-After"))
+	require.Nil(t, rr.Body.Bytes())
 }
 
 func TestSendErrorResponse_returns404WhenNotFound(t *testing.T) {
 	log := logging.NoLog()
 	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages/1", nil)
 	err := &apperrors.Error{EType: apperrors.ETNotFound}
-	SendErrorResponse(log, "op", rr, err)
+	SendErrorResponse(log, "op", rr, r, err)
 	require.Equal(t, http.StatusNotFound, rr.Code)
 	require.Nil(t, rr.Body.Bytes())
 }
@@ -58,15 +93,81 @@ func TestSendErrorResponse_returns404WhenNotFound(t *testing.T) {
 func TestSendErrorResponse_returns500WhenCannotEncodeErrorMessage(t *testing.T) {
 	log := logging.NoLog()
 	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages/1", nil)
 	err := &apperrors.Error{
 		EType: apperrors.ETInvalid,
 		Err:   errors.New("some error"),
 	}
 	err.AddResponse(unsafe.Pointer(nil))
-	SendErrorResponse(log, "op", rr, err)
+	SendErrorResponse(log, "op", rr, r, err)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
+func TestSendErrorResponse_sendsProblemDetailsWhenAccepted(t *testing.T) {
+	log := logging.NoLog()
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/messages?pageSize=a", nil)
+	r.Header.Set("Accept", "application/json, application/problem+json")
+	err := &apperrors.Error{
+		EType: apperrors.ETInvalid,
+		Err:   errors.New("some error"),
+	}
+	err.AddResponse(apperrors.FieldErrorResponse{Field: "pageSize", Error: "invalid pageSize value",
+		Code: apperrors.CodeQueryPageSizeInvalid})
+	SendErrorResponse(log, "op", rr, r, err)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, apperrors.ProblemContentType, rr.Header().Get("Content-Type"))
+	require.Equal(t, `{"type":"urn:messageappdemo:problem:invalid","title":"Invalid request","status":400,`+
+		`"detail":"The request is invalid, see errors for the details.","instance":"/messages?pageSize=a",`+
+		`"errors":[{"field":"pageSize","error":"invalid pageSize value",`+
+		`"code":"query.pageSize.invalid"}]}`, rr.Body.String())
+}
+
+func TestSendErrorResponse_sendsProblemDetailsForEveryError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"not found", &apperrors.Error{EType: apperrors.ETNotFound}, `{"type":"urn:messageappdemo:problem:not-found",` +
+			`"title":"Not found","status":404,"detail":"The requested resource does not exist.","instance":"/messages/1"}`},
+		{"internal", errors.New("secret"), `{"type":"urn:messageappdemo:problem:internal","title":"Internal error",` +
+			`"status":500,"detail":"An unexpected error occurred while processing the request.","instance":"/messages/1"}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/messages/1", nil)
+			r.Header.Set("Accept", "application/problem+json")
+			SendErrorResponse(logging.NoLog(), "op", rr, r, c.err)
+			require.Equal(t, apperrors.ProblemContentType, rr.Header().Get("Content-Type"))
+			require.Equal(t, c.expected, rr.Body.String())
+		})
+	}
+}
+
+func TestAcceptsProblemJSON(t *testing.T) {
+	cases := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/json;q=0.9, Application/Problem+JSON", true},
+		{"application/problem+json; q=0.5", true},
+		{"application/problem+json;q=0", false},
+	}
+	for _, c := range cases {
+		t.Run(c.accept, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", c.accept)
+			require.Equal(t, c.expected, AcceptsProblemJSON(r))
+		})
+	}
+}
+
 func TestEncodeJsonOrError_canEncode(t *testing.T) {
 	log := logging.NoLog()
 	r, err := http.NewRequest("GET", "/", bytes.NewBuffer(nil))
@@ -85,3 +186,20 @@ func TestEncodeJsonOrError_returns500whenEncodingFails(t *testing.T) {
 	require.False(t, EncodeJsonOrError("op", log, rr, r, unsafe.Pointer(nil)))
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 }
+
+func TestEncodeJsonWithETagOrError_setsETagAndCanRespondNotModified(t *testing.T) {
+	log := logging.NoLog()
+	r, err := http.NewRequest("GET", "/", bytes.NewBuffer(nil))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	require.True(t, EncodeJsonWithETagOrError("op", log, rr, r, "encode this"))
+	etag := rr.Header().Get("ETag")
+	require.Equal(t, WeakETag([]byte(`"encode this"`)), etag)
+	require.Equal(t, `"encode this"`, rr.Body.String())
+
+	r.Header.Set("If-None-Match", etag)
+	rr2 := httptest.NewRecorder()
+	require.True(t, EncodeJsonWithETagOrError("op", log, rr2, r, "encode this"))
+	require.Equal(t, http.StatusNotModified, rr2.Code)
+	require.Equal(t, "", rr2.Body.String())
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContentTypeMergePatch is the media type for JSON Merge Patch documents (RFC 7396).
+	ContentTypeMergePatch = "application/merge-patch+json"
+
+	// ContentTypeJsonPatch is the media type for JSON Patch documents (RFC 6902).
+	ContentTypeJsonPatch = "application/json-patch+json"
+)
+
+// AcceptPatch is the value of the Accept-Patch header, listing the patch media types supported by PATCH requests.
+var AcceptPatch = strings.Join([]string{ContentTypeMergePatch, ContentTypeJsonPatch}, ", ")
+
+// PatchContentType returns the patch media type of the request. It returns false when the Content-Type is not a
+// supported patch media type.
+func PatchContentType(r *http.Request) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", false
+	}
+	switch mediaType {
+	case ContentTypeMergePatch, ContentTypeJsonPatch:
+		return mediaType, true
+	default:
+		return "", false
+	}
+}
+
+// ApplyPatch applies a patch document of the given media type (see PatchContentType) to a JSON document. An ETInvalid
+// error is returned when the patch is malformed or cannot be applied to the document.
+func ApplyPatch(op string, mediaType string, doc, patch []byte) ([]byte, error) {
+	switch mediaType {
+	case ContentTypeMergePatch:
+		out, err := jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return nil, patchError(op, apperrors.CodePatchMergePatchInvalid, "invalid merge patch", err)
+		}
+		return out, nil
+	case ContentTypeJsonPatch:
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, patchError(op, apperrors.CodePatchJsonPatchInvalid, "invalid json patch", err)
+		}
+		out, err := p.Apply(doc)
+		if err != nil {
+			return nil, patchError(op, apperrors.CodePatchJsonPatchFailed, "json patch could not be applied", err)
+		}
+		return out, nil
+	default:
+		err := errors.Errorf("unsupported patch media type %s", mediaType)
+		return nil, &apperrors.Error{EType: apperrors.ETInternal, Op: op, Err: err, Stack: err}
+	}
+}
+
+func patchError(op string, code, msg string, err error) error {
+	appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err, Stack: errors.WithStack(err)}
+	appErr.AddResponse(apperrors.ErrorResponse(code, msg))
+	return &appErr
+}
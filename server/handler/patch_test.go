@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    string
+		ok          bool
+	}{
+		{"application/merge-patch+json", ContentTypeMergePatch, true},
+		{"application/json-patch+json; charset=UTF-8", ContentTypeJsonPatch, true},
+		{"application/json; charset=UTF-8", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.contentType, func(t *testing.T) {
+			r := requestEmpty(t, "PATCH", "/messages/1")
+			r.Header.Set("Content-Type", c.contentType)
+			mediaType, ok := PatchContentType(r)
+			require.Equal(t, c.ok, ok)
+			require.Equal(t, c.expected, mediaType)
+		})
+	}
+}
+
+func TestApplyPatch_mergePatch(t *testing.T) {
+	out, err := ApplyPatch("", ContentTypeMergePatch, []byte(`{"message":"first"}`), []byte(`{"message":"second"}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"message":"second"}`, string(out))
+}
+
+func TestApplyPatch_mergePatchCanRemoveFields(t *testing.T) {
+	out, err := ApplyPatch("", ContentTypeMergePatch, []byte(`{"message":"first"}`), []byte(`{"message":null}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{}`, string(out))
+}
+
+func TestApplyPatch_jsonPatch(t *testing.T) {
+	out, err := ApplyPatch("", ContentTypeJsonPatch, []byte(`{"message":"first"}`), []byte(`[`+
+		`{"op":"test","path":"/message","value":"first"},`+
+		`{"op":"replace","path":"/message","value":"second"}`+
+		`]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"message":"second"}`, string(out))
+}
+
+func TestApplyPatch_errors(t *testing.T) {
+	cases := []struct {
+		name      string
+		mediaType string
+		patch     string
+		expected  string
+	}{
+		{"invalid merge patch", ContentTypeMergePatch, `{{`, `{"errors":[{"error":"invalid merge patch",` +
+			`"code":"patch.mergePatch.invalid"}]}`},
+		{"invalid json patch", ContentTypeJsonPatch, `{"op":"replace"}`, `{"errors":[{"error":"invalid json patch",` +
+			`"code":"patch.jsonPatch.invalid"}]}`},
+		{
+			"failed json patch test",
+			ContentTypeJsonPatch,
+			`[{"op":"test","path":"/message","value":"other"}]`,
+			`{"errors":[{"error":"json patch could not be applied","code":"patch.jsonPatch.failed"}]}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ApplyPatch("", c.mediaType, []byte(`{"message":"first"}`), []byte(c.patch))
+			require.Equal(t, c.expected, errorJson(t, err))
+		})
+	}
+}
@@ -1,51 +1,214 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
 )
 
+// QueryParams are the common query parameters used for filtering the results contained within a REST store.
+type QueryParams struct {
+	Fields map[string]struct{}
+
+	// Filters are the conditions the results must match, ordered by field and operator.
+	Filters []FilterParam
+
+	// Sort are the fields to sort the results by in order of precedence.
+	Sort []SortKey
+
+	Limit  uint64
+	Offset uint64
+
+	// After and Before are the opaque cursor tokens (see CursorCodec) of the page to retrieve. At most one is set and
+	// neither is set when paging via an offset.
+	After  string
+	Before string
+
+	// IncludeTotal is whether the total number of results (across all pages) was requested.
+	IncludeTotal bool
+}
+
+// SortKey is a field to sort by, in descending order when Desc is true.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// FilterParam is a condition on a field of the results, given as filter[<field>][<op>]=<value>.
+type FilterParam struct {
+	Field string
+	Op    string
+	Value string
+}
+
+var filterParamRe = regexp.MustCompile(`^filter\[([^\[\]]+)\]\[([^\[\]]+)\]$`)
+
 // GetQueryParams extracts common query parameters that are used for filtering the results contained with a REST store.
-// Ex. ?fields=only,some&pageSize=20&pageStartIndex=10 = fields=[]string{only,some}, limit=20, offset=200
-func GetQueryParams(op string, r *http.Request) (fields map[string]struct{}, limit uint64, offset uint64, err error) {
-	fields = map[string]struct{}{}
+// Ex. ?fields=only,some&pageSize=20&pageStartIndex=10 = fields=[]string{only,some}, limit=20, offset=180
+//
+// Results can be sorted by one or more fields, descending when prefixed with a -, ex. ?sort=-createdAt,id. Whether
+// a field can be sorted by is left to the store.
+//
+// Results can be filtered via filter[<field>][<op>]=<value> parameters, ex. ?filter[version][gt]=3. Which fields,
+// operators and values are valid is left to the store.
+//
+// Pages can also be retrieved via cursors, ex. ?pageSize=20&after=<token>, see PageLink.
+//
+// The total number of results can be requested via ?includeTotal=true.
+func GetQueryParams(op string, r *http.Request) (params QueryParams, err error) {
+	params.Fields = map[string]struct{}{}
+	query := r.URL.Query()
 
-	if limitS := r.URL.Query().Get("pageSize"); limitS != "" {
-		limit, err = strconv.ParseUint(limitS, 10, 64)
-		if err != nil || limit < 1 {
+	if limitS := query.Get("pageSize"); limitS != "" {
+		params.Limit, err = strconv.ParseUint(limitS, 10, 64)
+		if err != nil || params.Limit < 1 {
 			re := ResponseError(op)
-			re.AddResponse("invalid pageSize value")
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryPageSizeInvalid, "invalid pageSize value"))
 			err = &re
 			return
 		}
 	}
 
-	if offsetS := r.URL.Query().Get("pageStartIndex"); offsetS != "" {
+	params.After = query.Get("after")
+	params.Before = query.Get("before")
+	if params.After != "" && params.Before != "" {
+		re := ResponseError(op)
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryCursorsConflict,
+			"after and before cannot be used together"))
+		err = &re
+		return
+	}
+
+	if offsetS := query.Get("pageStartIndex"); offsetS != "" {
+		if params.After != "" || params.Before != "" {
+			re := ResponseError(op)
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryPageStartIndexCursor,
+				"pageStartIndex cannot be used with after or before"))
+			err = &re
+			return
+		}
 		pageOffset, errPO := strconv.ParseUint(offsetS, 10, 64)
 		if errPO != nil || pageOffset < 1 {
 			re := ResponseError(op)
-			re.AddResponse("invalid pageStartIndex value")
+			re.AddResponse(
+				apperrors.ErrorResponse(apperrors.CodeQueryPageStartIndexInvalid, "invalid pageStartIndex value"))
 			err = &re
 			return
 		}
-		if limit == 0 {
-			offset = pageOffset
+		if params.Limit == 0 {
+			params.Offset = pageOffset
 		} else {
-			offset = (pageOffset - 1) * limit
+			params.Offset = (pageOffset - 1) * params.Limit
 		}
 	}
 
-	if fieldsS := r.URL.Query().Get("fields"); fieldsS != "" {
+	if totalS := query.Get("includeTotal"); totalS != "" {
+		params.IncludeTotal, err = strconv.ParseBool(totalS)
+		if err != nil {
+			re := ResponseError(op)
+			re.AddResponse(
+				apperrors.ErrorResponse(apperrors.CodeQueryIncludeTotalInvalid, "invalid includeTotal value"))
+			err = &re
+			return
+		}
+	}
+
+	if fieldsS := query.Get("fields"); fieldsS != "" {
 		fieldsRaw := strings.Split(fieldsS, ",")
 		for _, fRaw := range fieldsRaw {
 			fRaw = strings.TrimSpace(fRaw)
 			if fRaw == "" {
 				continue
 			}
-			fields[fRaw] = struct{}{}
+			params.Fields[fRaw] = struct{}{}
+		}
+	}
+
+	params.Filters, err = parseFilters(op, query)
+	if err != nil {
+		return
+	}
+
+	if sortS := query.Get("sort"); sortS != "" {
+		params.Sort, err = parseSort(op, sortS)
+		if err != nil {
+			return
 		}
 	}
 
 	return
 }
+
+func parseFilters(op string, query url.Values) ([]FilterParam, error) {
+	var keys []string
+	for key := range query {
+		if key == "filter" || strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var filters []FilterParam
+	for _, key := range keys {
+		match := filterParamRe.FindStringSubmatch(key)
+		if match == nil {
+			re := ResponseError(op)
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryFilterInvalid,
+				fmt.Sprintf("invalid filter parameter: %s", key)).WithArgs(map[string]interface{}{"param": key}))
+			return nil, &re
+		}
+		for _, value := range query[key] {
+			filters = append(filters, FilterParam{Field: match[1], Op: match[2], Value: value})
+		}
+	}
+	return filters, nil
+}
+
+func parseSort(op, sortS string) ([]SortKey, error) {
+	var keys []SortKey
+	seen := map[string]struct{}{}
+	for _, raw := range strings.Split(sortS, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		key := SortKey{Field: raw}
+		if strings.HasPrefix(raw, "-") {
+			key = SortKey{Field: strings.TrimSpace(raw[1:]), Desc: true}
+		}
+		if key.Field == "" {
+			re := ResponseError(op)
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQuerySortInvalid, "invalid sort value"))
+			return nil, &re
+		}
+		if _, found := seen[key.Field]; found {
+			re := ResponseError(op)
+			re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQuerySortDuplicate,
+				fmt.Sprintf("duplicate sort field: %s", key.Field)).
+				WithArgs(map[string]interface{}{"field": key.Field}))
+			return nil, &re
+		}
+		seen[key.Field] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// PageLink creates a RFC 8288 Link header value (ex. </messages?after=abc&pageSize=10>; rel="next") for another page
+// of the requested collection. The link keeps the query parameters of the request, but replaces the page position
+// with the cursor token given for param (either after or before).
+func PageLink(r *http.Request, rel, param, token string) string {
+	query := r.URL.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Del("pageStartIndex")
+	query.Set(param, token)
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+}
@@ -30,8 +30,9 @@ func TestGetQueryParams_errorOnInvalidPageSize(t *testing.T) {
 	}
 	for _, value := range cases {
 		t.Run("invalid pageSize="+value, func(t *testing.T) {
-			_, _, _, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?pageSize="+value))
-			require.Equal(t, "{\"errors\":[\"invalid pageSize value\"]}", errorJson(t, err))
+			_, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?pageSize="+value))
+			require.Equal(t, "{\"errors\":[{\"error\":\"invalid pageSize value\","+
+				"\"code\":\"query.pageSize.invalid\"}]}", errorJson(t, err))
 		})
 	}
 }
@@ -45,8 +46,120 @@ func TestGetQueryParams_errorOnInvalidPageStartIndex(t *testing.T) {
 	}
 	for _, value := range cases {
 		t.Run("invalid pageSize="+value, func(t *testing.T) {
-			_, _, _, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?pageStartIndex="+value))
-			require.Equal(t, "{\"errors\":[\"invalid pageStartIndex value\"]}", errorJson(t, err))
+			_, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?pageStartIndex="+value))
+			require.Equal(t, "{\"errors\":[{\"error\":\"invalid pageStartIndex value\","+
+				"\"code\":\"query.pageStartIndex.invalid\"}]}", errorJson(t, err))
 		})
 	}
 }
+
+func TestGetQueryParams(t *testing.T) {
+	params, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?fields=id,+message,&pageSize=20&pageStartIndex=3"))
+	require.NoError(t, err)
+	require.Equal(t, QueryParams{
+		Fields: map[string]struct{}{"id": {}, "message": {}},
+		Limit:  20,
+		Offset: 40,
+	}, params)
+
+	params, err = GetQueryParams("", requestEmpty(t, "GET", "/messages?pageSize=20&after=abc"))
+	require.NoError(t, err)
+	require.Equal(t, "abc", params.After)
+
+	params, err = GetQueryParams("", requestEmpty(t, "GET", "/messages?before=abc"))
+	require.NoError(t, err)
+	require.Equal(t, "abc", params.Before)
+}
+
+func TestGetQueryParams_includeTotal(t *testing.T) {
+	params, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?includeTotal=true"))
+	require.NoError(t, err)
+	require.True(t, params.IncludeTotal)
+
+	params, err = GetQueryParams("", requestEmpty(t, "GET", "/messages?includeTotal=false"))
+	require.NoError(t, err)
+	require.False(t, params.IncludeTotal)
+
+	_, err = GetQueryParams("", requestEmpty(t, "GET", "/messages?includeTotal=yes"))
+	require.Equal(t, `{"errors":[{"error":"invalid includeTotal value",`+
+		`"code":"query.includeTotal.invalid"}]}`, errorJson(t, err))
+}
+
+func TestGetQueryParams_errorOnInvalidCursorCombinations(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"after=a&before=b", `{"errors":[{"error":"after and before cannot be used together",` +
+			`"code":"query.cursors.conflict"}]}`},
+		{"after=a&pageStartIndex=2", `{"errors":[{"error":"pageStartIndex cannot be used with after or before",` +
+			`"code":"query.pageStartIndex.withCursor"}]}`},
+		{"before=a&pageStartIndex=2", `{"errors":[{"error":"pageStartIndex cannot be used with after or before",` +
+			`"code":"query.pageStartIndex.withCursor"}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			_, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?"+c.query))
+			require.Equal(t, c.expected, errorJson(t, err))
+		})
+	}
+}
+
+func TestGetQueryParams_sort(t *testing.T) {
+	params, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?sort=-createdAt,+id,"))
+	require.NoError(t, err)
+	require.Equal(t, []SortKey{{Field: "createdAt", Desc: true}, {Field: "id"}}, params.Sort)
+}
+
+func TestGetQueryParams_errorOnInvalidSort(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"sort=-", `{"errors":[{"error":"invalid sort value","code":"query.sort.invalid"}]}`},
+		{"sort=id,-", `{"errors":[{"error":"invalid sort value","code":"query.sort.invalid"}]}`},
+		{"sort=id,-id", `{"errors":[{"error":"duplicate sort field: id","code":"query.sort.duplicate"}]}`},
+		{"sort=createdAt,createdAt", `{"errors":[{"error":"duplicate sort field: createdAt",` +
+			`"code":"query.sort.duplicate"}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			_, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?"+c.query))
+			require.Equal(t, c.expected, errorJson(t, err))
+		})
+	}
+}
+
+func TestGetQueryParams_filters(t *testing.T) {
+	uri := "/messages?filter[version][gt]=3&filter[createdAt][gte]=2021-05-01T00:00:00Z&filter[version][lt]=5&filter[version][lt]=6"
+	params, err := GetQueryParams("", requestEmpty(t, "GET", uri))
+	require.NoError(t, err)
+	require.Equal(t, []FilterParam{
+		{Field: "createdAt", Op: "gte", Value: "2021-05-01T00:00:00Z"},
+		{Field: "version", Op: "gt", Value: "3"},
+		{Field: "version", Op: "lt", Value: "5"},
+		{Field: "version", Op: "lt", Value: "6"},
+	}, params.Filters)
+}
+
+func TestGetQueryParams_errorOnInvalidFilterParameter(t *testing.T) {
+	cases := []string{
+		"filter",
+		"filter[version]",
+		"filter[version][]",
+		"filter[version][gt][x]",
+		"filter[][gt]",
+	}
+	for _, key := range cases {
+		t.Run(key, func(t *testing.T) {
+			_, err := GetQueryParams("", requestEmpty(t, "GET", "/messages?"+key+"=1"))
+			require.Equal(t, `{"errors":[{"error":"invalid filter parameter: `+key+`",`+
+				`"code":"query.filter.invalid"}]}`, errorJson(t, err))
+		})
+	}
+}
+
+func TestPageLink(t *testing.T) {
+	r := requestEmpty(t, "GET", "/messages?fields=id&pageSize=2&before=old&pageStartIndex=3")
+	require.Equal(t, `</messages?after=abc&fields=id&pageSize=2>; rel="next"`, PageLink(r, "next", "after", "abc"))
+}
@@ -1,15 +1,13 @@
 package messages
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/mdev5000/messageappdemo/messages"
 )
 
-const (
-	fieldIsPalindrome = "isPalindrome"
-)
-
 type modifyMessageJSON struct {
 	Message string `json:"message"`
 }
@@ -22,6 +20,77 @@ func (m *modifyMessageJSON) toModifyMessage() messages.ModifyMessage {
 
 type MessageListResponseJSON struct {
 	Messages []MessageResponseJSON `json:"messages,omitempty"`
+
+	// Next and Prev are the cursors of the following and preceding pages.
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+
+	// TotalCount, PageSize and Page are only included when the total was requested (includeTotal=true). Page is the
+	// 1-based page number and is only included when paging via an offset.
+	TotalCount *int64 `json:"totalCount,omitempty"`
+	PageSize   uint64 `json:"pageSize,omitempty"`
+	Page       uint64 `json:"page,omitempty"`
+}
+
+// Contents of a page cursor token. Only the values of the fields the listing is sorted by are included.
+type cursorJSON struct {
+	// Sort is the sort order (same format as the sort query parameter) of the listing the cursor was created for.
+	Sort         string                  `json:"sort,omitempty"`
+	Id           messages.MessageId      `json:"id"`
+	Version      messages.MessageVersion `json:"version,omitempty"`
+	CreatedAt    *time.Time              `json:"createdAt,omitempty"`
+	UpdatedAt    *time.Time              `json:"updatedAt,omitempty"`
+	Message      *string                 `json:"message,omitempty"`
+	IsPalindrome *bool                   `json:"isPalindrome,omitempty"`
+}
+
+func (c cursorJSON) toCursor() *messages.Cursor {
+	cursor := messages.Cursor{Id: c.Id, Version: c.Version}
+	if c.CreatedAt != nil {
+		cursor.CreatedAt = *c.CreatedAt
+	}
+	if c.UpdatedAt != nil {
+		cursor.UpdatedAt = *c.UpdatedAt
+	}
+	if c.Message != nil {
+		cursor.Message = *c.Message
+	}
+	if c.IsPalindrome != nil {
+		cursor.IsPalindrome = *c.IsPalindrome
+	}
+	return &cursor
+}
+
+func cursorToJsonValue(c *messages.Cursor, sort []messages.SortKey) cursorJSON {
+	cj := cursorJSON{Sort: sortToString(sort), Id: c.Id}
+	for _, k := range sort {
+		switch k.Field {
+		case messages.FieldVersion:
+			cj.Version = c.Version
+		case messages.FieldCreatedAt:
+			cj.CreatedAt = &c.CreatedAt
+		case messages.FieldUpdatedAt:
+			cj.UpdatedAt = &c.UpdatedAt
+		case messages.FieldMessage:
+			cj.Message = &c.Message
+		case messages.FieldIsPalindrome:
+			cj.IsPalindrome = &c.IsPalindrome
+		}
+	}
+	return cj
+}
+
+// Formats sort keys the same as the sort query parameter, ex. -createdAt,id.
+func sortToString(sort []messages.SortKey) string {
+	keys := make([]string, len(sort))
+	for i, k := range sort {
+		if k.Desc {
+			keys[i] = "-" + k.Field
+		} else {
+			keys[i] = k.Field
+		}
+	}
+	return strings.Join(keys, ",")
 }
 
 type MessageResponseJSON struct {
@@ -31,27 +100,60 @@ type MessageResponseJSON struct {
 	UpdatedAt    *time.Time              `json:"updated_at,omitempty"`
 	Message      string                  `json:"message,omitempty"`
 	IsPalindrome *bool                   `json:"isPalindrome,omitempty"`
+	DeletedAt    *time.Time              `json:"deleted_at,omitempty"`
+
+	// LongestPalindrome is only included when requested via the fields, see messages.FieldLongestPalindrome.
+	LongestPalindrome *messages.PalindromeSpan `json:"longestPalindrome,omitempty"`
+
+	// Analysis is only included when analyzers were requested, see analysisField.
+	Analysis messages.Analysis `json:"analysis,omitempty"`
+}
+
+// SearchResultJSON is a message matching a search, only the requested message fields are included.
+type SearchResultJSON struct {
+	MessageResponseJSON
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+type SearchResponseJSON struct {
+	Messages []SearchResultJSON `json:"messages,omitempty"`
 }
 
 type fieldsMap = map[string]struct{}
 
-// Remove out fields that does not exist in the data layer (or they will cause errors).
-func filterDynamicFields(fields fieldsMap) fieldsMap {
-	out := fieldsMap{}
-	for field := range fields {
-		if field != fieldIsPalindrome {
-			out[field] = struct{}{}
+// Listings include the analysis of messages when the fields include analysis (every analyzer) or analysis.<analyzer>
+// (ex. analysis.wordCount).
+const analysisField = "analysis"
+
+// Splits the requested fields into the message fields and the analyzers. All is true when every analyzer is requested.
+func splitAnalysisFields(fields fieldsMap) (messageFields fieldsMap, analyzers []string, all bool) {
+	messageFields = make(fieldsMap, len(fields))
+	for f := range fields {
+		switch {
+		case f == analysisField:
+			all = true
+		case strings.HasPrefix(f, analysisField+"."):
+			analyzers = append(analyzers, strings.TrimPrefix(f, analysisField+"."))
+		default:
+			messageFields[f] = struct{}{}
 		}
 	}
-	return out
+	sort.Strings(analyzers)
+	return messageFields, analyzers, all
 }
 
 // Similar to messageToJsonValue, but only specified values.
 func queryMessageToJsonValue(message *messages.Message, fields fieldsMap) MessageResponseJSON {
-	mr := MessageResponseJSON{
-		Id:      message.Id,
-		Version: message.Version,
-		Message: message.Message,
+	var mr MessageResponseJSON
+	if hasField(fields, messages.FieldId) {
+		mr.Id = message.Id
+	}
+	if hasField(fields, messages.FieldVersion) {
+		mr.Version = message.Version
+	}
+	if hasField(fields, messages.FieldMessage) {
+		mr.Message = message.Message
 	}
 	if hasField(fields, messages.FieldCreatedAt) {
 		mr.CreatedAt = &message.CreatedAt
@@ -59,26 +161,53 @@ func queryMessageToJsonValue(message *messages.Message, fields fieldsMap) Messag
 	if hasField(fields, messages.FieldUpdatedAt) {
 		mr.UpdatedAt = &message.UpdatedAt
 	}
-	if hasField(fields, fieldIsPalindrome) {
-		isPalindrome := messages.IsPalindrome(message)
-		mr.IsPalindrome = &isPalindrome
+	if hasField(fields, messages.FieldIsPalindrome) {
+		mr.IsPalindrome = &message.IsPalindrome
 	}
+	if hasField(fields, messages.FieldLongestPalindrome) {
+		mr.LongestPalindrome = message.LongestPalindrome
+	}
+	mr.Analysis = message.Analysis
 	return mr
 }
 
+// Same as queryMessageToJsonValue, but for messages in the trash, which always include the deletion time.
+func deletedMessageToJsonValue(message *messages.Message, fields fieldsMap) MessageResponseJSON {
+	mr := queryMessageToJsonValue(message, fields)
+	mr.DeletedAt = message.DeletedAt
+	return mr
+}
+
+func searchResultToJsonValue(result *messages.SearchResult, fields fieldsMap) SearchResultJSON {
+	return SearchResultJSON{
+		MessageResponseJSON: queryMessageToJsonValue(&result.Message, fields),
+		Rank:                result.Rank,
+		Highlight:           result.Highlight,
+	}
+}
+
+// Returns the sorted names of the fields.
+func fieldNames(fields fieldsMap) []string {
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func hasField(fields map[string]struct{}, field string) bool {
 	_, found := fields[field]
 	return found
 }
 
 func messageToJsonValue(message *messages.Message) MessageResponseJSON {
-	isPalindrome := messages.IsPalindrome(message)
 	return MessageResponseJSON{
 		Id:           message.Id,
 		Version:      message.Version,
 		CreatedAt:    &message.CreatedAt,
 		UpdatedAt:    &message.UpdatedAt,
 		Message:      message.Message,
-		IsPalindrome: &isPalindrome,
+		IsPalindrome: &message.IsPalindrome,
 	}
 }
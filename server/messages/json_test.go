@@ -27,12 +27,12 @@ func TestQueryMessageValueToJson_canEncodeAllValues(t *testing.T) {
 		UpdatedAt: time.Date(2020, 10, 5, 3, 3, 4, 2, loc),
 		Message:   "some message",
 	}, fieldsMap{
-		messages.FieldId:        struct{}{},
-		messages.FieldVersion:   struct{}{},
-		messages.FieldCreatedAt: struct{}{},
-		messages.FieldUpdatedAt: struct{}{},
-		messages.FieldMessage:   struct{}{},
-		fieldIsPalindrome:       struct{}{},
+		messages.FieldId:           struct{}{},
+		messages.FieldVersion:      struct{}{},
+		messages.FieldCreatedAt:    struct{}{},
+		messages.FieldUpdatedAt:    struct{}{},
+		messages.FieldMessage:      struct{}{},
+		messages.FieldIsPalindrome: struct{}{},
 	})
 	out, err := json.Marshal(jsonValue)
 	require.NoError(t, err)
@@ -42,3 +42,29 @@ func TestQueryMessageValueToJson_canEncodeAllValues(t *testing.T) {
 		`,"message":"some message","isPalindrome":false`+
 		`}`, string(out))
 }
+
+func TestSplitAnalysisFields(t *testing.T) {
+	fields, analyzers, all := splitAnalysisFields(fieldsMap{
+		messages.FieldId:            {},
+		"analysis.wordCount":        {},
+		"analysis.anagramSignature": {},
+	})
+	require.Equal(t, fieldsMap{messages.FieldId: {}}, fields)
+	require.Equal(t, []string{"anagramSignature", "wordCount"}, analyzers)
+	require.False(t, all)
+
+	fields, analyzers, all = splitAnalysisFields(fieldsMap{"analysis": {}})
+	require.Equal(t, fieldsMap{}, fields)
+	require.Nil(t, analyzers)
+	require.True(t, all)
+}
+
+func TestQueryMessageValueToJson_includesTheAnalysis(t *testing.T) {
+	jsonValue := queryMessageToJsonValue(&messages.Message{
+		Id:       5,
+		Analysis: messages.Analysis{messages.AnalyzerWordCount: 2},
+	}, fieldsMap{messages.FieldId: struct{}{}})
+	out, err := json.Marshal(jsonValue)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":5,"analysis":{"wordCount":2}}`, string(out))
+}
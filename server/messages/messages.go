@@ -1,9 +1,14 @@
 package messages
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/mdev5000/messageappdemo/apperrors"
@@ -13,15 +18,32 @@ import (
 	"github.com/mdev5000/messageappdemo/server/uris"
 )
 
+// Config contains the settings for the messages handler.
+type Config struct {
+	// RequirePreconditions when true rejects updates and deletes that do not include an If-Match header with a 428
+	// response.
+	RequirePreconditions bool
+
+	// CursorSecret is the secret used to sign page cursors, see handler.NewCursorCodec.
+	CursorSecret []byte
+
+	// Palindrome determines the isPalindrome field of messages when a request does not include a palindromeMode.
+	Palindrome messages.PalindromeOptions
+}
+
 type Handler struct {
 	log         *logging.Logger
 	messagesSvc *messages.Service
+	cfg         Config
+	cursors     *handler.CursorCodec
 }
 
-func NewHandler(log *logging.Logger, messageSvc *messages.Service) *Handler {
+func NewHandler(log *logging.Logger, messageSvc *messages.Service, cfg Config) *Handler {
 	return &Handler{
 		log:         log,
 		messagesSvc: messageSvc,
+		cfg:         cfg,
+		cursors:     handler.NewCursorCodec(cfg.CursorSecret),
 	}
 }
 
@@ -33,9 +55,9 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := h.messagesSvc.Create(resp.toModifyMessage())
+	id, err := h.messagesSvc.Create(r.Context(), resp.toModifyMessage())
 	if err != nil {
-		handler.SendErrorResponse(h.log, op, w, err)
+		handler.SendErrorResponse(h.log, op, w, r, err)
 		return
 	}
 
@@ -52,15 +74,39 @@ func (h *Handler) Read(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message, err := h.messagesSvc.Read(id)
+	palindrome, ok := h.readPalindromeOptions(op, w, r)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.readMessageFields(op, w, r)
+	if !ok {
+		return
+	}
+
+	message, err := h.messagesSvc.Read(r.Context(), id)
 	if err != nil {
-		handler.SendErrorResponse(h.log, op, w, err)
+		handler.SendErrorResponse(h.log, op, w, r, err)
 		return
 	}
+	if !palindrome.IsStrict() {
+		message.IsPalindrome = palindrome.IsPalindrome(message.Message)
+	}
 
-	handler.SetETagInt(w, message.Version)
+	handler.SetETagIntVariant(w, message.Version, h.variant(palindrome, "fields", fieldNames(fields)))
 	handler.SetLastModified(w, message.UpdatedAt)
-	handler.EncodeJsonOrError(op, h.log, w, r, messageToJsonValue(message))
+	if handler.NotModified(w, r) {
+		return
+	}
+	if fields == nil {
+		handler.EncodeJsonOrError(op, h.log, w, r, messageToJsonValue(message))
+		return
+	}
+	if hasField(fields, messages.FieldLongestPalindrome) {
+		span := messages.LongestPalindrome(message.Message)
+		message.LongestPalindrome = &span
+	}
+	handler.EncodeJsonOrError(op, h.log, w, r, queryMessageToJsonValue(message, fields))
 }
 
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
@@ -71,18 +117,162 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, conditional, ok := h.readIfMatch(op, w, r, id)
+	if !ok {
+		return
+	}
+
 	var resp modifyMessageJSON
 	if !handler.DecodeJsonOrError(h.log, op, w, r, &resp) {
 		return
 	}
 
-	newVersion, err := h.messagesSvc.Update(id, resp.toModifyMessage())
+	newVersion, err := h.messagesSvc.Update(r.Context(), id, version, resp.toModifyMessage())
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, missingMessageError(op, err, conditional))
+		return
+	}
+
+	handler.SetETagInt(w, newVersion)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) document to the modifiable fields of a message
+// (see modifyMessageJSON). The patched message is saved via the same validation as Update, and only if the message was
+// not changed while the patch was being applied. Without If-Match the patch is then applied again to the changed
+// message.
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.Patch"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	version, conditional, ok := h.readIfMatch(op, w, r, id)
+	if !ok {
+		return
+	}
+
+	mediaType, ok := handler.PatchContentType(r)
+	if !ok {
+		w.Header().Set("Accept-Patch", handler.AcceptPatch)
+		re := apperrors.Error{Op: op, EType: apperrors.ETUnsupportedMediaType}
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeRequestContentTypeUnsupported,
+			fmt.Sprintf("unsupported patch media type, expected one of: %s", handler.AcceptPatch)).
+			WithArgs(map[string]interface{}{"expected": handler.AcceptPatch}))
+		handler.SendErrorResponse(h.log, op, w, r, &re)
+		return
+	}
+
+	patch, ok := handler.ReadBodyOrError(h.log, op, w, r)
+	if !ok {
+		return
+	}
+
+	// Without If-Match the client did not ask for a precondition, so a change made between reading and updating the
+	// message is not an error, the patch is applied again to the changed message.
+	for attempt := 1; ; attempt++ {
+		message, err := h.messagesSvc.Read(r.Context(), id)
+		if err != nil {
+			handler.SendErrorResponse(h.log, op, w, r, missingMessageError(op, err, conditional))
+			return
+		}
+		if version != messages.AnyVersion && version != message.Version {
+			handler.SendErrorResponse(h.log, op, w, r, &apperrors.Error{Op: op, EType: apperrors.ETPreconditionFailed})
+			return
+		}
+
+		modified, ok := h.applyPatch(op, w, r, mediaType, message, patch)
+		if !ok {
+			return
+		}
+
+		newVersion, err := h.messagesSvc.Update(r.Context(), id, message.Version, modified.toModifyMessage())
+		if err != nil {
+			if version == messages.AnyVersion && errors.Is(err, messages.VersionMismatchError{}) {
+				if attempt < maxPatchAttempts {
+					continue
+				}
+				err = concurrentChangeError(op, err)
+			}
+			handler.SendErrorResponse(h.log, op, w, r, missingMessageError(op, err, conditional))
+			return
+		}
+
+		handler.SetETagInt(w, newVersion)
+		return
+	}
+}
+
+// The number of times a patch without If-Match is applied before giving up on a message that keeps changing.
+const maxPatchAttempts = 3
+
+func concurrentChangeError(op string, err error) error {
+	re := apperrors.Error{Op: op, EType: apperrors.ETConflict, Err: err}
+	re.AddResponse(apperrors.ErrorResponse(apperrors.CodeDataConcurrentChange,
+		"the change conflicts with a concurrent change, retry the request"))
+	return &re
+}
+
+// Applies the patch to the modifiable representation of the message. Sends an error response and returns false when
+// the patch cannot be applied or the patched document is not a valid message.
+func (h *Handler) applyPatch(
+	op string, w http.ResponseWriter, r *http.Request, mediaType string, message *messages.Message, patch []byte,
+) (*modifyMessageJSON, bool) {
+	doc, err := json.Marshal(modifyMessageJSON{Message: message.Message})
 	if err != nil {
-		if errors.Is(err, messages.IdMissingError{}) {
-			w.WriteHeader(http.StatusNotFound)
+		handler.SendErrorResponse(h.log, op, w, r, &apperrors.Error{Op: op, EType: apperrors.ETInternal, Err: err})
+		return nil, false
+	}
+
+	patched, err := handler.ApplyPatch(op, mediaType, doc, patch)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return nil, false
+	}
+
+	var modified modifyMessageJSON
+	d := json.NewDecoder(bytes.NewReader(patched))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&modified); err != nil {
+		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid, Err: err}
+		appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodePatchResultInvalid, "patched message is invalid"))
+		handler.SendErrorResponse(h.log, op, w, r, &appErr)
+		return nil, false
+	}
+	return &modified, true
+}
+
+// Undo reverts a message to an earlier version. The number of versions to go back can be specified via the steps query
+// parameter (defaults to 1).
+func (h *Handler) Undo(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.Undo"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	version, conditional, ok := h.readIfMatch(op, w, r, id)
+	if !ok {
+		return
+	}
+
+	steps := 1
+	if stepsS := r.URL.Query().Get("steps"); stepsS != "" {
+		var err error
+		steps, err = strconv.Atoi(stepsS)
+		if err != nil {
+			appErr := handler.ResponseError(op)
+			appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeUndoStepsInvalid, "invalid steps value"))
+			handler.SendErrorResponse(h.log, op, w, r, &appErr)
 			return
 		}
-		handler.SendErrorResponse(h.log, op, w, err)
+	}
+
+	newVersion, err := h.messagesSvc.Undo(r.Context(), id, version, steps)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, missingMessageError(op, err, conditional))
 		return
 	}
 
@@ -97,43 +287,445 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// DELETE is an idempotent request and therefore should ways return 200 unless there's an error, see here for
-	// details: https://stackoverflow.com/questions/6474223/should-deleting-a-non-existent-resource-result-in-a-404-in-restful-rails
-	if err := h.messagesSvc.Delete(id); err != nil && !errors.Is(err, messages.IdMissingError{}) {
-		handler.SendErrorResponse(h.log, op, w, err)
+	version, conditional, ok := h.readIfMatch(op, w, r, id)
+	if !ok {
+		return
+	}
+
+	err := h.messagesSvc.Delete(r.Context(), id, version)
+	if errors.Is(err, messages.IdMissingError{}) {
+		// DELETE is an idempotent request and therefore should ways return 200 unless there's an error, see here for
+		// details: https://stackoverflow.com/questions/6474223/should-deleting-a-non-existent-resource-result-in-a-404-in-restful-rails
+		// However, a conditional request can never match a message that does not exist.
+		if !conditional {
+			return
+		}
+		err = &apperrors.Error{Op: op, EType: apperrors.ETPreconditionFailed, Err: err}
+	}
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
 		return
 	}
 }
 
+// List lists messages. Pages can be retrieved via an offset (pageStartIndex) or the cursors included in the response
+// and Link headers. The total number of messages is included when requested via includeTotal.
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	const op = "MessagesHandler.List"
 
-	fields, limit, offset, err := handler.GetQueryParams(op, r)
+	query, fields, ok := h.readMessageQuery(op, w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.messagesSvc.List(r.Context(), query)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+
+	out := make([]MessageResponseJSON, len(page.Messages))
+	for i, msg := range page.Messages {
+		out[i] = queryMessageToJsonValue(msg, fields)
+	}
+
+	resp := MessageListResponseJSON{Messages: out}
+	if !h.addPageCursors(op, w, r, query.Sort, page, &resp) {
+		return
+	}
+	addPageTotal(w, query, page, &resp)
+	handler.EncodeJsonWithETagOrError(op, h.log, w, r, resp)
+}
+
+// Analysis runs analyzers on a message. Every analyzer is run unless only some are requested via the analyzers query
+// parameter (ex. ?analyzers=wordCount,script).
+func (h *Handler) Analysis(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.Analysis"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	palindrome, ok := h.readPalindromeOptions(op, w, r)
+	if !ok {
+		return
+	}
+
+	var analyzers []string
+	if analyzersS := r.URL.Query().Get("analyzers"); analyzersS != "" {
+		for _, a := range strings.Split(analyzersS, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				analyzers = append(analyzers, a)
+			}
+		}
+	}
+
+	message, err := h.messagesSvc.Analyze(r.Context(), id, analyzers, messages.AnalysisOptions{Palindrome: palindrome})
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+
+	sort.Strings(analyzers)
+	handler.SetETagIntVariant(w, message.Version, h.variant(palindrome, "analyzers", analyzers))
+	handler.SetLastModified(w, message.UpdatedAt)
+	if handler.NotModified(w, r) {
+		return
+	}
+	handler.EncodeJsonOrError(op, h.log, w, r, MessageResponseJSON{
+		Id:       message.Id,
+		Version:  message.Version,
+		Analysis: message.Analysis,
+	})
+}
+
+func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.ListVersions"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	palindrome, ok := h.readPalindromeOptions(op, w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.messagesSvc.ListVersions(r.Context(), id)
 	if err != nil {
-		handler.SendErrorResponse(h.log, op, w, err)
+		handler.SendErrorResponse(h.log, op, w, r, err)
 		return
 	}
 
+	out := make([]MessageResponseJSON, len(versions))
+	for i, version := range versions {
+		if !palindrome.IsStrict() {
+			version.IsPalindrome = palindrome.IsPalindrome(version.Message)
+		}
+		out[i] = messageToJsonValue(version)
+	}
+
+	handler.EncodeJsonWithETagOrError(op, h.log, w, r, MessageListResponseJSON{Messages: out})
+}
+
+func (h *Handler) ReadVersion(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.ReadVersion"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.readVersionFromUri(op, w, r)
+	if !ok {
+		return
+	}
+
+	palindrome, ok := h.readPalindromeOptions(op, w, r)
+	if !ok {
+		return
+	}
+
+	message, err := h.messagesSvc.ReadVersion(r.Context(), id, version)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+	if !palindrome.IsStrict() {
+		message.IsPalindrome = palindrome.IsPalindrome(message.Message)
+	}
+
+	handler.SetETagIntVariant(w, message.Version, h.variant(palindrome, "", nil))
+	handler.SetLastModified(w, message.UpdatedAt)
+	if handler.NotModified(w, r) {
+		return
+	}
+	handler.EncodeJsonOrError(op, h.log, w, r, messageToJsonValue(message))
+}
+
+// ListDeleted lists the messages in the trash. It supports the same query parameters as List.
+func (h *Handler) ListDeleted(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.ListDeleted"
+
+	query, fields, ok := h.readMessageQuery(op, w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.messagesSvc.ListDeleted(r.Context(), query)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+
+	out := make([]MessageResponseJSON, len(page.Messages))
+	for i, msg := range page.Messages {
+		out[i] = deletedMessageToJsonValue(msg, fields)
+	}
+
+	resp := MessageListResponseJSON{Messages: out}
+	if !h.addPageCursors(op, w, r, query.Sort, page, &resp) {
+		return
+	}
+	addPageTotal(w, query, page, &resp)
+	handler.EncodeJsonWithETagOrError(op, h.log, w, r, resp)
+}
+
+// Search lists the messages matching the text given via q, from the most to the least relevant. Pages can only be
+// retrieved via an offset (pageStartIndex).
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.Search"
+
+	params, err := handler.GetQueryParams(op, r)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+	if len(params.Filters) > 0 || len(params.Sort) > 0 || params.After != "" || params.Before != "" ||
+		params.IncludeTotal {
+		re := handler.ResponseError(op)
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQuerySearchUnsupported,
+			"search only supports the q, fields, pageSize and pageStartIndex parameters"))
+		handler.SendErrorResponse(h.log, op, w, r, &re)
+		return
+	}
+
+	fields := params.Fields
 	if len(fields) == 0 {
 		fields = messages.AllFields
 	}
 
-	msgs, err := h.messagesSvc.List(messages.MessageQuery{
-		Fields: filterDynamicFields(fields),
-		Limit:  limit,
-		Offset: offset,
+	palindrome, ok := h.readPalindromeOptions(op, w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.messagesSvc.Search(r.Context(), messages.SearchQuery{
+		Text:       r.URL.Query().Get("q"),
+		Fields:     fields,
+		Limit:      params.Limit,
+		Offset:     params.Offset,
+		Palindrome: palindrome,
 	})
 	if err != nil {
-		handler.SendErrorResponse(h.log, op, w, err)
+		handler.SendErrorResponse(h.log, op, w, r, err)
 		return
 	}
 
-	out := make([]MessageResponseJSON, len(msgs))
-	for i, msg := range msgs {
-		out[i] = queryMessageToJsonValue(msg, fields)
+	out := make([]SearchResultJSON, len(results))
+	for i, result := range results {
+		out[i] = searchResultToJsonValue(result, fields)
+	}
+	handler.EncodeJsonWithETagOrError(op, h.log, w, r, SearchResponseJSON{Messages: out})
+}
+
+// Undelete restores a message from the trash.
+func (h *Handler) Undelete(w http.ResponseWriter, r *http.Request) {
+	const op = "MessagesHandler.Undelete"
+
+	id, ok := h.readIdFromUri(op, w, r)
+	if !ok {
+		return
 	}
 
-	handler.EncodeJsonOrError(op, h.log, w, r, MessageListResponseJSON{Messages: out})
+	version, err := h.messagesSvc.Undelete(r.Context(), id)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return
+	}
+
+	handler.SetETagInt(w, version)
+}
+
+// Reads the listing query parameters of the request. Fields are the message fields to include in the response, the
+// requested analyzers are set on the query (see analysisField). When the parameters are invalid an error response is
+// sent and ok is false.
+func (h *Handler) readMessageQuery(
+	op string, w http.ResponseWriter, r *http.Request,
+) (query messages.MessageQuery, fields fieldsMap, ok bool) {
+	params, err := handler.GetQueryParams(op, r)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return query, nil, false
+	}
+
+	fields = params.Fields
+	if len(fields) == 0 {
+		fields = messages.AllFields
+	}
+	fields, analyzers, allAnalyzers := splitAnalysisFields(fields)
+	if allAnalyzers {
+		analyzers = messages.AnalyzerNames()
+	}
+	queryFields := fields
+	if len(fields) == 0 {
+		// Only the analysis was requested, which is determined from the message text.
+		queryFields = fieldsMap{messages.FieldMessage: {}}
+	}
+
+	query = messages.MessageQuery{
+		Fields:       queryFields,
+		Analyzers:    analyzers,
+		Limit:        params.Limit,
+		Offset:       params.Offset,
+		IncludeTotal: params.IncludeTotal,
+	}
+	if query.Palindrome, ok = h.readPalindromeOptions(op, w, r); !ok {
+		return query, nil, false
+	}
+	if len(params.Filters) > 0 {
+		filter := make(messages.And, len(params.Filters))
+		for i, f := range params.Filters {
+			if filter[i], err = messages.ParseCondition(op, f.Field, f.Op, f.Value); err != nil {
+				handler.SendErrorResponse(h.log, op, w, r, err)
+				return query, nil, false
+			}
+		}
+		query.Filter = filter
+	}
+	for _, k := range params.Sort {
+		query.Sort = append(query.Sort, messages.SortKey{Field: k.Field, Desc: k.Desc})
+	}
+	if params.After != "" {
+		if query.After, ok = h.readCursor(op, w, r, "after", params.After, query.Sort); !ok {
+			return query, nil, false
+		}
+	}
+	if params.Before != "" {
+		if query.Before, ok = h.readCursor(op, w, r, "before", params.Before, query.Sort); !ok {
+			return query, nil, false
+		}
+	}
+	return query, fields, true
+}
+
+// Reads the fields of a single message requested via the fields query parameter, the same fields as listings except the
+// analysis (see the Analysis endpoint). Fields is nil when no fields are requested, meaning every stored field. When a
+// field does not exist an error response is sent and ok is false.
+func (h *Handler) readMessageFields(op string, w http.ResponseWriter, r *http.Request) (fields fieldsMap, ok bool) {
+	params, err := handler.GetQueryParams(op, r)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return nil, false
+	}
+	if len(params.Fields) == 0 {
+		return nil, true
+	}
+
+	var notFound []string
+	for f := range params.Fields {
+		if _, found := messages.AllFields[f]; !found && f != messages.FieldLongestPalindrome {
+			notFound = append(notFound, f)
+		}
+	}
+	if len(notFound) != 0 {
+		sort.Strings(notFound)
+		invalid := strings.Join(notFound, ", ")
+		re := handler.ResponseError(op)
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryFieldsInvalid, "invalid messages fields: "+invalid).
+			WithArgs(map[string]interface{}{"fields": invalid}))
+		handler.SendErrorResponse(h.log, op, w, r, &re)
+		return nil, false
+	}
+	return params.Fields, true
+}
+
+// Describes how the representation of a message differs from the default one, see handler.SetETagIntVariant. It
+// differs when the palindrome options are not the configured ones, or when values (ex. the requested fields) are given
+// for param. The values must be sorted.
+func (h *Handler) variant(palindrome messages.PalindromeOptions, param string, values []string) string {
+	var parts []string
+	if palindrome != h.cfg.Palindrome {
+		parts = append(parts, fmt.Sprintf("palindrome=%+v", palindrome))
+	}
+	if len(values) > 0 {
+		parts = append(parts, param+"="+strings.Join(values, ","))
+	}
+	return strings.Join(parts, "&")
+}
+
+// Reads the palindrome mode requested via the palindromeMode query parameter, the configured options are used when no
+// mode is requested. When the mode is invalid an error response is sent and ok is false.
+func (h *Handler) readPalindromeOptions(
+	op string, w http.ResponseWriter, r *http.Request,
+) (palindrome messages.PalindromeOptions, ok bool) {
+	mode := r.URL.Query().Get("palindromeMode")
+	if mode == "" {
+		return h.cfg.Palindrome, true
+	}
+	palindrome, err := messages.ParsePalindromeMode(op, mode)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return palindrome, false
+	}
+	return palindrome, true
+}
+
+// Decodes the cursor token given for param (either after or before). Cursors are only valid for the sort order of the
+// listing they were created for. When the token is invalid an error response is sent and ok is false.
+func (h *Handler) readCursor(
+	op string, w http.ResponseWriter, r *http.Request, param, token string, sort []messages.SortKey,
+) (cursor *messages.Cursor, ok bool) {
+	var c cursorJSON
+	if err := h.cursors.Decode(op, param, token, &c); err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return nil, false
+	}
+	if c.Sort != sortToString(sort) {
+		re := handler.ResponseError(op)
+		re.AddResponse(apperrors.ErrorResponse(apperrors.CodeQueryCursorSortMismatch,
+			fmt.Sprintf("%s cursor does not match the sort order", param)).
+			WithArgs(map[string]interface{}{"param": param}))
+		handler.SendErrorResponse(h.log, op, w, r, &re)
+		return nil, false
+	}
+	return c.toCursor(), true
+}
+
+// Adds the cursors of the pages surrounding page to the response, as well as the equivalent Link headers.
+func (h *Handler) addPageCursors(
+	op string,
+	w http.ResponseWriter,
+	r *http.Request,
+	sort []messages.SortKey,
+	page *messages.MessagePage,
+	resp *MessageListResponseJSON,
+) bool {
+	var err error
+	if page.Next != nil {
+		if resp.Next, err = h.cursors.Encode(cursorToJsonValue(page.Next, sort)); err != nil {
+			handler.SendErrorResponse(h.log, op, w, r, handler.InternalError(op, err))
+			return false
+		}
+		w.Header().Add("Link", handler.PageLink(r, "next", "after", resp.Next))
+	}
+	if page.Prev != nil {
+		if resp.Prev, err = h.cursors.Encode(cursorToJsonValue(page.Prev, sort)); err != nil {
+			handler.SendErrorResponse(h.log, op, w, r, handler.InternalError(op, err))
+			return false
+		}
+		w.Header().Add("Link", handler.PageLink(r, "prev", "before", resp.Prev))
+	}
+	return true
+}
+
+// Adds the total number of messages and the page metadata to the response (and the X-Total-Count header) when the total
+// was requested.
+func addPageTotal(
+	w http.ResponseWriter, query messages.MessageQuery, page *messages.MessagePage, resp *MessageListResponseJSON,
+) {
+	if !query.IncludeTotal {
+		return
+	}
+	total := page.Total
+	resp.TotalCount = &total
+	resp.PageSize = query.Limit
+	if query.Limit > 0 && query.After == nil && query.Before == nil {
+		resp.Page = query.Offset/query.Limit + 1
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
 }
 
 func (h *Handler) readIdFromUri(op string, w http.ResponseWriter, r *http.Request) (messages.MessageId, bool) {
@@ -142,9 +734,70 @@ func (h *Handler) readIdFromUri(op string, w http.ResponseWriter, r *http.Reques
 	id, err := strconv.Atoi(ids)
 	if err != nil {
 		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
-		appErr.AddResponse(apperrors.ErrorResponse("invalid message id"))
-		handler.SendErrorResponse(h.log, op, w, &appErr)
+		appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeMessageIdInvalid, "invalid message id"))
+		handler.SendErrorResponse(h.log, op, w, r, &appErr)
 		return 0, false
 	}
 	return messages.MessageId(id), true
 }
+
+// Reads the message version expected by the client from the If-Match header. When several entity tags are listed the
+// precondition holds for the one matching the current version of the message, if any. Conditional indicates whether
+// the header was present. When the header is invalid or cannot match, or missing while preconditions are required, an
+// error response is sent and ok is false.
+func (h *Handler) readIfMatch(
+	op string, w http.ResponseWriter, r *http.Request, id messages.MessageId,
+) (version messages.MessageVersion, conditional bool, ok bool) {
+	versions, conditional, err := handler.IfMatchInts(op, r)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, err)
+		return messages.AnyVersion, conditional, false
+	}
+	if !conditional && h.cfg.RequirePreconditions {
+		handler.SendErrorResponse(h.log, op, w, r, &apperrors.Error{Op: op, EType: apperrors.ETPreconditionRequired})
+		return messages.AnyVersion, false, false
+	}
+	switch len(versions) {
+	case 0:
+		return messages.AnyVersion, conditional, true
+	case 1:
+		return versions[0], true, true
+	}
+
+	message, err := h.messagesSvc.Read(r.Context(), id)
+	if err != nil {
+		handler.SendErrorResponse(h.log, op, w, r, missingMessageError(op, err, true))
+		return messages.AnyVersion, true, false
+	}
+	for _, v := range versions {
+		if v == message.Version {
+			return v, true, true
+		}
+	}
+	handler.SendErrorResponse(h.log, op, w, r, &apperrors.Error{Op: op, EType: apperrors.ETPreconditionFailed})
+	return messages.AnyVersion, true, false
+}
+
+// Converts the error of a message that does not exist into a response. A conditional request can never match a message
+// that does not exist, so it fails the precondition (the same as Delete), otherwise the message is not found.
+func missingMessageError(op string, err error, conditional bool) error {
+	if !errors.Is(err, messages.IdMissingError{}) {
+		return err
+	}
+	if conditional {
+		return &apperrors.Error{Op: op, EType: apperrors.ETPreconditionFailed, Err: err}
+	}
+	return &apperrors.Error{Op: op, EType: apperrors.ETNotFound, Err: err}
+}
+
+func (h *Handler) readVersionFromUri(op string, w http.ResponseWriter, r *http.Request) (messages.MessageVersion, bool) {
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		appErr := apperrors.Error{Op: op, EType: apperrors.ETInvalid}
+		appErr.AddResponse(apperrors.ErrorResponse(apperrors.CodeMessageVersionInvalid, "invalid message version"))
+		handler.SendErrorResponse(h.log, op, w, r, &appErr)
+		return 0, false
+	}
+	return version, true
+}
@@ -9,6 +9,7 @@ import (
 
 	gmux "github.com/gorilla/mux"
 	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/localize"
 	"github.com/mdev5000/messageappdemo/logging"
 	msgs "github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/server/handler"
@@ -24,6 +25,17 @@ type Services struct {
 
 type Config struct {
 	LogRequest bool
+
+	// RequirePreconditions when true requires updates and deletes to include an If-Match header.
+	RequirePreconditions bool
+
+	// CursorSecret is the secret used to sign the cursors of paged listings. When empty a random secret is generated,
+	// so cursors are only valid until the server is restarted.
+	CursorSecret []byte
+
+	// PalindromeMode is the default rule used to determine whether messages are palindromes (see
+	// messages.PalindromeModes), it can be overridden per request. Defaults to the strict mode when empty.
+	PalindromeMode string
 }
 
 const MaxBodySize = 2 * 1024 * 1024 // 2MB
@@ -41,16 +53,21 @@ func standardServiceMiddleware(h http.Handler) http.Handler {
 
 		addSecureHeaders(w)
 
+		// Error responses are sent in the language of the user, see handler.SendErrorResponse.
+		w.Header().Add("Vary", "Accept-Language")
+		lang := localize.Negotiate(strings.Join(r.Header.Values("Accept-Language"), ","))
+		r = r.WithContext(localize.WithLanguage(r.Context(), lang))
+
 		// Limit max body size
 		// This will return an 'http: request body too large' if body is too large, so need to check for this when
 		// processing the body later in the pipeline.
 		r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
 
-		// Ensure the content type is correctly set to json
+		// Ensure the content type is correctly set to json. Actions that take no body (see noBodyRoutes) may omit it.
 		switch r.Method {
 		case "POST", "PUT":
 			// text/html; charset=UTF-8
-			if r.Header.Get("Content-Type") != handler.ContentTypeJson {
+			if r.Header.Get("Content-Type") != handler.ContentTypeJson && !(r.ContentLength == 0 && takesNoBody(r)) {
 				w.WriteHeader(http.StatusNotAcceptable)
 				return
 			}
@@ -60,21 +77,70 @@ func standardServiceMiddleware(h http.Handler) http.Handler {
 	})
 }
 
+// Path templates of the routes for actions that are POST requests without a body, so do not need a Content-Type.
+var noBodyRoutes = map[string]bool{
+	"/messages/{id}/undo":     true,
+	"/messages/{id}/undelete": true,
+}
+
+// Indicates if the route matching the request takes no body, see noBodyRoutes.
+func takesNoBody(r *http.Request) bool {
+	route := gmux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	tpl, err := route.GetPathTemplate()
+	return err == nil && noBodyRoutes[tpl]
+}
+
 func Handler(svc Services, cfg Config) (http.Handler, error) {
 	mux := gmux.NewRouter()
 	mux.Use(standardServiceMiddleware)
 
-	messageHandler := msgh.NewHandler(svc.Log, svc.MessagesService)
+	var palindrome msgs.PalindromeOptions
+	if cfg.PalindromeMode != "" {
+		var found bool
+		if palindrome, found = msgs.PalindromeModes[cfg.PalindromeMode]; !found {
+			return nil, fmt.Errorf("invalid palindrome mode %s", cfg.PalindromeMode)
+		}
+	}
+
+	messageHandler := msgh.NewHandler(svc.Log, svc.MessagesService, msgh.Config{
+		RequirePreconditions: cfg.RequirePreconditions,
+		CursorSecret:         cfg.CursorSecret,
+		Palindrome:           palindrome,
+	})
 	messages := mux.PathPrefix("/messages").Subrouter()
 	messages.HandleFunc("", messageHandler.Create).Methods("POST")
 	messages.HandleFunc("", messageHandler.List).Methods("GET", "HEAD")
 	messages.HandleFunc("", acceptsHandler(svc.Log, "GET", "HEAD", "POST"))
 
+	// Must be registered before /{id} so they are not treated as message ids.
+	messages.HandleFunc("/trash", messageHandler.ListDeleted).Methods("GET", "HEAD")
+	messages.HandleFunc("/trash", acceptsHandler(svc.Log, "GET", "HEAD"))
+	messages.HandleFunc("/search", messageHandler.Search).Methods("GET", "HEAD")
+	messages.HandleFunc("/search", acceptsHandler(svc.Log, "GET", "HEAD"))
+
 	message := messages.HandleFunc("/{id}", messageHandler.Read).Subrouter()
 	message.HandleFunc("", messageHandler.Read).Methods("GET", "HEAD")
 	message.HandleFunc("", messageHandler.Update).Methods("PUT")
+	message.HandleFunc("", messageHandler.Patch).Methods("PATCH")
 	message.HandleFunc("", messageHandler.Delete).Methods("DELETE")
-	message.HandleFunc("", acceptsHandler(svc.Log, "DELETE", "GET", "HEAD", "PUT"))
+	message.HandleFunc("", acceptsHandler(svc.Log, "DELETE", "GET", "HEAD", "PATCH", "PUT"))
+
+	messages.HandleFunc("/{id}/undo", messageHandler.Undo).Methods("POST")
+	messages.HandleFunc("/{id}/undo", acceptsHandler(svc.Log, "POST"))
+
+	messages.HandleFunc("/{id}/undelete", messageHandler.Undelete).Methods("POST")
+	messages.HandleFunc("/{id}/undelete", acceptsHandler(svc.Log, "POST"))
+
+	messages.HandleFunc("/{id}/analysis", messageHandler.Analysis).Methods("GET", "HEAD")
+	messages.HandleFunc("/{id}/analysis", acceptsHandler(svc.Log, "GET", "HEAD"))
+
+	messages.HandleFunc("/{id}/versions", messageHandler.ListVersions).Methods("GET", "HEAD")
+	messages.HandleFunc("/{id}/versions", acceptsHandler(svc.Log, "GET", "HEAD"))
+	messages.HandleFunc("/{id}/versions/{version}", messageHandler.ReadVersion).Methods("GET", "HEAD")
+	messages.HandleFunc("/{id}/versions/{version}", acceptsHandler(svc.Log, "GET", "HEAD"))
 
 	n := negroni.New()
 	n.Use(negroni.NewRecovery())
@@ -97,7 +163,7 @@ func acceptsHandler(log *logging.Logger, methods ...string) func(http.ResponseWr
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
 		if _, err := fmt.Fprintf(w, "Allow: %s", strings.Join(methods, ", ")); err != nil {
-			handler.SendErrorResponse(log, op, w, &apperrors.Error{
+			handler.SendErrorResponse(log, op, w, r, &apperrors.Error{
 				EType: apperrors.ETInternal,
 				Op:    op,
 				Err:   err,
@@ -9,3 +9,27 @@ import (
 func Message(messageId messages.MessageId) string {
 	return fmt.Sprintf("/messages/%d", messageId)
 }
+
+func MessageUndo(messageId messages.MessageId) string {
+	return fmt.Sprintf("/messages/%d/undo", messageId)
+}
+
+func MessageUndelete(messageId messages.MessageId) string {
+	return fmt.Sprintf("/messages/%d/undelete", messageId)
+}
+
+func MessageAnalysis(messageId messages.MessageId) string {
+	return fmt.Sprintf("/messages/%d/analysis", messageId)
+}
+
+const MessagesTrash = "/messages/trash"
+
+const MessagesSearch = "/messages/search"
+
+func MessageVersions(messageId messages.MessageId) string {
+	return fmt.Sprintf("/messages/%d/versions", messageId)
+}
+
+func MessageVersion(messageId messages.MessageId, version messages.MessageVersion) string {
+	return fmt.Sprintf("/messages/%d/versions/%d", messageId, version)
+}
@@ -0,0 +1,47 @@
+// Package sqlite connects to SQLite databases. It uses a pure Go driver, so it does not require cgo.
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+type DB = sqlx.DB
+type Tx = sqlx.Tx
+
+// UrlScheme is the scheme of SQLite database urls (ex. sqlite:///var/lib/messages.db).
+const UrlScheme = "sqlite://"
+
+// IsUrl indicates if the database url refers to a SQLite database.
+func IsUrl(dbUrl string) bool {
+	return strings.HasPrefix(dbUrl, UrlScheme)
+}
+
+// OpenUrl opens the SQLite database referred to by a url in the format sqlite://<path>, ex. sqlite:///var/lib/db for
+// an absolute path, sqlite://messages.db for a path relative to the working directory or sqlite://:memory: for an
+// in-memory database.
+func OpenUrl(dbUrl string) (*DB, error) {
+	if !IsUrl(dbUrl) {
+		return nil, fmt.Errorf("sqlite database url must start with %s", UrlScheme)
+	}
+	path := strings.TrimPrefix(dbUrl, UrlScheme)
+	if path == "" {
+		return nil, fmt.Errorf("sqlite database url %s is missing the database path", dbUrl)
+	}
+	return Open(path)
+}
+
+// Open opens the SQLite database file at path, creating it when it does not exist.
+func Open(path string) (*DB, error) {
+	db, err := sqlx.Connect("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only supports a single writer and every connection to an in-memory database is a separate database, so
+	// all access goes through a single connection.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
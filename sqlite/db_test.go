@@ -0,0 +1,25 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenUrl(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	db, err := OpenUrl("sqlite://" + path)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Ping())
+	require.FileExists(t, path)
+}
+
+func TestOpenUrl_errors(t *testing.T) {
+	_, err := OpenUrl("postgres://localhost/db")
+	require.EqualError(t, err, "sqlite database url must start with sqlite://")
+
+	_, err = OpenUrl("sqlite://")
+	require.EqualError(t, err, "sqlite database url sqlite:// is missing the database path")
+}
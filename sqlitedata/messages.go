@@ -0,0 +1,37 @@
+// Package sqlitedata contains SQLite implementations of the domain repositories. They behave the same as those in the
+// data package and are intended for small deployments where running PostgreSQL is not justified.
+package sqlitedata
+
+import (
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mdev5000/messageappdemo/data"
+	"github.com/mdev5000/messageappdemo/sqlite"
+)
+
+// Dialect is the dialect of SQLite databases. SQLite has no full-text index equivalent to that of PostgreSQL, so
+// messages are searched by substring.
+var Dialect = data.Dialect{
+	Name:                "SqliteMessagesRepository",
+	Placeholder:         sq.Question,
+	Timestamp:           timestamp,
+	TimestampParam:      "?",
+	Strpos:              "instr",
+	OffsetRequiresLimit: true,
+	// Migrations are not locked. SQLite only allows a single writer, so when migrations are run concurrently the same
+	// migration fails to be recorded twice rather than being applied twice.
+}
+
+// NewMessageRepository creates the repository implementation for the messages.Repository interface.
+func NewMessageRepository(db *sqlite.DB) *data.MessagesRepository {
+	return data.NewDialectMessageRepository(db, Dialect)
+}
+
+// Layout timestamps are stored in. It has a fixed width so timestamps can be compared as text and is understood by
+// both the SQLite date functions and the driver, which returns the values as UTC times.
+const timestampLayout = "2006-01-02 15:04:05.000"
+
+func timestamp(t time.Time) interface{} {
+	return t.UTC().Format(timestampLayout)
+}
@@ -0,0 +1,68 @@
+package sqlitedata
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/mdev5000/messageappdemo/sqlite"
+	"github.com/mdev5000/messageappdemo/testutil/repotest"
+	"github.com/stretchr/testify/require"
+)
+
+// Opens a new database with the schema set up. SQLite databases are cheap to create, so each test gets its own.
+func openDb(t *testing.T) (*sqlite.DB, func()) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "messages.db"))
+	require.NoError(t, err)
+	require.NoError(t, SetupSchema(db))
+	return db, func() { _ = db.Close() }
+}
+
+func TestMessagesRepository_conformance(t *testing.T) {
+	repotest.TestMessagesRepository(t, func(t *testing.T) (messages.Repository, func()) {
+		db, closeDb := openDb(t)
+		return NewMessageRepository(db), closeDb
+	})
+}
+
+func TestMessagesRepository_errorsIncludeOperation(t *testing.T) {
+	db, closeDb := openDb(t)
+	defer closeDb()
+	mr := NewMessageRepository(db)
+
+	var m messages.Message
+	err := mr.GetById(context.Background(), 5, &m)
+	require.Equal(t, messages.IdMissingError{Op: "SqliteMessagesRepository.GetById", Id: 5}, errors.Unwrap(err))
+
+	id, err := mr.Create(context.Background(), messages.CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = mr.UpdateById(context.Background(), id, 2, messages.UpdateMessage{Message: "new message"})
+	require.Equal(t,
+		messages.VersionMismatchError{Op: "SqliteMessagesRepository.UpdateById", Id: id, Expected: 2, Actual: 1},
+		errors.Unwrap(err))
+}
+
+func TestMessagesRepository_idsAreNotReusedAfterPurge(t *testing.T) {
+	db, closeDb := openDb(t)
+	defer closeDb()
+	mr := NewMessageRepository(db)
+
+	id, err := mr.Create(context.Background(), messages.CreateMessage{Message: "first message"})
+	require.NoError(t, err)
+	require.NoError(t, mr.DeleteById(context.Background(), id, messages.AnyVersion))
+	_, err = mr.PurgeDeleted(context.Background(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	id2, err := mr.Create(context.Background(), messages.CreateMessage{Message: "second message"})
+	require.NoError(t, err)
+	require.Greater(t, id2, id)
+}
+
+func TestSetupSchema_isIdempotent(t *testing.T) {
+	db, closeDb := openDb(t)
+	defer closeDb()
+	require.NoError(t, SetupSchema(db))
+}
@@ -0,0 +1,121 @@
+package sqlitedata
+
+import (
+	"fmt"
+
+	"github.com/mdev5000/messageappdemo/data"
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/mdev5000/messageappdemo/sqlite"
+)
+
+// Migrations is the SQLite equivalent of data.Migrations. Timestamps are stored as UTC text (see timestamp). To change
+// the schema add a new migration to the end of the list, existing migrations should never be modified once released.
+//
+// The first migrations are written so they can also be applied to databases set up before migrations were tracked.
+var Migrations = []data.Migration{
+	{
+		Version: 1,
+		Name:    "create messages",
+		Up: `
+create table if not exists messages (
+	id integer primary key autoincrement,
+	version integer not null,
+	created_at TIMESTAMP not null,
+	updated_at TIMESTAMP not null,
+	message text not null,
+	deleted_at TIMESTAMP
+);`,
+		Down: `drop table messages;`,
+	},
+	{
+		Version: 2,
+		Name:    "create message versions",
+		Up: `
+create table if not exists message_versions (
+	message_id integer not null,
+	version integer not null,
+	created_at TIMESTAMP not null,
+	updated_at TIMESTAMP not null,
+	message text not null,
+	primary key (message_id, version)
+);`,
+		Down: `drop table message_versions;`,
+	},
+	{
+		Version: 3,
+		Name:    "add messages is palindrome",
+		// SQLite cannot add a column only when it does not exist, so the columns are added by the backfill.
+		Backfill: addIsPalindrome,
+		Down: `
+alter table messages drop column is_palindrome;
+alter table message_versions drop column is_palindrome;`,
+	},
+}
+
+// NewMigrator creates a data.Migrator for the migrations in the Migrations registry.
+func NewMigrator(db *sqlite.DB) *data.Migrator {
+	return data.NewDialectMigrator(db, Dialect, Migrations)
+}
+
+// SetupSchema migrates the database schema to the latest version (see Migrations). It is idempotent and is safe to run
+// multiple times.
+func SetupSchema(db *sqlite.DB) error {
+	return NewMigrator(db).Up()
+}
+
+// Adds the is_palindrome columns, unless the database was set up with them before migrations were tracked, and
+// determines which of the existing messages (and versions) are palindromes.
+func addIsPalindrome(tx *sqlite.Tx) error {
+	var exists bool
+	if err := tx.Get(&exists,
+		`select count(*) > 0 from pragma_table_info('messages') where name = 'is_palindrome'`); err != nil {
+		return fmt.Errorf("failed to check for the is_palindrome column: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+alter table messages add column is_palindrome boolean not null default false;
+alter table message_versions add column is_palindrome boolean not null default false;`); err != nil {
+		return fmt.Errorf("failed to add is_palindrome columns: %w", err)
+	}
+
+	var all []*messages.Message
+	if err := tx.Select(&all, `select id, message from messages`); err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+	for _, m := range all {
+		if messages.IsPalindrome(m) {
+			if _, err := tx.Exec(`update messages set is_palindrome = true where id = ?`, m.Id); err != nil {
+				return fmt.Errorf("failed to update message with id %d: %w", m.Id, err)
+			}
+		}
+	}
+
+	var versions []*messages.Message
+	if err := tx.Select(&versions, `select message_id as id, version, message from message_versions`); err != nil {
+		return fmt.Errorf("failed to read message versions: %w", err)
+	}
+	for _, m := range versions {
+		if messages.IsPalindrome(m) {
+			if _, err := tx.Exec(`
+update message_versions set is_palindrome = true where message_id = ? and version = ?`,
+				m.Id, m.Version); err != nil {
+				return fmt.Errorf("failed to update version %d of message with id %d: %w", m.Version, m.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeDb deletes all data from the database, this should be used only for testing.
+func PurgeDb(db *sqlite.DB) error {
+	if _, err := db.Exec("delete from messages"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("delete from message_versions"); err != nil {
+		return err
+	}
+	return nil
+}
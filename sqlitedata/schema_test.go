@@ -0,0 +1,97 @@
+package sqlitedata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mdev5000/messageappdemo/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupSchema_addsIsPalindromeToExistingDatabases(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "messages.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Schema prior to the is_palindrome columns.
+	_, err = db.Exec(`
+create table messages (
+	id integer primary key autoincrement,
+	version integer not null,
+	created_at TIMESTAMP not null,
+	updated_at TIMESTAMP not null,
+	message text not null,
+	deleted_at TIMESTAMP
+);
+
+create table message_versions (
+	message_id integer not null,
+	version integer not null,
+	created_at TIMESTAMP not null,
+	updated_at TIMESTAMP not null,
+	message text not null,
+	primary key (message_id, version)
+);
+
+insert into messages (id, version, created_at, updated_at, message) values
+(1, 2, '2021-05-01 00:00:00.000', '2021-05-01 00:00:00.000', 'abba'),
+(2, 1, '2021-05-01 00:00:00.000', '2021-05-01 00:00:00.000', 'abc');
+
+insert into message_versions (message_id, version, created_at, updated_at, message) values
+(1, 1, '2021-05-01 00:00:00.000', '2021-05-01 00:00:00.000', 'abc'),
+(1, 2, '2021-05-01 00:00:00.000', '2021-05-01 00:00:00.000', 'abba'),
+(2, 1, '2021-05-01 00:00:00.000', '2021-05-01 00:00:00.000', 'abc');`)
+	require.NoError(t, err)
+
+	require.NoError(t, SetupSchema(db))
+	// Running again does nothing.
+	require.NoError(t, SetupSchema(db))
+
+	var palindromes []int64
+	require.NoError(t, db.Select(&palindromes, `select id from messages where is_palindrome order by id`))
+	require.Equal(t, []int64{1}, palindromes)
+
+	var versions []int
+	require.NoError(t, db.Select(&versions,
+		`select version from message_versions where is_palindrome and message_id = 1 order by version`))
+	require.Equal(t, []int{2}, versions)
+}
+
+func TestMigrator_canMigrateUpAndDown(t *testing.T) {
+	db, closeDb := openDb(t)
+	defer closeDb()
+	m := NewMigrator(db)
+
+	version, err := m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest(), version)
+
+	require.NoError(t, m.Down())
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest()-1, version)
+
+	var exists bool
+	require.NoError(t, db.Get(&exists,
+		`select count(*) > 0 from pragma_table_info('messages') where name = 'is_palindrome'`))
+	require.False(t, exists, "down migration was not run")
+
+	require.NoError(t, m.To(1))
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, len(Migrations))
+	require.True(t, statuses[0].Applied)
+	require.NotNil(t, statuses[0].AppliedAt)
+	for _, s := range statuses[1:] {
+		require.False(t, s.Applied, "migration %d is not applied", s.Version)
+	}
+
+	require.NoError(t, db.Get(&exists,
+		`select count(*) > 0 from sqlite_master where type = 'table' and name = 'message_versions'`))
+	require.False(t, exists, "down migrations were run")
+
+	require.NoError(t, m.Up())
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Equal(t, m.Latest(), version)
+}
@@ -2,14 +2,20 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mdev5000/messageappdemo/approot"
+	"github.com/mdev5000/messageappdemo/logging"
+	"github.com/mdev5000/messageappdemo/memdata"
 	msgs "github.com/mdev5000/messageappdemo/messages"
 	"github.com/mdev5000/messageappdemo/server"
 	"github.com/mdev5000/messageappdemo/server/handler"
@@ -36,7 +42,7 @@ func TestMessages_canCreateAndGetAMessage(t *testing.T) {
 	require.True(t, regexp.MustCompile("^/messages/[0-9]+$").MatchString(loc))
 
 	id := messageIdFromLocation(t, loc)
-	msg, err := svc.MessagesService.Read(id)
+	msg, err := svc.MessagesService.Read(context.Background(), id)
 	require.NoError(t, err)
 
 	// Then retrieve it.
@@ -58,6 +64,108 @@ func TestMessages_canCreateAndGetAMessage(t *testing.T) {
 	require.Equal(t, `"1"`, rr2.Header().Get("ETag"))
 }
 
+func TestMessages_conditionalGetReturnsNotModified(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "my message"})
+	require.NoError(t, err)
+
+	for _, uri := range []string{uris.Message(id), "/messages"} {
+		t.Run("If-None-Match for "+uri, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			etag := rr.Header().Get("ETag")
+			require.NotEmpty(t, etag)
+
+			rr2 := httptest.NewRecorder()
+			req := requestEmpty(t, "GET", uri)
+			req.Header.Set("If-None-Match", etag)
+			h.ServeHTTP(rr2, req)
+			require.Equal(t, http.StatusNotModified, rr2.Code)
+			require.Equal(t, etag, rr2.Header().Get("ETag"))
+			require.Equal(t, "", rr2.Body.String())
+		})
+	}
+
+	t.Run("representations depending on the query have their own ETag", func(t *testing.T) {
+		variants := []string{
+			uris.Message(id) + "?fields=id,longestPalindrome",
+			uris.Message(id) + "?palindromeMode=loose",
+			uris.MessageAnalysis(id) + "?analyzers=wordCount",
+			uris.MessageVersion(id, 1) + "?palindromeMode=loose",
+		}
+		defaults := map[string]string{}
+		for _, uri := range []string{uris.Message(id), uris.MessageAnalysis(id), uris.MessageVersion(id, 1)} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			defaults[uri] = rr.Header().Get("ETag")
+		}
+		require.Equal(t, `"1"`, defaults[uris.Message(id)])
+
+		for _, uri := range variants {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			etag := rr.Header().Get("ETag")
+			require.Regexp(t, `^"1-[0-9a-f]+"$`, etag, uri)
+
+			// The default representation is not current for the variant, but the variant itself is.
+			rr = httptest.NewRecorder()
+			req := requestEmpty(t, "GET", uri)
+			req.Header.Set("If-None-Match", defaults[strings.Split(uri, "?")[0]])
+			h.ServeHTTP(rr, req)
+			requireJsonOk(t, rr)
+
+			rr = httptest.NewRecorder()
+			req = requestEmpty(t, "GET", uri)
+			req.Header.Set("If-None-Match", etag)
+			h.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusNotModified, rr.Code, uri)
+		}
+
+		// Explicitly requesting the default representation is the same as not.
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)+"?palindromeMode=strict"))
+		requireJsonOk(t, rr)
+		require.Equal(t, `"1"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("If-Modified-Since for message", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)))
+		requireJsonOk(t, rr)
+
+		rr2 := httptest.NewRecorder()
+		req := requestEmpty(t, "GET", uris.Message(id))
+		req.Header.Set("If-Modified-Since", rr.Header().Get("Last-Modified"))
+		h.ServeHTTP(rr2, req)
+		require.Equal(t, http.StatusNotModified, rr2.Code)
+	})
+
+	t.Run("list ETag changes when a message changes", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages"))
+		requireJsonOk(t, rr)
+		etag := rr.Header().Get("ETag")
+
+		_, err := svc.MessagesService.Update(context.Background(),
+			id, msgs.AnyVersion, msgs.ModifyMessage{Message: "new message"})
+		require.NoError(t, err)
+
+		rr2 := httptest.NewRecorder()
+		req := requestEmpty(t, "GET", "/messages")
+		req.Header.Set("If-None-Match", etag)
+		h.ServeHTTP(rr2, req)
+		requireJsonOk(t, rr2)
+		require.NotEqual(t, etag, rr2.Header().Get("ETag"))
+	})
+}
+
 func messageIdFromLocation(t *testing.T, uri string) msgs.MessageId {
 	var id msgs.MessageId
 	_, err := fmt.Fscanf(bytes.NewBufferString(uri), "/messages/%d", &id)
@@ -65,118 +173,1058 @@ func messageIdFromLocation(t *testing.T, uri string) msgs.MessageId {
 	return id
 }
 
-// DELETE - /messages/{id}
-// --------------------------------------------
+// DELETE - /messages/{id}
+// --------------------------------------------
+
+func TestMessage_canDeleteMessageAnd404WhenMessageDoesNotExist(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "my message"})
+	require.NoError(t, err)
+
+	t.Run("can delete a message and get a 404 upon trying to request again", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "DELETE", uris.Message(id)))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr2 := httptest.NewRecorder()
+		h.ServeHTTP(rr2, requestEmpty(t, "GET", uris.Message(id)))
+		require.Equal(t, http.StatusNotFound, rr2.Code)
+	})
+
+	t.Run("delete returns 200 for non-existent message", func(t *testing.T) {
+		// See https://stackoverflow.com/questions/6474223/should-deleting-a-non-existent-resource-result-in-a-404-in-restful-rails
+		// for why this is the case.
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "DELETE", uris.Message(5)))
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+// PUT - /messages/{id}
+// --------------------------------------------
+
+func TestMessage_canUpdateMessage(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	// Update the message.
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// Then retrieve it.
+	rr2 := httptest.NewRecorder()
+	h.ServeHTTP(rr2, requestEmpty(t, "GET", uris.Message(id)))
+	require.Equal(t, http.StatusOK, rr2.Code)
+	require.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	var m messages.MessageResponseJSON
+	require.NoError(t, json.Unmarshal(rr2.Body.Bytes(), &m))
+	require.Equal(t, "new message", m.Message)
+}
+
+func TestMessage_conditionalUpdateAndDelete(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	t.Run("update fails when the version does not match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`)
+		req.Header.Set("If-Match", `"2"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("update succeeds when the version matches", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`)
+		req.Header.Set("If-Match", `"1"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("update fails when none of the listed versions match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PUT", uris.Message(id), `{"message": "newer message"}`)
+		req.Header.Set("If-Match", `"1", "3"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("update succeeds when any of the listed versions matches", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PUT", uris.Message(id), `{"message": "newer message"}`)
+		req.Header.Set("If-Match", `"1", W/"3", "2"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"3"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("delete fails when the version does not match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestEmpty(t, "DELETE", uris.Message(id))
+		req.Header.Set("If-Match", `"1"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("delete succeeds when the version matches", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestEmpty(t, "DELETE", uris.Message(id))
+		req.Header.Set("If-Match", `"3"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("conditional delete fails when the message does not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestEmpty(t, "DELETE", uris.Message(id))
+		req.Header.Set("If-Match", "*")
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("conditional update fails when the message does not exist", func(t *testing.T) {
+		for _, ifMatch := range []string{`"3"`, `"3", "4"`, "*"} {
+			rr := httptest.NewRecorder()
+			req := requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`)
+			req.Header.Set("If-Match", ifMatch)
+			h.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusPreconditionFailed, rr.Code, ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestMessage_428WhenPreconditionsAreRequired(t *testing.T) {
+	t.Parallel()
+	h, err := server.Handler(server.Services{Log: logging.NoLog()}, server.Config{RequirePreconditions: true})
+	require.NoError(t, err)
+
+	cases := []struct {
+		method string
+		body   string
+	}{
+		{"PUT", `{"message":"my message"}`},
+		{"DELETE", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.method, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestString(t, c.method, uris.Message(1), c.body))
+			require.Equal(t, http.StatusPreconditionRequired, rr.Code)
+		})
+	}
+}
+
+// PATCH - /messages/{id}
+// --------------------------------------------
+
+func TestMessage_canPatchMessage(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    string
+		etag        string
+	}{
+		{"merge patch", handler.ContentTypeMergePatch, `{"message": "second message"}`, "second message", `"2"`},
+		{
+			"json patch",
+			handler.ContentTypeJsonPatch,
+			`[{"op": "test", "path": "/message", "value": "second message"},` +
+				`{"op": "replace", "path": "/message", "value": "third message"}]`,
+			"third message",
+			`"3"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := requestString(t, "PATCH", uris.Message(id), c.body)
+			req.Header.Set("Content-Type", c.contentType)
+			h.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, c.etag, rr.Header().Get("ETag"))
+
+			msg, err := svc.MessagesService.Read(context.Background(), id)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, msg.Message)
+		})
+	}
+}
+
+func TestMessage_patchErrors(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+
+	t.Run("runs validation on the patched message", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PATCH", uris.Message(id), `{"message": null}`)
+		req.Header.Set("Content-Type", handler.ContentTypeMergePatch)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"field":"message","error":"Message field cannot be blank.",`+
+			`"code":"message.blank"}]}`, rr.Body.String())
+	})
+
+	t.Run("error when patch adds unknown fields", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PATCH", uris.Message(id), `{"version": 5}`)
+		req.Header.Set("Content-Type", handler.ContentTypeMergePatch)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"patched message is invalid",`+
+			`"code":"patch.result.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("412 when the version does not match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PATCH", uris.Message(id), `{"message": "new message"}`)
+		req.Header.Set("Content-Type", handler.ContentTypeMergePatch)
+		req.Header.Set("If-Match", `"2"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("404 when the message does not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestString(t, "PATCH", uris.Message(id+1), `{"message": "new message"}`)
+		req.Header.Set("Content-Type", handler.ContentTypeMergePatch)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// A repository where other requests change a message right before the next races updates.
+type racingRepo struct {
+	msgs.Repository
+	races int
+}
+
+func (r *racingRepo) UpdateById(
+	ctx context.Context, id msgs.MessageId, version msgs.MessageVersion, m msgs.UpdateMessage,
+) (msgs.MessageVersion, error) {
+	if r.races > 0 {
+		r.races--
+		if _, err := r.Repository.UpdateById(ctx,
+			id, msgs.AnyVersion, msgs.UpdateMessage{Message: "concurrent"}); err != nil {
+			return 0, err
+		}
+	}
+	return r.Repository.UpdateById(ctx, id, version, m)
+}
+
+func TestMessage_patchConcurrentChanges(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name     string
+		ifMatch  string
+		races    int
+		code     int
+		etag     string
+		body     string
+		expected string
+	}{
+		{"retried without If-Match", "", 1, http.StatusOK, `"3"`, "", "patched"},
+		{"409 when the message keeps changing", "", 100, http.StatusConflict, "",
+			`{"errors":[{"error":"the change conflicts with a concurrent change, retry the request",` +
+				`"code":"data.concurrentChange"}]}`, "concurrent"},
+		{"412 with If-Match", `"1"`, 1, http.StatusPreconditionFailed, "", "", "concurrent"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			repo := &racingRepo{Repository: memdata.NewMessageRepository()}
+			svc := approot.SetupWithRepo(repo, logging.NoLog())
+			h, err := server.Handler(server.Services{Log: svc.Log, MessagesService: svc.MessagesService},
+				server.Config{LogRequest: false})
+			require.NoError(t, err)
+
+			id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+			require.NoError(t, err)
+			repo.races = c.races
+
+			rr := httptest.NewRecorder()
+			req := requestString(t, "PATCH", uris.Message(id), `{"message": "patched"}`)
+			req.Header.Set("Content-Type", handler.ContentTypeMergePatch)
+			if c.ifMatch != "" {
+				req.Header.Set("If-Match", c.ifMatch)
+			}
+			h.ServeHTTP(rr, req)
+			require.Equal(t, c.code, rr.Code)
+			require.Equal(t, c.etag, rr.Header().Get("ETag"))
+			if c.body != "" {
+				require.Equal(t, c.body, rr.Body.String())
+			}
+
+			msg, err := svc.MessagesService.Read(context.Background(), id)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, msg.Message)
+		})
+	}
+}
+
+func TestMessage_415WhenPatchMediaTypeIsNotSupported(t *testing.T) {
+	t.Parallel()
+	for _, contentType := range []string{"application/json; charset=UTF-8", "application/xml", ""} {
+		t.Run("content type: "+contentType, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := requestString(t, "PATCH", uris.Message(1), `{"message": "new message"}`)
+			req.Header.Set("Content-Type", contentType)
+			noDbServe(t, rr, req)
+			require.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			require.Equal(t, "application/merge-patch+json, application/json-patch+json",
+				rr.Header().Get("Accept-Patch"))
+			require.Equal(t, `{"errors":[{"error":"unsupported patch media type, expected one of: `+
+				`application/merge-patch+json, application/json-patch+json",`+
+				`"code":"request.contentType.unsupported"}]}`, rr.Body.String())
+		})
+	}
+}
+
+// GET - /messages/{id}/versions, GET - /messages/{id}/versions/{version}
+// --------------------------------------------
+
+func TestMessage_canViewMessageVersions(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Update(context.Background(),
+		id, msgs.AnyVersion, msgs.ModifyMessage{Message: "atttta"})
+	require.NoError(t, err)
+
+	t.Run("list versions", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageVersions(id)))
+		requireJsonOk(t, rr)
+		var data messages.MessageListResponseJSON
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &data))
+		require.Len(t, data.Messages, 2)
+		require.Equal(t, 1, data.Messages[0].Version)
+		require.Equal(t, "first message", data.Messages[0].Message)
+		require.False(t, *data.Messages[0].IsPalindrome)
+		require.Equal(t, 2, data.Messages[1].Version)
+		require.Equal(t, "atttta", data.Messages[1].Message)
+		require.True(t, *data.Messages[1].IsPalindrome)
+	})
+
+	t.Run("view version", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageVersion(id, 1)))
+		requireJsonOk(t, rr)
+		require.Equal(t, `"1"`, rr.Header().Get("ETag"))
+		var m messages.MessageResponseJSON
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &m))
+		require.Equal(t, id, m.Id)
+		require.Equal(t, 1, m.Version)
+		require.Equal(t, "first message", m.Message)
+		require.False(t, *m.IsPalindrome)
+	})
+
+	t.Run("404 when version does not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageVersion(id, 3)))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("404 when message does not exist", func(t *testing.T) {
+		for _, uri := range []string{uris.MessageVersions(id + 1), uris.MessageVersion(id+1, 1)} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			require.Equal(t, http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestMessage_errorOnBadVersion(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	noDbServe(t, rr, requestEmpty(t, "GET", "/messages/1/versions/duck"))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "{\"errors\":[{\"error\":\"invalid message version\","+
+		"\"code\":\"message.version.invalid\"}]}", rr.Body.String())
+}
+
+// POST - /messages/{id}/undo
+// --------------------------------------------
+
+func TestMessage_canUndoMessageChanges(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Update(context.Background(),
+		id, msgs.AnyVersion, msgs.ModifyMessage{Message: "second message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Update(context.Background(),
+		id, msgs.AnyVersion, msgs.ModifyMessage{Message: "third message"})
+	require.NoError(t, err)
+
+	t.Run("undo the last change", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndo(id)))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"4"`, rr.Header().Get("ETag"))
+
+		msg, err := svc.MessagesService.Read(context.Background(), id)
+		require.NoError(t, err)
+		require.Equal(t, "second message", msg.Message)
+	})
+
+	t.Run("undo multiple steps", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndo(id)+"?steps=3"))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"5"`, rr.Header().Get("ETag"))
+
+		msg, err := svc.MessagesService.Read(context.Background(), id)
+		require.NoError(t, err)
+		require.Equal(t, "first message", msg.Message)
+	})
+
+	t.Run("error when undoing more steps than versions", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndo(id)+"?steps=5"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"field":"steps",`+
+			`"error":"Cannot undo 5 steps, the message only has 4 previous versions.",`+
+			`"code":"undo.steps.tooMany"}]}`, rr.Body.String())
+	})
+
+	t.Run("412 when the version does not match", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := requestEmpty(t, "POST", uris.MessageUndo(id))
+		req.Header.Set("If-Match", `"4"`)
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("404 when the message does not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndo(id+1)))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestMessage_undoErrorOnBadSteps(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	noDbServe(t, rr, requestEmpty(t, "POST", uris.MessageUndo(1)+"?steps=many"))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, `{"errors":[{"error":"invalid steps value","code":"undo.steps.invalid"}]}`, rr.Body.String())
+}
+
+// GET - /messages/trash, POST - /messages/{id}/undelete
+// --------------------------------------------
+
+func TestMessage_canListAndRestoreDeletedMessages(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	_, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "kept message"})
+	require.NoError(t, err)
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "deleted message"})
+	require.NoError(t, err)
+	require.NoError(t, svc.MessagesService.Delete(context.Background(), id, msgs.AnyVersion))
+
+	t.Run("deleted messages are listed in the trash", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesTrash+"?fields=id,message"))
+		requireJsonOk(t, rr)
+		require.Regexp(t,
+			fmt.Sprintf(`^{"messages":\[{"id":%d,"message":"deleted message","deleted_at":"[^"]+"}\]}$`, id),
+			rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesTrash+"?fields=id&includeTotal=true"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"totalCount":1}`)
+		require.Equal(t, "1", rr.Header().Get("X-Total-Count"))
+	})
+
+	t.Run("can restore a deleted message", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndelete(id)))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+		rr2 := httptest.NewRecorder()
+		h.ServeHTTP(rr2, requestEmpty(t, "GET", uris.Message(id)))
+		require.Equal(t, http.StatusOK, rr2.Code)
+
+		rr3 := httptest.NewRecorder()
+		h.ServeHTTP(rr3, requestEmpty(t, "GET", uris.MessagesTrash))
+		requireJsonOk(t, rr3)
+		require.Equal(t, `{}`, rr3.Body.String())
+	})
+
+	t.Run("404 when the message is not in the trash", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "POST", uris.MessageUndelete(id)))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// GET - /messages
+// --------------------------------------------
+
+func TestMessage_canListMessages(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id1, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "second message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "atttta"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "last message"})
+	require.NoError(t, err)
+
+	t.Run("show all messages by default", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message"))
+		requireJsonOk(t, rr)
+		expected := fmt.Sprintf(`{"messages":[` +
+			`{"message":"first message"},` +
+			`{"message":"second message"},` +
+			`{"message":"atttta"},` +
+			`{"message":"last message"}` +
+			`]}`)
+		require.Equal(t, expected, rr.Body.String())
+	})
+
+	t.Run("with fields, pageSize, and pageStartIndex", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message,isPalindrome&pageSize=2&pageStartIndex=2"))
+		requireJsonOk(t, rr)
+		expected := `^{"messages":\[` +
+			`{"message":"atttta","isPalindrome":true},` +
+			`{"message":"last message","isPalindrome":false}` +
+			`\],"prev":"[^"]+"}$`
+		require.Regexp(t, expected, rr.Body.String())
+	})
+
+	t.Run("can page through messages with cursors", func(t *testing.T) {
+		var page messages.MessageListResponseJSON
+		getPage := func(uri string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			page = messages.MessageListResponseJSON{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+			return rr
+		}
+		pageMessages := func() []string {
+			var out []string
+			for _, m := range page.Messages {
+				out = append(out, m.Message)
+			}
+			return out
+		}
+
+		rr := getPage("/messages?fields=message&pageSize=3")
+		require.Equal(t, []string{"first message", "second message", "atttta"}, pageMessages())
+		require.Empty(t, page.Prev)
+		require.NotEmpty(t, page.Next)
+		require.Equal(t, []string{`</messages?after=` + page.Next + `&fields=message&pageSize=3>; rel="next"`},
+			rr.Header().Values("Link"))
+		require.NotContains(t, rr.Body.String(), `"id"`, "id is only included when requested")
+
+		rr = getPage("/messages?fields=message&pageSize=3&after=" + page.Next)
+		require.Equal(t, []string{"last message"}, pageMessages())
+		require.Empty(t, page.Next)
+		require.NotEmpty(t, page.Prev)
+		require.Equal(t, []string{`</messages?before=` + page.Prev + `&fields=message&pageSize=3>; rel="prev"`},
+			rr.Header().Values("Link"))
+
+		getPage("/messages?fields=message&pageSize=3&before=" + page.Prev)
+		require.Equal(t, []string{"first message", "second message", "atttta"}, pageMessages())
+		require.Empty(t, page.Prev)
+		require.NotEmpty(t, page.Next)
+	})
+
+	t.Run("can sort messages", func(t *testing.T) {
+		var page messages.MessageListResponseJSON
+		getPage := func(uri string) []string {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			page = messages.MessageListResponseJSON{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+			var out []string
+			for _, m := range page.Messages {
+				out = append(out, m.Message)
+			}
+			return out
+		}
+
+		require.Equal(t, []string{"second message", "last message", "first message", "atttta"},
+			getPage("/messages?fields=message&sort=-message"))
+
+		require.Equal(t, []string{"second message", "last message"},
+			getPage("/messages?fields=message&sort=-message&pageSize=2"))
+		require.Equal(t, []string{"first message", "atttta"},
+			getPage("/messages?fields=message&sort=-message&pageSize=2&after="+page.Next))
+		require.Equal(t, []string{"second message", "last message"},
+			getPage("/messages?fields=message&sort=-message&pageSize=2&before="+page.Prev))
+
+		// Cursors cannot be used with a different sort order.
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message&sort=message&pageSize=2&after="+page.Next))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"after cursor does not match the sort order",`+
+			`"code":"query.cursor.sortMismatch"}]}`, rr.Body.String())
+	})
+
+	t.Run("can filter messages", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		uri := fmt.Sprintf("/messages?fields=message&filter[message][contains]=message&filter[id][gt]=%d", id1)
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{"messages":[{"message":"second message"},{"message":"last message"}]}`, rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message,isPalindrome&filter[isPalindrome][eq]=true"))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{"messages":[{"message":"atttta","isPalindrome":true}]}`, rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message&sort=-isPalindrome,id&pageSize=2"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `{"messages":[{"message":"atttta"},{"message":"first message"}]`)
+
+		rr = httptest.NewRecorder()
+		uri = "/messages?fields=id&filter[createdAt][gt]=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{}`, rr.Body.String())
+	})
+
+	t.Run("can include the total number of messages", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message&pageSize=3&pageStartIndex=2&includeTotal=true"))
+		requireJsonOk(t, rr)
+		require.Regexp(t,
+			`^{"messages":\[{"message":"last message"}\],"prev":"[^"]+","totalCount":4,"pageSize":3,"page":2}$`,
+			rr.Body.String())
+		require.Equal(t, "4", rr.Header().Get("X-Total-Count"))
+
+		// The total only counts the messages matching the filter.
+		rr = httptest.NewRecorder()
+		uri := "/messages?fields=message&filter[message][contains]=message&includeTotal=true"
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"totalCount":3}`)
+		require.Equal(t, "3", rr.Header().Get("X-Total-Count"))
 
-func TestMessage_canDeleteMessageAnd404WhenMessageDoesNotExist(t *testing.T) {
+		// Pages beyond the last message still include the total.
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message&pageSize=3&pageStartIndex=5&includeTotal=true"))
+		requireJsonOk(t, rr)
+		require.Regexp(t, `^{("prev":"[^"]+",)?"totalCount":4,"pageSize":3,"page":5}$`, rr.Body.String())
+
+		// The total is not included by default.
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message&pageSize=1"))
+		requireJsonOk(t, rr)
+		require.NotContains(t, rr.Body.String(), "totalCount")
+		require.Empty(t, rr.Header().Get("X-Total-Count"))
+	})
+
+	t.Run("show all fields when no field filter specified in query", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?pageSize=1"))
+		requireJsonOk(t, rr)
+		var data messages.MessageListResponseJSON
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &data))
+		require.Len(t, data.Messages, 1)
+		require.Equal(t, id1, data.Messages[0].Id)
+		require.Equal(t, 1, data.Messages[0].Version)
+		require.NotNil(t, data.Messages[0].CreatedAt)
+		require.NotNil(t, data.Messages[0].UpdatedAt)
+		require.Equal(t, "first message", data.Messages[0].Message)
+	})
+}
+
+func TestMessage_canSearchMessages(t *testing.T) {
 	db, dbClose := acquireDb(t)
 	defer dbClose()
 
 	h, svc := handlerWithDb(t, db)
 
-	id, err := svc.MessagesService.Create(msgs.ModifyMessage{Message: "my message"})
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "The quick brown fox"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "slow turtle"})
 	require.NoError(t, err)
 
-	t.Run("can delete a message and get a 404 upon trying to request again", func(t *testing.T) {
+	t.Run("returns the matching messages with their rank and highlight", func(t *testing.T) {
 		rr := httptest.NewRecorder()
-		h.ServeHTTP(rr, requestEmpty(t, "DELETE", uris.Message(id)))
-		require.Equal(t, http.StatusOK, rr.Code)
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesSearch+"?q=QUICK&fields=id,message"))
+		requireJsonOk(t, rr)
+		var resp messages.SearchResponseJSON
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Len(t, resp.Messages, 1)
+		require.Equal(t, id, resp.Messages[0].Id)
+		require.Equal(t, "The quick brown fox", resp.Messages[0].Message)
+		require.Nil(t, resp.Messages[0].CreatedAt, "only requested fields are included")
+		require.Greater(t, resp.Messages[0].Rank, 0.0)
+		require.Equal(t, "The <b>quick</b> brown fox", resp.Messages[0].Highlight)
+	})
 
-		rr2 := httptest.NewRecorder()
-		h.ServeHTTP(rr2, requestEmpty(t, "GET", uris.Message(id)))
-		require.Equal(t, http.StatusNotFound, rr2.Code)
+	t.Run("no messages when nothing matches", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesSearch+"?q=elephant"))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{}`, rr.Body.String())
 	})
 
-	t.Run("delete returns 200 for non-existent message", func(t *testing.T) {
-		// See https://stackoverflow.com/questions/6474223/should-deleting-a-non-existent-resource-result-in-a-404-in-restful-rails
-		// for why this is the case.
+	t.Run("error when search text is blank", func(t *testing.T) {
 		rr := httptest.NewRecorder()
-		h.ServeHTTP(rr, requestEmpty(t, "DELETE", uris.Message(5)))
-		require.Equal(t, http.StatusOK, rr.Code)
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesSearch+"?q=+"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"search text cannot be blank",`+
+			`"code":"search.text.blank"}]}`, rr.Body.String())
 	})
-}
 
-// PUT - /messages/{id}
-// --------------------------------------------
+	t.Run("error when using unsupported parameters", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesSearch+"?q=quick&sort=id"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t,
+			`{"errors":[{"error":"search only supports the q, fields, pageSize and pageStartIndex parameters",`+
+				`"code":"query.search.unsupported"}]}`,
+			rr.Body.String())
+	})
+}
 
-func TestMessage_canUpdateMessage(t *testing.T) {
+func TestMessage_palindromeModes(t *testing.T) {
 	db, dbClose := acquireDb(t)
 	defer dbClose()
 
 	h, svc := handlerWithDb(t, db)
 
-	id, err := svc.MessagesService.Create(msgs.ModifyMessage{Message: "first message"})
+	id, err := svc.MessagesService.Create(context.Background(),
+		msgs.ModifyMessage{Message: "A man, a plan, a canal: Panama"})
 	require.NoError(t, err)
 
-	// Update the message.
-	rr := httptest.NewRecorder()
-	h.ServeHTTP(rr, requestString(t, "PUT", uris.Message(id), `{"message": "new message"}`))
-	require.Equal(t, http.StatusOK, rr.Code)
+	t.Run("strict by default", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":false`)
+	})
 
-	// Then retrieve it.
-	rr2 := httptest.NewRecorder()
-	h.ServeHTTP(rr2, requestEmpty(t, "GET", uris.Message(id)))
-	require.Equal(t, http.StatusOK, rr2.Code)
-	require.Equal(t, `"2"`, rr.Header().Get("ETag"))
-	var m messages.MessageResponseJSON
-	require.NoError(t, json.Unmarshal(rr2.Body.Bytes(), &m))
-	require.Equal(t, "new message", m.Message)
-}
+	t.Run("can read a message with the loose mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)+"?palindromeMode=loose"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":true`)
+	})
 
-// GET - /messages
-// --------------------------------------------
+	t.Run("can list messages with the loose mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=isPalindrome&palindromeMode=loose"))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{"messages":[{"isPalindrome":true}]}`, rr.Body.String())
+	})
 
-func TestMessage_canListMessages(t *testing.T) {
+	t.Run("can read a message with the graphemes mode", func(t *testing.T) {
+		flags, err := svc.MessagesService.Create(context.Background(),
+			msgs.ModifyMessage{Message: "\U0001F1E8\U0001F1E6\U0001F1E8\U0001F1E6"})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(flags)))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":false`)
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(flags)+"?palindromeMode=graphemes"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":true`)
+	})
+
+	t.Run("can read versions with the loose mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageVersion(id, 1)+"?palindromeMode=loose"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":true`)
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageVersions(id)+"?palindromeMode=loose"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":true`)
+	})
+
+	t.Run("can search messages with the loose mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessagesSearch+"?q=panama&fields=isPalindrome&palindromeMode=loose"))
+		requireJsonOk(t, rr)
+		require.Contains(t, rr.Body.String(), `"isPalindrome":true`)
+		require.NotContains(t, rr.Body.String(), `"message"`)
+	})
+
+	t.Run("the server default can be configured", func(t *testing.T) {
+		h, svc := handlerWithDbConfig(t, db, server.Config{PalindromeMode: msgs.PalindromeModeLoose})
+		id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "Never odd or even"})
+		require.NoError(t, err)
+		for _, uri := range []string{uris.Message(id), uris.MessageVersion(id, 1), uris.MessageVersions(id)} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, requestEmpty(t, "GET", uri))
+			requireJsonOk(t, rr)
+			require.Contains(t, rr.Body.String(), `"isPalindrome":true`, uri)
+		}
+	})
+
+	t.Run("error when the mode is invalid", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)+"?palindromeMode=sloppy"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t,
+			`{"errors":[{"error":"invalid palindrome mode sloppy, expected one of: graphemes, loose, strict",`+
+				`"code":"palindromeMode.invalid"}]}`,
+			rr.Body.String())
+	})
+
+	t.Run("error when filtering by isPalindrome with the loose mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?palindromeMode=loose&filter[isPalindrome][eq]=true"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t,
+			`{"errors":[{"error":"isPalindrome can only be filtered and sorted by with the strict palindrome mode",`+
+				`"code":"palindromeMode.strictRequired"}]}`,
+			rr.Body.String())
+	})
+}
+
+func TestMessage_analysis(t *testing.T) {
 	db, dbClose := acquireDb(t)
 	defer dbClose()
 
 	h, svc := handlerWithDb(t, db)
 
-	id1, err := svc.MessagesService.Create(msgs.ModifyMessage{Message: "first message"})
-	require.NoError(t, err)
-	_, err = svc.MessagesService.Create(msgs.ModifyMessage{Message: "second message"})
-	require.NoError(t, err)
-	_, err = svc.MessagesService.Create(msgs.ModifyMessage{Message: "atttta"})
-	require.NoError(t, err)
-	_, err = svc.MessagesService.Create(msgs.ModifyMessage{Message: "last message"})
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "Was it a rat I saw"})
 	require.NoError(t, err)
 
-	t.Run("show all messages by default", func(t *testing.T) {
+	t.Run("can analyze a message", func(t *testing.T) {
 		rr := httptest.NewRecorder()
-		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message"))
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageAnalysis(id)+"?palindromeMode=loose"))
 		requireJsonOk(t, rr)
-		expected := fmt.Sprintf(`{"messages":[` +
-			`{"message":"first message"},` +
-			`{"message":"second message"},` +
-			`{"message":"atttta"},` +
-			`{"message":"last message"}` +
-			`]}`)
-		require.Equal(t, expected, rr.Body.String())
+		require.Equal(t, fmt.Sprintf(`{"id":%d,"version":1,"analysis":{`+
+			`"anagramSignature":"aaaaiirssttww","characterCount":18,"graphemeCount":18,"isPalindrome":true,`+
+			`"longestPalindrome":{"text":" a ","start":6,"end":9},"script":"Latin","wordCount":6}}`, id), rr.Body.String())
 	})
 
-	t.Run("with fields, pageSize, and pageStartIndex", func(t *testing.T) {
+	t.Run("can run only some analyzers", func(t *testing.T) {
 		rr := httptest.NewRecorder()
-		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=message,isPalindrome&pageSize=2&pageStartIndex=2"))
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageAnalysis(id)+"?analyzers=wordCount,isPalindrome"))
 		requireJsonOk(t, rr)
-		expected := fmt.Sprintf(`{"messages":[` +
-			`{"message":"atttta","isPalindrome":true},` +
-			`{"message":"last message","isPalindrome":false}` +
-			`]}`)
-		require.Equal(t, expected, rr.Body.String())
+		require.Equal(t, fmt.Sprintf(`{"id":%d,"version":1,"analysis":{"isPalindrome":false,"wordCount":6}}`, id),
+			rr.Body.String())
 	})
 
-	t.Run("show all fields when no field filter specified in query", func(t *testing.T) {
+	t.Run("can list messages with their analysis", func(t *testing.T) {
 		rr := httptest.NewRecorder()
-		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?pageSize=1"))
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=id,analysis.wordCount,analysis.script"))
 		requireJsonOk(t, rr)
-		var data messages.MessageListResponseJSON
-		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &data))
-		require.Len(t, data.Messages, 1)
-		require.Equal(t, id1, data.Messages[0].Id)
-		require.Equal(t, 1, data.Messages[0].Version)
-		require.NotNil(t, data.Messages[0].CreatedAt)
-		require.NotNil(t, data.Messages[0].UpdatedAt)
-		require.Equal(t, "first message", data.Messages[0].Message)
+		require.Equal(t, fmt.Sprintf(`{"messages":[{"id":%d,"analysis":{"script":"Latin","wordCount":6}}]}`, id),
+			rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=analysis.graphemeCount"))
+		requireJsonOk(t, rr)
+		require.Equal(t, `{"messages":[{"analysis":{"graphemeCount":18}}]}`, rr.Body.String())
+	})
+
+	t.Run("can list messages with their longest palindrome", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=id,longestPalindrome"))
+		requireJsonOk(t, rr)
+		require.Equal(t, fmt.Sprintf(
+			`{"messages":[{"id":%d,"longestPalindrome":{"text":" a ","start":6,"end":9}}]}`, id),
+			rr.Body.String())
+	})
+
+	t.Run("can read a message with its longest palindrome", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)+"?fields=id,longestPalindrome"))
+		requireJsonOk(t, rr)
+		require.Equal(t, fmt.Sprintf(`{"id":%d,"longestPalindrome":{"text":" a ","start":6,"end":9}}`, id),
+			rr.Body.String())
+	})
+
+	t.Run("error when reading a message with fields that do not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.Message(id)+"?fields=id,length,analysis"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"invalid messages fields: analysis, length",`+
+			`"code":"query.fields.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("error when the analyzer does not exist", func(t *testing.T) {
+		expected := `{"errors":[{"error":"invalid analyzer length, expected one of: anagramSignature, ` +
+			`characterCount, graphemeCount, isPalindrome, longestPalindrome, script, wordCount",` +
+			`"code":"analyzer.invalid"}]}`
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageAnalysis(id)+"?analyzers=length"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, expected, rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", "/messages?fields=analysis.length"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, expected, rr.Body.String())
+	})
+
+	t.Run("not found when the message does not exist", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, requestEmpty(t, "GET", uris.MessageAnalysis(id+100)))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestMessage_problemDetails(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	problemRequest := func(t *testing.T, method, url string) *http.Request {
+		r := requestEmpty(t, method, url)
+		r.Header.Set("Accept", "application/problem+json")
+		return r
+	}
+
+	t.Run("sends problem details for invalid requests", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, problemRequest(t, "GET", "/messages?pageSize=badSize"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		require.Equal(t, `{"type":"urn:messageappdemo:problem:invalid","title":"Invalid request","status":400,`+
+			`"detail":"The request is invalid, see errors for the details.","instance":"/messages?pageSize=badSize",`+
+			`"errors":[{"error":"invalid pageSize value","code":"query.pageSize.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("sends problem details when not found", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, problemRequest(t, "GET", "/messages/9999"))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		require.Equal(t, `{"type":"urn:messageappdemo:problem:not-found","title":"Not found","status":404,`+
+			`"detail":"The requested resource does not exist.","instance":"/messages/9999"}`, rr.Body.String())
+	})
+
+	t.Run("keeps the original responses when problem details are not accepted", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, requestEmpty(t, "GET", "/messages/9999"))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, "", rr.Body.String())
+	})
+}
+
+func TestMessage_localizedErrors(t *testing.T) {
+	db, dbClose := acquireDb(t)
+	defer dbClose()
+
+	h, svc := handlerWithDb(t, db)
+
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "first message"})
+	require.NoError(t, err)
+	_, err = svc.MessagesService.Update(context.Background(),
+		id, msgs.AnyVersion, msgs.ModifyMessage{Message: "second message"})
+	require.NoError(t, err)
+
+	localizedRequest := func(r *http.Request, acceptLanguage string) *http.Request {
+		r.Header.Set("Accept-Language", acceptLanguage)
+		return r
+	}
+
+	t.Run("sends errors in french", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, localizedRequest(requestString(t, "POST", "/messages", `{"message": ""}`), "fr-CA, en;q=0.5"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "fr", rr.Header().Get("Content-Language"))
+		require.Equal(t, `{"errors":[{"field":"message","error":"Le champ message ne peut pas être vide.",`+
+			`"code":"message.blank"}]}`, rr.Body.String())
+	})
+
+	t.Run("sends errors in spanish", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, localizedRequest(requestEmpty(t, "GET", "/messages?fields=id,notAField"), "es"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "es", rr.Header().Get("Content-Language"))
+		require.Equal(t, `{"errors":[{"error":"campos de mensajes no válidos: notAField",`+
+			`"code":"query.fields.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("uses the plural forms of the language", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, localizedRequest(requestEmpty(t, "POST", uris.MessageUndo(id)+"?steps=3"), "fr"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"field":"steps",`+
+			`"error":"Impossible d'annuler 3 étapes, le message n'a que 1 version précédente.",`+
+			`"code":"undo.steps.tooMany"}]}`, rr.Body.String())
+	})
+
+	t.Run("sends localized problem details", func(t *testing.T) {
+		r := localizedRequest(requestEmpty(t, "GET", "/messages?pageSize=badSize"), "es")
+		r.Header.Set("Accept", "application/problem+json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(),
+			`"errors":[{"error":"valor de pageSize no válido","code":"query.pageSize.invalid"}]`)
+	})
+
+	t.Run("falls back to english", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, localizedRequest(requestEmpty(t, "GET", "/messages?pageSize=badSize"), "de"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "en", rr.Header().Get("Content-Language"))
+		require.Equal(t, `{"errors":[{"error":"invalid pageSize value","code":"query.pageSize.invalid"}]}`,
+			rr.Body.String())
 	})
 }
 
@@ -188,21 +1236,79 @@ func TestMessage_whenListingMessages_errors(t *testing.T) {
 		rr := httptest.NewRecorder()
 		serve(t, db, rr, requestEmpty(t, "GET", "/messages?fields=id,notAField,version"))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
-		require.Equal(t, "{\"errors\":[{\"error\":\"invalid messages fields: notAField\"}]}", rr.Body.String())
+		require.Equal(t, "{\"errors\":[{\"error\":\"invalid messages fields: notAField\","+
+			"\"code\":\"query.fields.invalid\"}]}", rr.Body.String())
 	})
 
 	t.Run("error when invalid page limit", func(t *testing.T) {
 		rr := httptest.NewRecorder()
 		serve(t, db, rr, requestEmpty(t, "GET", "/messages?pageSize=badSize"))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
-		require.Equal(t, "{\"errors\":[\"invalid pageSize value\"]}", rr.Body.String())
+		require.Equal(t, "{\"errors\":[{\"error\":\"invalid pageSize value\","+
+			"\"code\":\"query.pageSize.invalid\"}]}", rr.Body.String())
+	})
+
+	t.Run("error when cursor is invalid", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, requestEmpty(t, "GET", "/messages?after=notACursor"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"invalid after cursor",`+
+			`"code":"query.cursor.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("error when invalid sort field", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, requestEmpty(t, "GET", "/messages?sort=id,-notAField"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"invalid messages sort fields: notAField",`+
+			`"code":"query.sort.field.invalid"}]}`, rr.Body.String())
+	})
+
+	t.Run("error when sort field is duplicated", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, requestEmpty(t, "GET", "/messages?sort=-createdAt,createdAt"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"duplicate sort field: createdAt",`+
+			`"code":"query.sort.duplicate"}]}`, rr.Body.String())
+	})
+
+	t.Run("error when invalid filter", func(t *testing.T) {
+		cases := []struct {
+			query    string
+			expected string
+		}{
+			{"filter[notAField][eq]=1", `{"errors":[{"error":"invalid filter field: notAField",` +
+				`"code":"filter.field.invalid"}]}`},
+			{"filter[id][contains]=1", `{"errors":[{"error":"invalid filter operator for id: contains",` +
+				`"code":"filter.operator.invalid"}]}`},
+			{"filter[createdAt][gt]=yesterday",
+				`{"errors":[{"error":"invalid filter value for createdAt, expected an RFC 3339 time",` +
+					`"code":"filter.value.invalid"}]}`},
+			{"filter[id]=1", `{"errors":[{"error":"invalid filter parameter: filter[id]",` +
+				`"code":"query.filter.invalid"}]}`},
+		}
+		for _, c := range cases {
+			rr := httptest.NewRecorder()
+			serve(t, db, rr, requestEmpty(t, "GET", "/messages?"+c.query))
+			require.Equal(t, http.StatusBadRequest, rr.Code, c.query)
+			require.Equal(t, c.expected, rr.Body.String(), c.query)
+		}
+	})
+
+	t.Run("error when invalid includeTotal", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serve(t, db, rr, requestEmpty(t, "GET", "/messages?includeTotal=yes"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, `{"errors":[{"error":"invalid includeTotal value",`+
+			`"code":"query.includeTotal.invalid"}]}`, rr.Body.String())
 	})
 
 	t.Run("error when invalid page start index", func(t *testing.T) {
 		rr := httptest.NewRecorder()
 		serve(t, db, rr, requestEmpty(t, "GET", "/messages?pageStartIndex=badIndex"))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
-		require.Equal(t, "{\"errors\":[\"invalid pageStartIndex value\"]}", rr.Body.String())
+		require.Equal(t, "{\"errors\":[{\"error\":\"invalid pageStartIndex value\","+
+			"\"code\":\"query.pageStartIndex.invalid\"}]}", rr.Body.String())
 	})
 }
 
@@ -216,7 +1322,8 @@ func TestMessage_errorOnBadId(t *testing.T) {
 			noDbServe(t, rr, requestEmpty(t, "GET", "/messages/duck"))
 			require.Equal(t, http.StatusBadRequest, rr.Code)
 			requireJson(t, rr)
-			require.Equal(t, "{\"errors\":[{\"error\":\"invalid message id\"}]}", rr.Body.String())
+			require.Equal(t, "{\"errors\":[{\"error\":\"invalid message id\","+
+				"\"code\":\"message.id.invalid\"}]}", rr.Body.String())
 		})
 	}
 }
@@ -255,17 +1362,17 @@ func TestMessages_createOrUpdateReturnsErrorWhen(t *testing.T) {
 		{
 			"empty message",
 			`{"message": ""}`,
-			`{"errors":[{"field":"message","error":"Message field cannot be blank."}]}`,
+			`{"errors":[{"field":"message","error":"Message field cannot be blank.","code":"message.blank"}]}`,
 		},
 		{
 			"invalid json",
 			`{{`,
-			`{"errors":[{"error":"invalid json"}]}`,
+			`{"errors":[{"error":"invalid json","code":"request.json.invalid"}]}`,
 		},
 		{
 			"empty json",
 			``,
-			`{"errors":[{"error":"invalid json"}]}`,
+			`{"errors":[{"error":"invalid json","code":"request.json.invalid"}]}`,
 		},
 	}
 	methods := []struct {
@@ -301,8 +1408,28 @@ func TestMessages_OptionsMethodAndReturns405WhenMethodIsNotSupported(t *testing.
 			"GET, HEAD, OPTIONS, POST"},
 		{
 			"/messages/1",
-			allMethodsExcept("GET", "PUT", "DELETE", "OPTIONS", "HEAD"),
-			"DELETE, GET, HEAD, OPTIONS, PUT"},
+			allMethodsExcept("GET", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"),
+			"DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+		{
+			"/messages/trash",
+			allMethodsExcept("GET", "OPTIONS", "HEAD"),
+			"GET, HEAD, OPTIONS"},
+		{
+			"/messages/1/undelete",
+			allMethodsExcept("POST", "OPTIONS"),
+			"OPTIONS, POST"},
+		{
+			"/messages/1/undo",
+			allMethodsExcept("POST", "OPTIONS"),
+			"OPTIONS, POST"},
+		{
+			"/messages/1/versions",
+			allMethodsExcept("GET", "OPTIONS", "HEAD"),
+			"GET, HEAD, OPTIONS"},
+		{
+			"/messages/1/versions/1",
+			allMethodsExcept("GET", "OPTIONS", "HEAD"),
+			"GET, HEAD, OPTIONS"},
 	}
 
 	h := noDbHandler(t)
@@ -333,7 +1460,7 @@ func TestMessages_headRequests(t *testing.T) {
 
 	h, svc := handlerWithDb(t, db)
 
-	id, err := svc.MessagesService.Create(msgs.ModifyMessage{Message: "message"})
+	id, err := svc.MessagesService.Create(context.Background(), msgs.ModifyMessage{Message: "message"})
 	require.NoError(t, err)
 
 	cases := []string{
@@ -377,6 +1504,44 @@ func TestMessages_406NotAcceptableWhenInvalidContentType(t *testing.T) {
 	}
 }
 
+func TestMessages_contentTypeIsOnlyOptionalForActionsWithoutBody(t *testing.T) {
+	t.Parallel()
+	h := noDbHandler(t)
+
+	cases := []struct {
+		method string
+		uri    string
+		body   string
+	}{
+		{"POST", "/messages", ""},
+		{"PUT", uris.Message(5), ""},
+		{"POST", uris.MessageUndo(5), `{"steps":1}`},
+	}
+	for _, c := range cases {
+		t.Run(c.method+" "+c.uri+" body: "+c.body, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := requestString(t, c.method, c.uri, c.body)
+			req.Header.Del("Content-Type")
+			h.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusNotAcceptable, rr.Code)
+		})
+	}
+
+	svc := approot.SetupWithRepo(memdata.NewMessageRepository(), logging.NoLog())
+	memH, err := server.Handler(server.Services{Log: svc.Log, MessagesService: svc.MessagesService},
+		server.Config{LogRequest: false})
+	require.NoError(t, err)
+	for _, uri := range []string{uris.MessageUndo(5), uris.MessageUndelete(5)} {
+		t.Run("POST "+uri+" without body", func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := requestEmpty(t, "POST", uri)
+			req.Header.Del("Content-Type")
+			memH.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusNotFound, rr.Code)
+		})
+	}
+}
+
 // * - /messages/{id} (security)
 // --------------------------------------------
 
@@ -402,7 +1567,7 @@ func TestMessages_errorWhenRequestBodyIsTooBig(t *testing.T) {
 	body[len(body)-1] = '}'
 	noDbServe(t, rr, request(t, "POST", "/messages", bytes.NewBuffer(body)))
 	require.Equal(t, http.StatusBadRequest, rr.Code)
-	require.Equal(t, `{"errors":[{"error":"request body too large"}]}`, rr.Body.String())
+	require.Equal(t, `{"errors":[{"error":"request body too large","code":"request.body.tooLarge"}]}`, rr.Body.String())
 }
 
 // helpers
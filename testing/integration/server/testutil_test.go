@@ -55,13 +55,17 @@ func noDbServe(t *testing.T, w http.ResponseWriter, r *http.Request) {
 }
 
 func handlerWithDb(t *testing.T, db *postgres.DB) (http.Handler, *approot.Services) {
+	return handlerWithDbConfig(t, db, server.Config{LogRequest: false})
+}
+
+func handlerWithDbConfig(t *testing.T, db *postgres.DB, cfg server.Config) (http.Handler, *approot.Services) {
 	log := logging.NoLog()
 	svcs := approot.Setup(db, log)
 	svch := server.Services{
 		Log:             svcs.Log,
 		MessagesService: svcs.MessagesService,
 	}
-	h, err := server.Handler(svch, server.Config{LogRequest: false})
+	h, err := server.Handler(svch, cfg)
 	require.NoError(t, err)
 	return h, svcs
 }
@@ -107,3 +107,19 @@ func (d *DbPool) AcquireDb() (*postgres.DB, func()) {
 		}
 	}
 }
+
+// AcquireDbInTimeZone is the same as AcquireDb, but the database sessions use the given time zone (ex. Asia/Tokyo)
+// rather than the default of UTC. The database has its own connections, which are closed when you are finished with
+// it.
+func (d *DbPool) AcquireDbInTimeZone(timeZone string) (*postgres.DB, func()) {
+	_, closeDb := d.AcquireDb()
+	db, err := postgres.OpenTestInTimeZone(testDbName, testDbUser, testDbPassword, d.resource.GetPort("5432/tcp"),
+		timeZone)
+	if err != nil {
+		panic(err)
+	}
+	return db, func() {
+		_ = db.Close()
+		closeDb()
+	}
+}
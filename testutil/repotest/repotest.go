@@ -0,0 +1,776 @@
+// Package repotest contains a conformance test suite for implementations of the messages.Repository interface. Every
+// repository implementation should run the suite from its own tests, ex.:
+//
+//	func TestMessagesRepository_conformance(t *testing.T) {
+//		repotest.TestMessagesRepository(t, func(t *testing.T) (messages.Repository, func()) {
+//			return NewMessageRepository(), func() {}
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mdev5000/messageappdemo/apperrors"
+	"github.com/mdev5000/messageappdemo/messages"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	Message       = messages.Message
+	CreateMessage = messages.CreateMessage
+	UpdateMessage = messages.UpdateMessage
+	MessageQuery  = messages.MessageQuery
+)
+
+// RepoFactory creates an empty repository for a single test. The returned function is called once the test has
+// finished and should release any resources held by the repository.
+type RepoFactory func(t *testing.T) (messages.Repository, func())
+
+// TestMessagesRepository verifies a messages.Repository implementation satisfies the contract of the interface. Each
+// test is run as a subtest against a new repository created by newRepo.
+//
+// Tests do not assume message ids start at any specific value, so repositories may be reused between tests as long as
+// they are emptied.
+func TestMessagesRepository(t *testing.T, newRepo RepoFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo messages.Repository)
+	}{
+		{"Create", testCreate},
+		{"Create_idsAreUnique", testCreateIdsAreUnique},
+		{"GetById_errorWhenMissing", testGetByIdErrorWhenMissing},
+		{"UpdateById", testUpdateById},
+		{"UpdateById_errorWhenMissing", testUpdateByIdErrorWhenMissing},
+		{"UpdateById_onlyUpdatesWhenVersionMatches", testUpdateByIdOnlyUpdatesWhenVersionMatches},
+		{"DeleteById", testDeleteById},
+		{"DeleteById_errorWhenMissing", testDeleteByIdErrorWhenMissing},
+		{"DeleteById_onlyDeletesWhenVersionMatches", testDeleteByIdOnlyDeletesWhenVersionMatches},
+		{"GetAllQuery", testGetAllQuery},
+		{"GetAllQuery_cursors", testGetAllQueryCursors},
+		{"GetAllQuery_sort", testGetAllQuerySort},
+		{"GetAllQuery_sortCursors", testGetAllQuerySortCursors},
+		{"GetAllQuery_errorOnInvalidSortFields", testGetAllQueryErrorOnInvalidSortFields},
+		{"GetAllQuery_filter", testGetAllQueryFilter},
+		{"GetAllQueryTotal", testGetAllQueryTotal},
+		{"GetDeletedQueryTotal", testGetDeletedQueryTotal},
+		{"IsPalindrome", testIsPalindrome},
+		{"Search", testSearch},
+		{"GetAllQuery_fieldFiltering", testGetAllQueryFieldFiltering},
+		{"GetAllQuery_errorOnInvalidFields", testGetAllQueryErrorOnInvalidFields},
+		{"GetVersions", testGetVersions},
+		{"GetVersion", testGetVersion},
+		{"Trash", testTrash},
+		{"PurgeDeleted", testPurgeDeleted},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			repo, closeRepo := newRepo(t)
+			defer closeRepo()
+			tt.test(t, repo)
+		})
+	}
+}
+
+// Context of the repository operations, the tests never cancel it.
+var ctx = context.Background()
+
+// Time zone ahead of UTC, times in it must be compared by the instant they refer to rather than their local time.
+var aheadOfUtc = time.FixedZone("UTC+10", 10*60*60)
+
+// Current time in a form every repository can store without loss of precision.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func create(t *testing.T, repo messages.Repository, message string) messages.MessageId {
+	id, err := repo.Create(ctx, CreateMessage{Message: message, CreatedAt: now()})
+	require.NoError(t, err)
+	return id
+}
+
+func requireIdMissing(t *testing.T, err error, id messages.MessageId) {
+	var idErr messages.IdMissingError
+	require.True(t, errors.As(err, &idErr), "expected IdMissingError, got: %v", err)
+	require.Equal(t, id, idErr.Id)
+}
+
+func requireVersionMismatch(t *testing.T, err error, id messages.MessageId, expected, actual messages.MessageVersion) {
+	var vErr messages.VersionMismatchError
+	require.True(t, errors.As(err, &vErr), "expected VersionMismatchError, got: %v", err)
+	require.Equal(t, id, vErr.Id)
+	require.Equal(t, expected, vErr.Expected)
+	require.Equal(t, actual, vErr.Actual)
+}
+
+func testCreate(t *testing.T, repo messages.Repository) {
+	createdAt := now()
+	id, err := repo.Create(ctx, CreateMessage{Message: "my message", CreatedAt: createdAt})
+	require.NoError(t, err)
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, id, &m))
+	require.Equal(t, id, m.Id)
+	require.Equal(t, 1, m.Version)
+	require.Equal(t, "my message", m.Message)
+	require.True(t, createdAt.Equal(m.CreatedAt), "created at is %s, expected %s", m.CreatedAt, createdAt)
+	require.True(t, createdAt.Equal(m.UpdatedAt), "updated at is %s, expected %s", m.UpdatedAt, createdAt)
+	require.Nil(t, m.DeletedAt)
+}
+
+func testCreateIdsAreUnique(t *testing.T, repo messages.Repository) {
+	id1 := create(t, repo, "first")
+	id2 := create(t, repo, "second")
+	require.NotEqual(t, id1, id2)
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, id2, &m))
+	require.Equal(t, "second", m.Message)
+}
+
+func testGetByIdErrorWhenMissing(t *testing.T, repo messages.Repository) {
+	id := create(t, repo, "my message")
+
+	var m Message
+	requireIdMissing(t, repo.GetById(ctx, id+1, &m), id+1)
+}
+
+func testUpdateById(t *testing.T, repo messages.Repository) {
+	id := create(t, repo, "first message")
+
+	var original Message
+	require.NoError(t, repo.GetById(ctx, id, &original))
+
+	time.Sleep(2 * time.Millisecond)
+	v, err := repo.UpdateById(ctx, id, messages.AnyVersion, UpdateMessage{Message: "new message"})
+	require.NoError(t, err)
+	require.Equal(t, original.Version+1, v)
+
+	var updated Message
+	require.NoError(t, repo.GetById(ctx, id, &updated))
+	require.Equal(t, v, updated.Version)
+	require.Equal(t, "new message", updated.Message)
+	require.True(t, original.CreatedAt.Equal(updated.CreatedAt), "created at is unchanged")
+	require.True(t, original.UpdatedAt.Before(updated.UpdatedAt), "updated at has been updated")
+}
+
+func testUpdateByIdErrorWhenMissing(t *testing.T, repo messages.Repository) {
+	_, err := repo.UpdateById(ctx, 5, messages.AnyVersion, UpdateMessage{Message: "new message"})
+	requireIdMissing(t, err, 5)
+
+	_, err = repo.UpdateById(ctx, 5, 1, UpdateMessage{Message: "new message"})
+	requireIdMissing(t, err, 5)
+}
+
+func testUpdateByIdOnlyUpdatesWhenVersionMatches(t *testing.T, repo messages.Repository) {
+	id := create(t, repo, "first message")
+
+	_, err := repo.UpdateById(ctx, id, 2, UpdateMessage{Message: "new message"})
+	requireVersionMismatch(t, err, id, 2, 1)
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, id, &m))
+	require.Equal(t, "first message", m.Message, "message is unchanged on a version mismatch")
+
+	v, err := repo.UpdateById(ctx, id, 1, UpdateMessage{Message: "new message"})
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+}
+
+func testDeleteById(t *testing.T, repo messages.Repository) {
+	id1 := create(t, repo, "message 1")
+	id2 := create(t, repo, "message 2")
+
+	require.NoError(t, repo.DeleteById(ctx, id1, messages.AnyVersion))
+
+	var m Message
+	requireIdMissing(t, repo.GetById(ctx, id1, &m), id1)
+	require.NoError(t, repo.GetById(ctx, id2, &m), "only the specified message is deleted")
+}
+
+func testDeleteByIdErrorWhenMissing(t *testing.T, repo messages.Repository) {
+	requireIdMissing(t, repo.DeleteById(ctx, 5, messages.AnyVersion), 5)
+
+	id := create(t, repo, "my message")
+	require.NoError(t, repo.DeleteById(ctx, id, messages.AnyVersion))
+	requireIdMissing(t, repo.DeleteById(ctx, id, messages.AnyVersion), id)
+}
+
+func testDeleteByIdOnlyDeletesWhenVersionMatches(t *testing.T, repo messages.Repository) {
+	id := create(t, repo, "my message")
+
+	requireVersionMismatch(t, repo.DeleteById(ctx, id, 2), id, 2, 1)
+	require.NoError(t, repo.DeleteById(ctx, id, 1))
+}
+
+func testGetAllQuery(t *testing.T, repo messages.Repository) {
+	id1 := create(t, repo, "first")
+	id2 := create(t, repo, "second")
+	id3 := create(t, repo, "third")
+	id := map[string]struct{}{messages.FieldId: {}}
+
+	t.Run("can retrieve all records", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id}, &all))
+		require.Equal(t, []*Message{{Id: id1}, {Id: id2}, {Id: id3}}, all)
+	})
+
+	t.Run("can limit and offset values", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id, Limit: 2, Offset: 1}, &all))
+		require.Equal(t, []*Message{{Id: id2}, {Id: id3}}, all)
+	})
+
+	t.Run("bad offset returns empty", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id, Offset: 500}, &all))
+		require.Len(t, all, 0)
+	})
+
+	t.Run("deleted messages are excluded", func(t *testing.T) {
+		require.NoError(t, repo.DeleteById(ctx, id2, messages.AnyVersion))
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id}, &all))
+		require.Equal(t, []*Message{{Id: id1}, {Id: id3}}, all)
+	})
+}
+
+func testGetAllQueryCursors(t *testing.T, repo messages.Repository) {
+	ids := make([]messages.MessageId, 5)
+	for i := range ids {
+		ids[i] = create(t, repo, "message")
+	}
+	// Newer messages are listed in id order regardless of when they were updated.
+	_, err := repo.UpdateById(ctx, ids[0], messages.AnyVersion, UpdateMessage{Message: "updated"})
+	require.NoError(t, err)
+	id := map[string]struct{}{messages.FieldId: {}}
+
+	t.Run("after", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: id, After: &messages.Cursor{Id: ids[1]}, Limit: 2}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[2]}, {Id: ids[3]}}, all)
+	})
+
+	t.Run("after the last message", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id, After: &messages.Cursor{Id: ids[4]}}, &all))
+		require.Len(t, all, 0)
+	})
+
+	t.Run("before returns the closest messages in ascending order", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: id, Before: &messages.Cursor{Id: ids[4]}, Limit: 2}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[2]}, {Id: ids[3]}}, all)
+	})
+
+	t.Run("before without a limit", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: id, Before: &messages.Cursor{Id: ids[2]}}, &all))
+		require.Equal(t, []*Message{{Id: ids[0]}, {Id: ids[1]}}, all)
+	})
+
+	t.Run("cursor of a deleted message", func(t *testing.T) {
+		require.NoError(t, repo.DeleteById(ctx, ids[2], messages.AnyVersion))
+		var all []*Message
+		q := MessageQuery{Fields: id, After: &messages.Cursor{Id: ids[2]}, Limit: 1}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[3]}}, all)
+	})
+}
+
+// Creates messages with the given creation times, returning their ids.
+func createAt(t *testing.T, repo messages.Repository, createdAt ...time.Time) []messages.MessageId {
+	ids := make([]messages.MessageId, len(createdAt))
+	for i, at := range createdAt {
+		id, err := repo.Create(ctx, CreateMessage{Message: "message", CreatedAt: at})
+		require.NoError(t, err)
+		ids[i] = id
+	}
+	return ids
+}
+
+func testGetAllQuerySort(t *testing.T, repo messages.Repository) {
+	start := now()
+	ids := createAt(t, repo, start.Add(time.Second), start, start.Add(time.Second), start.Add(2*time.Second))
+	fields := map[string]struct{}{messages.FieldId: {}}
+
+	t.Run("ties are ordered by id", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: fields, Sort: []messages.SortKey{{Field: messages.FieldCreatedAt}}}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[1]}, {Id: ids[0]}, {Id: ids[2]}, {Id: ids[3]}}, all)
+	})
+
+	t.Run("descending", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: fields, Sort: []messages.SortKey{{Field: messages.FieldCreatedAt, Desc: true}}}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[3]}, {Id: ids[0]}, {Id: ids[2]}, {Id: ids[1]}}, all)
+	})
+
+	t.Run("multiple keys", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: fields, Sort: []messages.SortKey{
+			{Field: messages.FieldCreatedAt, Desc: true},
+			{Field: messages.FieldId, Desc: true},
+		}}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[3]}, {Id: ids[2]}, {Id: ids[0]}, {Id: ids[1]}}, all)
+	})
+
+	t.Run("sort fields do not need to be retrieved", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{
+			Fields: fields,
+			Sort:   []messages.SortKey{{Field: messages.FieldCreatedAt}},
+			Limit:  2,
+			Offset: 1,
+		}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[0]}, {Id: ids[2]}}, all)
+	})
+}
+
+func testGetAllQuerySortCursors(t *testing.T, repo messages.Repository) {
+	start := now()
+	ids := createAt(t, repo, start.Add(time.Second), start, start.Add(time.Second), start.Add(2*time.Second))
+	fields := map[string]struct{}{messages.FieldId: {}}
+	sortBy := []messages.SortKey{{Field: messages.FieldCreatedAt, Desc: true}}
+
+	// Order is ids[3], ids[0], ids[2], ids[1].
+	cursorAt := func(id messages.MessageId) *messages.Cursor {
+		var m Message
+		require.NoError(t, repo.GetById(ctx, id, &m))
+		return messages.CursorAt(&m)
+	}
+
+	t.Run("after", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: fields, Sort: sortBy, After: cursorAt(ids[0]), Limit: 2}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[2]}, {Id: ids[1]}}, all)
+	})
+
+	t.Run("before", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{Fields: fields, Sort: sortBy, Before: cursorAt(ids[1]), Limit: 2}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[0]}, {Id: ids[2]}}, all)
+	})
+}
+
+func testGetAllQueryErrorOnInvalidSortFields(t *testing.T, repo messages.Repository) {
+	var all []*Message
+	q := MessageQuery{Sort: []messages.SortKey{{Field: messages.FieldId}, {Field: "bad", Desc: true}}}
+	err := repo.GetAllQuery(ctx, q, &all)
+	require.Error(t, err)
+
+	var appErr *apperrors.Error
+	require.True(t, errors.As(err, &appErr), "expected an apperrors.Error, got: %v", err)
+	require.Equal(t, apperrors.ETInvalid, appErr.EType)
+	out, err := apperrors.ToJSON(appErr)
+	require.NoError(t, err)
+	require.Equal(t, `{"errors":[{"error":"invalid messages sort fields: bad",`+
+		`"code":"query.sort.field.invalid"}]}`, string(out))
+}
+
+func testGetAllQueryFilter(t *testing.T, repo messages.Repository) {
+	start := now()
+	ids := make([]messages.MessageId, 4)
+	for i, text := range []string{"first", "second", "third", "last message"} {
+		id, err := repo.Create(ctx, CreateMessage{Message: text, CreatedAt: start.Add(time.Duration(i) * time.Second)})
+		require.NoError(t, err)
+		ids[i] = id
+	}
+	_, err := repo.UpdateById(ctx, ids[1], messages.AnyVersion, UpdateMessage{Message: "second updated"})
+	require.NoError(t, err)
+	fields := map[string]struct{}{messages.FieldId: {}}
+
+	cond := func(field messages.Field, op messages.FilterOp, value interface{}) messages.Condition {
+		return messages.Condition{Field: field, Op: op, Value: value}
+	}
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	cases := []struct {
+		name     string
+		filter   messages.Filter
+		expected []messages.MessageId
+	}{
+		{"eq", cond(messages.FieldId, messages.FilterEq, ids[2]), ids[2:3]},
+		{"ne", cond(messages.FieldId, messages.FilterNe, ids[2]), []messages.MessageId{ids[0], ids[1], ids[3]}},
+		{"gt", cond(messages.FieldVersion, messages.FilterGt, 1), ids[1:2]},
+		{"gte", cond(messages.FieldCreatedAt, messages.FilterGte, at(2)), ids[2:]},
+		{"lt", cond(messages.FieldCreatedAt, messages.FilterLt, at(2)), ids[:2]},
+		{"lte", cond(messages.FieldCreatedAt, messages.FilterLte, at(2)), ids[:3]},
+		{"time in another zone", cond(messages.FieldCreatedAt, messages.FilterLt, at(2).In(aheadOfUtc)), ids[:2]},
+		{"message eq", cond(messages.FieldMessage, messages.FilterEq, "third"), ids[2:3]},
+		{"contains", cond(messages.FieldMessage, messages.FilterContains, "s"), []messages.MessageId{ids[0], ids[1], ids[3]}},
+		{"contains is case-sensitive", cond(messages.FieldMessage, messages.FilterContains, "S"), nil},
+		{"contains wildcards are literal", cond(messages.FieldMessage, messages.FilterContains, "%"), nil},
+		{"and", messages.And{
+			cond(messages.FieldCreatedAt, messages.FilterGt, at(0)),
+			cond(messages.FieldMessage, messages.FilterContains, "ir"),
+		}, ids[2:3]},
+		{"or", messages.Or{
+			cond(messages.FieldId, messages.FilterEq, ids[0]),
+			messages.And{
+				cond(messages.FieldVersion, messages.FilterEq, 1),
+				cond(messages.FieldMessage, messages.FilterEq, "last message"),
+			},
+		}, []messages.MessageId{ids[0], ids[3]}},
+		{"empty and", messages.And{}, ids},
+		{"empty or", messages.Or{}, nil},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var all []*Message
+			require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: fields, Filter: c.filter}, &all))
+			var out []messages.MessageId
+			for _, m := range all {
+				out = append(out, m.Id)
+			}
+			require.Equal(t, c.expected, out)
+		})
+	}
+
+	t.Run("with a cursor", func(t *testing.T) {
+		var all []*Message
+		q := MessageQuery{
+			Fields: fields,
+			Filter: cond(messages.FieldMessage, messages.FilterContains, "s"),
+			After:  &messages.Cursor{Id: ids[0]},
+			Limit:  1,
+		}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: ids[1]}}, all)
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		require.NoError(t, repo.DeleteById(ctx, ids[0], messages.AnyVersion))
+		require.NoError(t, repo.DeleteById(ctx, ids[2], messages.AnyVersion))
+		var all []*Message
+		q := MessageQuery{Fields: fields, Filter: cond(messages.FieldMessage, messages.FilterContains, "ir")}
+		require.NoError(t, repo.GetDeletedQuery(ctx, q, &all))
+		require.Len(t, all, 2)
+		require.Equal(t, ids[0], all[0].Id)
+		require.Equal(t, ids[2], all[1].Id)
+	})
+}
+
+func testGetAllQueryTotal(t *testing.T, repo messages.Repository) {
+	ids := make([]messages.MessageId, 5)
+	for i, text := range []string{"a1", "b1", "a2", "b2", "a3"} {
+		ids[i] = create(t, repo, text)
+	}
+	require.NoError(t, repo.DeleteById(ctx, ids[4], messages.AnyVersion))
+	fields := map[string]struct{}{messages.FieldId: {}}
+	startsWithA := messages.Condition{Field: messages.FieldMessage, Op: messages.FilterContains, Value: "a"}
+
+	cases := []struct {
+		name     string
+		query    MessageQuery
+		expected []messages.MessageId
+		total    int64
+	}{
+		{"all", MessageQuery{Fields: fields}, ids[:4], 4},
+		{"page", MessageQuery{Fields: fields, Limit: 2, Offset: 1}, ids[1:3], 4},
+		{"empty page", MessageQuery{Fields: fields, Limit: 2, Offset: 10}, nil, 4},
+		{"after", MessageQuery{Fields: fields, Limit: 1, After: &messages.Cursor{Id: ids[0]}}, ids[1:2], 4},
+		{"after the last message", MessageQuery{Fields: fields, After: &messages.Cursor{Id: ids[3]}}, nil, 4},
+		{"before", MessageQuery{Fields: fields, Limit: 1, Before: &messages.Cursor{Id: ids[3]}}, ids[2:3], 4},
+		{"filter", MessageQuery{Fields: fields, Filter: startsWithA, Limit: 1}, ids[:1], 2},
+		{"filter matching nothing", MessageQuery{Fields: fields, Filter: messages.Or{}}, nil, 0},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var all []*Message
+			total, err := repo.GetAllQueryTotal(ctx, c.query, &all)
+			require.NoError(t, err)
+			require.Equal(t, c.total, total)
+			var out []messages.MessageId
+			for _, m := range all {
+				out = append(out, m.Id)
+			}
+			require.Equal(t, c.expected, out)
+		})
+	}
+}
+
+func testGetDeletedQueryTotal(t *testing.T, repo messages.Repository) {
+	ids := make([]messages.MessageId, 3)
+	for i := range ids {
+		ids[i] = create(t, repo, "message")
+	}
+	require.NoError(t, repo.DeleteById(ctx, ids[0], messages.AnyVersion))
+	require.NoError(t, repo.DeleteById(ctx, ids[2], messages.AnyVersion))
+
+	var all []*Message
+	total, err := repo.GetDeletedQueryTotal(ctx, MessageQuery{Limit: 1}, &all)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	require.Len(t, all, 1)
+	require.Equal(t, ids[0], all[0].Id)
+	require.NotNil(t, all[0].DeletedAt)
+}
+
+func testIsPalindrome(t *testing.T, repo messages.Repository) {
+	palindrome, err := repo.Create(ctx, CreateMessage{Message: "abba", IsPalindrome: true, CreatedAt: now()})
+	require.NoError(t, err)
+	other := create(t, repo, "abc")
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, palindrome, &m))
+	require.True(t, m.IsPalindrome)
+
+	t.Run("can be filtered and sorted on", func(t *testing.T) {
+		fields := map[string]struct{}{messages.FieldId: {}, messages.FieldIsPalindrome: {}}
+		var all []*Message
+		q := MessageQuery{
+			Fields: fields,
+			Filter: messages.Condition{Field: messages.FieldIsPalindrome, Op: messages.FilterEq, Value: true},
+		}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: palindrome, IsPalindrome: true}}, all)
+
+		q = MessageQuery{Fields: fields, Sort: []messages.SortKey{{Field: messages.FieldIsPalindrome, Desc: true}}}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: palindrome, IsPalindrome: true}, {Id: other}}, all)
+
+		q = MessageQuery{
+			Fields: fields,
+			Sort:   []messages.SortKey{{Field: messages.FieldIsPalindrome, Desc: true}},
+			After:  &messages.Cursor{Id: palindrome, IsPalindrome: true},
+		}
+		require.NoError(t, repo.GetAllQuery(ctx, q, &all))
+		require.Equal(t, []*Message{{Id: other}}, all)
+	})
+
+	t.Run("is updated with the message and kept in the history", func(t *testing.T) {
+		_, err := repo.UpdateById(ctx, palindrome, messages.AnyVersion,
+			UpdateMessage{Message: "abc", IsPalindrome: false})
+		require.NoError(t, err)
+
+		var m Message
+		require.NoError(t, repo.GetById(ctx, palindrome, &m))
+		require.False(t, m.IsPalindrome)
+
+		require.NoError(t, repo.GetVersion(ctx, palindrome, 1, &m))
+		require.True(t, m.IsPalindrome)
+	})
+}
+
+func testGetAllQueryFieldFiltering(t *testing.T, repo messages.Repository) {
+	createdAt := now()
+	id, err := repo.Create(ctx, CreateMessage{Message: "my message", CreatedAt: createdAt})
+	require.NoError(t, err)
+
+	t.Run("all fields are returned when none are specified", func(t *testing.T) {
+		var all []*Message
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{}, &all))
+		require.Len(t, all, 1)
+		require.Equal(t, id, all[0].Id)
+		require.Equal(t, 1, all[0].Version)
+		require.Equal(t, "my message", all[0].Message)
+		require.True(t, createdAt.Equal(all[0].CreatedAt))
+		require.True(t, createdAt.Equal(all[0].UpdatedAt))
+	})
+
+	t.Run("only the specified fields are returned", func(t *testing.T) {
+		var all []*Message
+		fields := map[string]struct{}{messages.FieldVersion: {}, messages.FieldMessage: {}}
+		require.NoError(t, repo.GetAllQuery(ctx, MessageQuery{Fields: fields}, &all))
+		require.Equal(t, []*Message{{Version: 1, Message: "my message"}}, all)
+	})
+}
+
+func testGetAllQueryErrorOnInvalidFields(t *testing.T, repo messages.Repository) {
+	var all []*Message
+	err := repo.GetAllQuery(ctx, MessageQuery{Fields: map[string]struct{}{"id": {}, "bad": {}}}, &all)
+	require.Error(t, err)
+
+	var appErr *apperrors.Error
+	require.True(t, errors.As(err, &appErr), "expected an apperrors.Error, got: %v", err)
+	require.Equal(t, apperrors.ETInvalid, appErr.EType)
+	out, err := apperrors.ToJSON(appErr)
+	require.NoError(t, err)
+	require.Equal(t, `{"errors":[{"error":"invalid messages fields: bad","code":"query.fields.invalid"}]}`, string(out))
+}
+
+func testGetVersions(t *testing.T, repo messages.Repository) {
+	createdAt := now()
+	id, err := repo.Create(ctx, CreateMessage{Message: "first message", CreatedAt: createdAt})
+	require.NoError(t, err)
+	_, err = repo.UpdateById(ctx, id, messages.AnyVersion, UpdateMessage{Message: "second message"})
+	require.NoError(t, err)
+
+	// Versions of other messages are not included.
+	other := create(t, repo, "other message")
+
+	var current Message
+	require.NoError(t, repo.GetById(ctx, id, &current))
+
+	var versions []*Message
+	require.NoError(t, repo.GetVersions(ctx, id, &versions))
+	require.Len(t, versions, 2)
+	require.Equal(t, id, versions[0].Id)
+	require.Equal(t, 1, versions[0].Version)
+	require.Equal(t, "first message", versions[0].Message)
+	require.True(t, createdAt.Equal(versions[0].CreatedAt))
+	require.True(t, createdAt.Equal(versions[0].UpdatedAt))
+	require.Equal(t, &current, versions[1])
+
+	requireIdMissing(t, repo.GetVersions(ctx, other+1, &versions), other+1)
+}
+
+func testGetVersion(t *testing.T, repo messages.Repository) {
+	id := create(t, repo, "first message")
+	_, err := repo.UpdateById(ctx, id, messages.AnyVersion, UpdateMessage{Message: "second message"})
+	require.NoError(t, err)
+
+	var m Message
+	require.NoError(t, repo.GetVersion(ctx, id, 1, &m))
+	require.Equal(t, 1, m.Version)
+	require.Equal(t, "first message", m.Message)
+
+	require.NoError(t, repo.GetVersion(ctx, id, 2, &m))
+	require.Equal(t, 2, m.Version)
+	require.Equal(t, "second message", m.Message)
+
+	err = repo.GetVersion(ctx, id, 3, &m)
+	var vErr messages.VersionMissingError
+	require.True(t, errors.As(err, &vErr), "expected VersionMissingError, got: %v", err)
+	require.Equal(t, id, vErr.Id)
+	require.Equal(t, 3, vErr.Version)
+
+	requireIdMissing(t, repo.GetVersion(ctx, id+1, 1, &m), id+1)
+}
+
+func testTrash(t *testing.T, repo messages.Repository) {
+	kept := create(t, repo, "kept")
+	id := create(t, repo, "deleted")
+	_, err := repo.UpdateById(ctx, id, messages.AnyVersion, UpdateMessage{Message: "deleted message"})
+	require.NoError(t, err)
+
+	_, err = repo.UndeleteById(ctx, id)
+	requireIdMissing(t, err, id)
+
+	require.NoError(t, repo.DeleteById(ctx, id, messages.AnyVersion))
+
+	var versions []*Message
+	requireIdMissing(t, repo.GetVersions(ctx, id, &versions), id)
+
+	var deleted []*Message
+	require.NoError(t, repo.GetDeletedQuery(ctx, MessageQuery{}, &deleted))
+	require.Len(t, deleted, 1)
+	require.Equal(t, id, deleted[0].Id)
+	require.Equal(t, "deleted message", deleted[0].Message)
+	require.NotNil(t, deleted[0].DeletedAt)
+
+	version, err := repo.UndeleteById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, id, &m))
+	require.Equal(t, "deleted message", m.Message)
+	require.NoError(t, repo.GetVersions(ctx, id, &versions))
+	require.Len(t, versions, 2)
+	require.NoError(t, repo.GetById(ctx, kept, &m))
+
+	require.NoError(t, repo.GetDeletedQuery(ctx, MessageQuery{}, &deleted))
+	require.Len(t, deleted, 0)
+}
+
+func testPurgeDeleted(t *testing.T, repo messages.Repository) {
+	kept := create(t, repo, "kept")
+	id := create(t, repo, "deleted")
+	require.NoError(t, repo.DeleteById(ctx, id, messages.AnyVersion))
+
+	purged, err := repo.PurgeDeleted(ctx, now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged, "messages deleted after the given time are kept")
+
+	purged, err = repo.PurgeDeleted(ctx, now().Add(-time.Hour).In(aheadOfUtc))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged, "the time zone of the given time is taken into account")
+
+	purged, err = repo.PurgeDeleted(ctx, now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+
+	_, err = repo.UndeleteById(ctx, id)
+	requireIdMissing(t, err, id)
+
+	var m Message
+	require.NoError(t, repo.GetById(ctx, kept, &m), "messages that are not deleted are never purged")
+}
+
+func testSearch(t *testing.T, repo messages.Repository) {
+	fox := create(t, repo, "The quick brown fox")
+	thinking := create(t, repo, "Quick thinking")
+	create(t, repo, "slow turtle")
+	deleted := create(t, repo, "quick but deleted")
+	require.NoError(t, repo.DeleteById(ctx, deleted, messages.AnyVersion))
+
+	search := func(query messages.SearchQuery) []*messages.SearchResult {
+		var results []*messages.SearchResult
+		require.NoError(t, repo.Search(ctx, query, &results))
+		return results
+	}
+
+	t.Run("matches case-insensitively and highlights the matching terms", func(t *testing.T) {
+		results := search(messages.SearchQuery{Text: "quick"})
+		require.Len(t, results, 2)
+		highlights := map[messages.MessageId]string{}
+		for i, r := range results {
+			require.Greater(t, r.Rank, 0.0)
+			if i > 0 {
+				require.LessOrEqual(t, r.Rank, results[i-1].Rank, "results are ordered by rank")
+			}
+			highlights[r.Id] = r.Highlight
+		}
+		require.Equal(t, map[messages.MessageId]string{
+			fox:      "The <b>quick</b> brown fox",
+			thinking: "<b>Quick</b> thinking",
+		}, highlights)
+	})
+
+	t.Run("only the requested fields are retrieved", func(t *testing.T) {
+		results := search(messages.SearchQuery{Text: "turtle", Fields: map[string]struct{}{messages.FieldId: {}}})
+		require.Len(t, results, 1)
+		require.NotZero(t, results[0].Id)
+		require.Empty(t, results[0].Message.Message)
+		require.Equal(t, "slow <b>turtle</b>", results[0].Highlight)
+	})
+
+	t.Run("pages results", func(t *testing.T) {
+		first := search(messages.SearchQuery{Text: "quick", Limit: 1})
+		require.Len(t, first, 1)
+		second := search(messages.SearchQuery{Text: "quick", Limit: 1, Offset: 1})
+		require.Len(t, second, 1)
+		require.ElementsMatch(t, []messages.MessageId{fox, thinking}, []messages.MessageId{first[0].Id, second[0].Id})
+		require.Empty(t, search(messages.SearchQuery{Text: "quick", Offset: 2}))
+	})
+
+	t.Run("no results when nothing matches", func(t *testing.T) {
+		require.Empty(t, search(messages.SearchQuery{Text: "elephant"}))
+	})
+
+	t.Run("error on invalid fields", func(t *testing.T) {
+		var results []*messages.SearchResult
+		err := repo.Search(ctx, messages.SearchQuery{Text: "quick", Fields: map[string]struct{}{"bad": {}}}, &results)
+		var appErr *apperrors.Error
+		require.True(t, errors.As(err, &appErr), "expected an apperrors.Error, got: %v", err)
+		require.Equal(t, apperrors.ETInvalid, appErr.EType)
+	})
+}